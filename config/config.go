@@ -0,0 +1,585 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/events"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/retry"
+	"github.com/Piszmog/feedback-service/transport"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const redacted = "******"
+
+// Config is the complete configuration of the application.
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	DB         db.Options `yaml:"db" toml:"db"`
+	Startup    Startup    `yaml:"startup" toml:"startup"`
+	Moderation Moderation `yaml:"moderation" toml:"moderation"`
+	Webhooks   Webhooks   `yaml:"webhooks" toml:"webhooks"`
+	Events     Events     `yaml:"events" toml:"events"`
+}
+
+// Server is the configuration of the HTTP server.
+type Server struct {
+	Host            string        `yaml:"host" toml:"host"`
+	Port            string        `yaml:"port" toml:"port"`
+	ReadTimeout     time.Duration `yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout" toml:"idleTimeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	// GRPCPort is the port to serve the gRPC API on. The gRPC API is not served when empty.
+	GRPCPort string `yaml:"grpcPort" toml:"grpcPort"`
+	// PreStopDelay is how long to keep serving requests after a shutdown signal while reporting not ready.
+	PreStopDelay time.Duration `yaml:"preStopDelay" toml:"preStopDelay"`
+	TLS          TLS           `yaml:"tls" toml:"tls"`
+	CORS         CORS          `yaml:"cors" toml:"cors"`
+	// LegacyRoutes mounts the deprecated unversioned routes at the root.
+	LegacyRoutes bool `yaml:"legacyRoutes" toml:"legacyRoutes"`
+	// LegacySunset is the date, e.g. '2020-06-30', the legacy routes will be removed.
+	LegacySunset string `yaml:"legacySunset" toml:"legacySunset"`
+	// TrustedTokens authenticate the services that can provide when feedback occurred.
+	TrustedTokens []string `yaml:"trustedTokens" toml:"trustedTokens"`
+	// OccurredAtWindow is how far in the past trusted services can date feedback.
+	OccurredAtWindow time.Duration `yaml:"occurredAtWindow" toml:"occurredAtWindow"`
+	// IdempotencyTTL is how long the responses of requests with an Idempotency-Key header are replayed. Disabled when 0.
+	IdempotencyTTL time.Duration `yaml:"idempotencyTTL" toml:"idempotencyTTL"`
+	// GraphQLMaxComplexity is how complex a GraphQL query can be. Every field costs 1, multiplied by the size of the lists
+	// it is selected within.
+	GraphQLMaxComplexity int `yaml:"graphQLMaxComplexity" toml:"graphQLMaxComplexity"`
+	// OperatorTokens authenticate the operators that review flagged feedback. A token named "name:token" audits the
+	// reviews as made by the operator.
+	OperatorTokens []string `yaml:"operatorTokens" toml:"operatorTokens"`
+	Stream         Stream   `yaml:"stream" toml:"stream"`
+}
+
+// Stream is the configuration of the streams of newly inserted feedback.
+type Stream struct {
+	// HeartbeatInterval is how often an idle stream is written to so proxies do not close it.
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval" toml:"heartbeatInterval"`
+	// History is how many of the most recent feedback are kept for clients resuming a stream.
+	History int `yaml:"history" toml:"history"`
+	// Buffer is how many feedback a client can fall behind before its stream is closed.
+	Buffer int `yaml:"buffer" toml:"buffer"`
+	// MaxSubscriptions is how many sessions a WebSocket connection can subscribe to.
+	MaxSubscriptions int `yaml:"maxSubscriptions" toml:"maxSubscriptions"`
+}
+
+// CORS is the configuration for browsers calling the APIs from other origins. CORS is enabled when allowed origins are
+// configured.
+type CORS struct {
+	// AllowedOrigins can have a wildcard subdomain, e.g. 'https://*.example.com', or be '*' to allow any origin.
+	AllowedOrigins   []string      `yaml:"allowedOrigins" toml:"allowedOrigins"`
+	AllowedMethods   []string      `yaml:"allowedMethods" toml:"allowedMethods"`
+	AllowedHeaders   []string      `yaml:"allowedHeaders" toml:"allowedHeaders"`
+	ExposedHeaders   []string      `yaml:"exposedHeaders" toml:"exposedHeaders"`
+	AllowCredentials bool          `yaml:"allowCredentials" toml:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge" toml:"maxAge"`
+}
+
+// TLS is the configuration for serving HTTPS. HTTPS is served when a certificate file is configured.
+type TLS struct {
+	CertFile   string `yaml:"certFile" toml:"certFile"`
+	KeyFile    string `yaml:"keyFile" toml:"keyFile"`
+	MinVersion string `yaml:"minVersion" toml:"minVersion"`
+	// ClientAuth is one of 'none', 'optional' or 'require'.
+	ClientAuth     string        `yaml:"clientAuth" toml:"clientAuth"`
+	ClientCAFile   string        `yaml:"clientCAFile" toml:"clientCAFile"`
+	ReloadInterval time.Duration `yaml:"reloadInterval" toml:"reloadInterval"`
+	// RedirectPort is the port to redirect plaintext requests to HTTPS from. Disabled when empty.
+	RedirectPort string `yaml:"redirectPort" toml:"redirectPort"`
+}
+
+// Moderation is the configuration of how comments are moderated. Each action is one of 'allow', 'mask', 'flag' or
+// 'reject', 'allow' disabling the check.
+type Moderation struct {
+	// Wordlist are the words that are not allowed in comments, in addition to those of the wordlist file.
+	Wordlist []string `yaml:"wordlist" toml:"wordlist"`
+	// WordlistFile has a word per line. Lines starting with '#' are ignored.
+	WordlistFile   string `yaml:"wordlistFile" toml:"wordlistFile"`
+	WordlistAction string `yaml:"wordlistAction" toml:"wordlistAction"`
+	// MaxLinks is how many links a comment can have.
+	MaxLinks    int    `yaml:"maxLinks" toml:"maxLinks"`
+	LinksAction string `yaml:"linksAction" toml:"linksAction"`
+	// MaxRepeatedCharacters is how many times a character can be repeated in a row.
+	MaxRepeatedCharacters    int    `yaml:"maxRepeatedCharacters" toml:"maxRepeatedCharacters"`
+	RepeatedCharactersAction string `yaml:"repeatedCharactersAction" toml:"repeatedCharactersAction"`
+	// ReportThreshold is how many users have to report a feedback for it to be hidden. Reports never hide feedback
+	// when 0.
+	ReportThreshold int `yaml:"reportThreshold" toml:"reportThreshold"`
+}
+
+// Startup is the configuration of how long to wait on the DB when the application starts.
+type Startup struct {
+	RetryInitialInterval time.Duration `yaml:"retryInitialInterval" toml:"retryInitialInterval"`
+	RetryMaxInterval     time.Duration `yaml:"retryMaxInterval" toml:"retryMaxInterval"`
+	// RetryMaxWait is how long to keep retrying before the application exits.
+	RetryMaxWait time.Duration `yaml:"retryMaxWait" toml:"retryMaxWait"`
+}
+
+// Webhooks is the configuration of how the events of feedback are delivered to webhooks.
+type Webhooks struct {
+	// PollInterval is how often the outbox is checked for deliveries that are due. Webhooks are not delivered when 0.
+	PollInterval time.Duration `yaml:"pollInterval" toml:"pollInterval"`
+	// Timeout is how long a webhook has to respond to a delivery.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// BatchSize is how many deliveries are attempted at once.
+	BatchSize int `yaml:"batchSize" toml:"batchSize"`
+	// MaxAttempts is how many times a delivery is attempted before it is dead-lettered.
+	MaxAttempts          int           `yaml:"maxAttempts" toml:"maxAttempts"`
+	RetryInitialInterval time.Duration `yaml:"retryInitialInterval" toml:"retryInitialInterval"`
+	RetryMaxInterval     time.Duration `yaml:"retryMaxInterval" toml:"retryMaxInterval"`
+}
+
+// Publishers of the events of feedback.
+const (
+	// PublisherKafka publishes the events to a Kafka topic.
+	PublisherKafka = "kafka"
+	// PublisherNATS publishes the events to a NATS JetStream subject.
+	PublisherNATS = "nats"
+	// PublisherFile writes the events to a file, or stdout.
+	PublisherFile = "file"
+)
+
+// Events is the configuration of how the events of feedback are published to a message broker.
+type Events struct {
+	// Publisher is one of PublisherKafka, PublisherNATS or PublisherFile. Events are not written to the outbox when
+	// empty.
+	Publisher string `yaml:"publisher" toml:"publisher"`
+	// PollInterval is how often the outbox is checked for events to publish.
+	PollInterval time.Duration `yaml:"pollInterval" toml:"pollInterval"`
+	// BatchSize is how many events are published at once.
+	BatchSize int `yaml:"batchSize" toml:"batchSize"`
+	// Timeout is how long the message broker has to acknowledge the events.
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout"`
+	KafkaBrokers []string      `yaml:"kafkaBrokers" toml:"kafkaBrokers"`
+	KafkaTopic   string        `yaml:"kafkaTopic" toml:"kafkaTopic"`
+	NATSURL      string        `yaml:"natsURL" toml:"natsURL"`
+	NATSSubject  string        `yaml:"natsSubject" toml:"natsSubject"`
+	// File is the file the events are appended to, '-' for stdout.
+	File string `yaml:"file" toml:"file"`
+}
+
+// Default provides the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Host:                 "localhost",
+			Port:                 "8080",
+			ReadTimeout:          15 * time.Second,
+			WriteTimeout:         15 * time.Second,
+			IdleTimeout:          60 * time.Second,
+			ShutdownTimeout:      5 * time.Second,
+			LegacyRoutes:         true,
+			OccurredAtWindow:     30 * 24 * time.Hour,
+			IdempotencyTTL:       24 * time.Hour,
+			GraphQLMaxComplexity: 1000,
+			TLS: TLS{
+				MinVersion:     "1.2",
+				ClientAuth:     "none",
+				ReloadInterval: time.Minute,
+			},
+			CORS: CORS{
+				AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete},
+				AllowedHeaders: []string{"Content-Type", "Ubi-UserId", "Authorization", "Idempotency-Key", "If-Match",
+					"If-None-Match", "Last-Event-ID"},
+				ExposedHeaders: []string{"Location", "Idempotent-Replayed", "ETag"},
+				MaxAge:         10 * time.Minute,
+			},
+			Stream: Stream{
+				HeartbeatInterval: 15 * time.Second,
+				History:           1000,
+				Buffer:            64,
+				MaxSubscriptions:  100,
+			},
+		},
+		DB: db.Options{
+			Host:            "localhost",
+			Port:            "3306",
+			DatabaseName:    "ubisoft",
+			ParseTime:       true,
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			DialTimeout:     5 * time.Second,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			TLSMode:         db.TLSDisabled,
+			Charset:         "utf8mb4",
+			Collation:       "utf8mb4_unicode_ci",
+		},
+		Startup: Startup{
+			RetryInitialInterval: time.Second,
+			RetryMaxInterval:     30 * time.Second,
+			RetryMaxWait:         5 * time.Minute,
+		},
+		Moderation: Moderation{
+			WordlistAction:           string(moderation.Mask),
+			LinksAction:              string(moderation.Flag),
+			MaxRepeatedCharacters:    4,
+			RepeatedCharactersAction: string(moderation.Mask),
+			ReportThreshold:          5,
+		},
+		Webhooks: Webhooks{
+			PollInterval:         5 * time.Second,
+			Timeout:              10 * time.Second,
+			BatchSize:            20,
+			MaxAttempts:          10,
+			RetryInitialInterval: 30 * time.Second,
+			RetryMaxInterval:     6 * time.Hour,
+		},
+		Events: Events{
+			PollInterval: time.Second,
+			BatchSize:    100,
+			Timeout:      10 * time.Second,
+			KafkaBrokers: []string{"localhost:9092"},
+			KafkaTopic:   "feedback-events",
+			NATSURL:      "nats://localhost:4222",
+			NATSSubject:  "feedback.events",
+			File:         "-",
+		},
+	}
+}
+
+// Validate validates the configuration.
+func (c Config) Validate() error {
+	if err := c.Server.Validate(); err != nil {
+		return err
+	}
+	if err := c.DB.Validate(); err != nil {
+		return err
+	}
+	if err := c.Startup.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.Moderation.Moderator(); err != nil {
+		return err
+	} else if c.Moderation.ReportThreshold < 0 {
+		return errors.New("require the moderation report threshold to not be negative")
+	}
+	if err := c.Webhooks.Validate(); err != nil {
+		return err
+	}
+	return c.Events.Validate()
+}
+
+// Validate validates the server configuration.
+func (s Server) Validate() error {
+	if len(s.Host) == 0 {
+		return errors.New("require host to run the server on")
+	} else if len(s.Port) == 0 {
+		return errors.New("require port to run the server on")
+	} else if s.GRPCPort == s.Port {
+		return errors.New("require the gRPC port to differ from the port of the server")
+	} else if s.ReadTimeout <= 0 {
+		return errors.New("require a positive server read timeout")
+	} else if s.WriteTimeout <= 0 {
+		return errors.New("require a positive server write timeout")
+	} else if s.IdleTimeout <= 0 {
+		return errors.New("require a positive server idle timeout")
+	} else if s.ShutdownTimeout <= 0 {
+		return errors.New("require a positive server shutdown timeout")
+	} else if s.PreStopDelay < 0 {
+		return errors.New("require the server pre-stop delay to not be negative")
+	} else if len(s.TrustedTokens) > 0 && s.OccurredAtWindow <= 0 {
+		return errors.New("require a positive occurred at window when trusted tokens are configured")
+	} else if s.IdempotencyTTL < 0 {
+		return errors.New("require the idempotency TTL to not be negative")
+	} else if s.GraphQLMaxComplexity <= 0 {
+		return errors.New("require a positive GraphQL max complexity")
+	}
+	if _, err := s.TLS.Options(); err != nil {
+		return err
+	}
+	if err := s.CORS.Validate(); err != nil {
+		return err
+	}
+	if err := s.Stream.Validate(); err != nil {
+		return err
+	}
+	if _, err := s.LegacySunsetTime(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the stream configuration.
+func (s Stream) Validate() error {
+	if s.HeartbeatInterval <= 0 {
+		return errors.New("require the stream heartbeat interval to be positive")
+	} else if s.History < 0 {
+		return errors.New("require the stream history to not be negative")
+	} else if s.Buffer <= 0 {
+		return errors.New("require the stream buffer to be positive")
+	} else if s.MaxSubscriptions <= 0 {
+		return errors.New("require the stream max subscriptions to be positive")
+	}
+	return nil
+}
+
+// LegacySunsetTime provides when the legacy routes will be removed. A zero time is returned when not configured.
+func (s Server) LegacySunsetTime() (time.Time, error) {
+	if len(s.LegacySunset) == 0 {
+		return time.Time{}, nil
+	}
+	sunset, err := time.Parse("2006-01-02", s.LegacySunset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid legacy sunset date: %w", err)
+	}
+	return sunset, nil
+}
+
+// Validate validates the CORS configuration.
+func (c CORS) Validate() error {
+	if c.MaxAge < 0 {
+		return errors.New("require the CORS max age to not be negative")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			return errors.New("require specific CORS allowed origins when allowing credentials")
+		}
+	}
+	return nil
+}
+
+// Options provides the CORS options. Nil is returned when CORS is not enabled.
+func (c CORS) Options() *transport.CORSOptions {
+	if len(c.AllowedOrigins) == 0 {
+		return nil
+	}
+	return &transport.CORSOptions{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// Options provides the options to serve HTTPS with. Nil is returned when HTTPS is not configured.
+func (t TLS) Options() (*transport.TLSOptions, error) {
+	if len(t.CertFile) == 0 && len(t.KeyFile) == 0 {
+		return nil, nil
+	} else if len(t.CertFile) == 0 || len(t.KeyFile) == 0 {
+		return nil, errors.New("require both a TLS certificate and key file to serve HTTPS")
+	} else if t.ReloadInterval < 0 {
+		return nil, errors.New("require the TLS reload interval to not be negative")
+	}
+	minVersion, err := transport.ParseTLSVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := transport.ParseClientAuth(t.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth != tls.NoClientCert && len(t.ClientCAFile) == 0 {
+		return nil, errors.New("require a client CA file to verify client certificates")
+	}
+	return &transport.TLSOptions{
+		CertFile:       t.CertFile,
+		KeyFile:        t.KeyFile,
+		MinVersion:     minVersion,
+		ClientCAFile:   t.ClientCAFile,
+		ClientAuth:     clientAuth,
+		ReloadInterval: t.ReloadInterval,
+	}, nil
+}
+
+// Validate validates the startup configuration.
+func (s Startup) Validate() error {
+	if s.RetryInitialInterval <= 0 {
+		return errors.New("require a positive startup retry initial interval")
+	} else if s.RetryMaxInterval < s.RetryInitialInterval {
+		return errors.New("require the startup retry max interval to not be less than the initial interval")
+	} else if s.RetryMaxWait < 0 {
+		return errors.New("require the startup retry max wait to not be negative")
+	}
+	return nil
+}
+
+// Validate validates the webhooks configuration.
+func (w Webhooks) Validate() error {
+	if w.PollInterval < 0 {
+		return errors.New("require the webhooks poll interval to not be negative")
+	} else if w.Timeout <= 0 {
+		return errors.New("require a positive webhooks timeout")
+	} else if w.BatchSize <= 0 {
+		return errors.New("require a positive webhooks batch size")
+	} else if w.MaxAttempts <= 0 {
+		return errors.New("require a positive webhooks max attempts")
+	} else if w.RetryInitialInterval <= 0 {
+		return errors.New("require a positive webhooks retry initial interval")
+	} else if w.RetryMaxInterval < w.RetryInitialInterval {
+		return errors.New("require the webhooks retry max interval to not be less than the initial interval")
+	}
+	return nil
+}
+
+// Backoff provides the backoff between the attempts of a webhook delivery.
+func (w Webhooks) Backoff() retry.Backoff {
+	return retry.Backoff{
+		InitialInterval: w.RetryInitialInterval,
+		MaxInterval:     w.RetryMaxInterval,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Validate validates the events configuration.
+func (e Events) Validate() error {
+	switch e.Publisher {
+	case "":
+		return nil
+	case PublisherKafka:
+		if len(e.KafkaBrokers) == 0 || len(e.KafkaTopic) == 0 {
+			return errors.New("require the Kafka brokers and topic to publish events to Kafka")
+		}
+	case PublisherNATS:
+		if len(e.NATSURL) == 0 || len(e.NATSSubject) == 0 {
+			return errors.New("require the NATS URL and subject to publish events to NATS")
+		}
+	case PublisherFile:
+		if len(e.File) == 0 {
+			return errors.New("require the file to write events to")
+		}
+	default:
+		return fmt.Errorf("unknown events publisher '%s', must be %s, %s or %s", e.Publisher, PublisherKafka,
+			PublisherNATS, PublisherFile)
+	}
+	if e.PollInterval <= 0 {
+		return errors.New("require a positive events poll interval")
+	} else if e.BatchSize <= 0 {
+		return errors.New("require a positive events batch size")
+	} else if e.Timeout <= 0 {
+		return errors.New("require a positive events timeout")
+	}
+	return nil
+}
+
+// NewPublisher creates the publisher of the events. NATS is connected to right away.
+func (e Events) NewPublisher() (events.Publisher, error) {
+	switch e.Publisher {
+	case PublisherKafka:
+		return events.NewKafka(e.KafkaBrokers, e.KafkaTopic, e.Timeout), nil
+	case PublisherNATS:
+		return events.NewNATS(e.NATSURL, e.NATSSubject, e.Timeout)
+	case PublisherFile:
+		return events.NewFile(e.File)
+	default:
+		return nil, fmt.Errorf("unknown events publisher '%s'", e.Publisher)
+	}
+}
+
+// Moderator provides the chain that moderates comments. The wordlist file is read when configured.
+func (m Moderation) Moderator() (moderation.Moderator, error) {
+	if m.MaxLinks < 0 {
+		return nil, errors.New("require the moderation max links to not be negative")
+	} else if m.MaxRepeatedCharacters < 0 {
+		return nil, errors.New("require the moderation max repeated characters to not be negative")
+	}
+	wordlistAction, err := moderation.ParseAction(m.WordlistAction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid moderation wordlist action: %w", err)
+	}
+	linksAction, err := moderation.ParseAction(m.LinksAction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid moderation links action: %w", err)
+	}
+	repeatedCharactersAction, err := moderation.ParseAction(m.RepeatedCharactersAction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid moderation repeated characters action: %w", err)
+	}
+	words := m.Wordlist
+	if len(m.WordlistFile) > 0 {
+		fileWords, err := moderation.LoadWordlist(m.WordlistFile)
+		if err != nil {
+			return nil, err
+		}
+		words = append(append([]string{}, words...), fileWords...)
+	}
+	return moderation.Chain{
+		moderation.NewWordlist(words, wordlistAction),
+		moderation.Links{Max: m.MaxLinks, Action: linksAction},
+		moderation.RepeatedCharacters{Max: m.MaxRepeatedCharacters, Action: repeatedCharactersAction},
+	}, nil
+}
+
+// Backoff provides the backoff used to retry connecting to the DB at startup.
+func (s Startup) Backoff() retry.Backoff {
+	return retry.Backoff{
+		InitialInterval: s.RetryInitialInterval,
+		MaxInterval:     s.RetryMaxInterval,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxWait:         s.RetryMaxWait,
+	}
+}
+
+// Redacted provides a copy of the configuration with any secrets masked.
+func (c Config) Redacted() Config {
+	if len(c.DB.Password) > 0 {
+		c.DB.Password = redacted
+	}
+	c.Server.TrustedTokens = redactTokens(c.Server.TrustedTokens)
+	c.Server.OperatorTokens = redactTokens(c.Server.OperatorTokens)
+	if len(c.DB.DSN) > 0 {
+		c.DB.DSN = redactDSN(c.DB.DSN)
+	}
+	c.Events.NATSURL = redactURL(c.Events.NATSURL)
+	return c
+}
+
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return redacted
+	} else if _, ok := parsed.User.Password(); !ok {
+		return value
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+	return parsed.String()
+}
+
+func redactTokens(tokens []string) []string {
+	if len(tokens) == 0 {
+		return tokens
+	}
+	redactedTokens := make([]string, len(tokens))
+	for i := range redactedTokens {
+		redactedTokens[i] = redacted
+	}
+	return redactedTokens
+}
+
+func redactDSN(dsn string) string {
+	//
+	// If the DSN cannot be parsed, there is no telling where the secret is
+	//
+	dsnConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if len(dsnConfig.Passwd) > 0 {
+		dsnConfig.Passwd = redacted
+	}
+	return dsnConfig.FormatDSN()
+}
+
+// String provides the configuration, with secrets redacted, in a YAML format.
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("failed to format the configuration: %s", err)
+	}
+	return string(out)
+}
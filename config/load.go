@@ -0,0 +1,257 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	environmentConfigFile = "CONFIG_FILE"
+	flagConfigFile        = "config"
+)
+
+// setting ties a configuration value to the environment variable and the flag that can override it.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value interface{}
+}
+
+func settings(c *Config) []setting {
+	return []setting{
+		{env: "HOST", flag: "host", usage: "the host to run the server on", value: &c.Server.Host},
+		{env: "PORT", flag: "port", usage: "the port to run the server on", value: &c.Server.Port},
+		{env: "GRPC_PORT", flag: "grpc-port", usage: "the port to serve the gRPC API on, empty disables the gRPC API", value: &c.Server.GRPCPort},
+		{env: "SERVER_READ_TIMEOUT", flag: "read-timeout", usage: "the maximum duration for reading a request", value: &c.Server.ReadTimeout},
+		{env: "SERVER_WRITE_TIMEOUT", flag: "write-timeout", usage: "the maximum duration for writing a response", value: &c.Server.WriteTimeout},
+		{env: "SERVER_IDLE_TIMEOUT", flag: "idle-timeout", usage: "the maximum duration to keep an idle connection open", value: &c.Server.IdleTimeout},
+		{env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "the maximum duration to wait for the server to shutdown", value: &c.Server.ShutdownTimeout},
+		{env: "SHUTDOWN_PRE_STOP_DELAY", flag: "pre-stop-delay", usage: "how long to keep serving requests after a shutdown signal while reporting not ready", value: &c.Server.PreStopDelay},
+		{env: "TLS_CERT_FILE", flag: "tls-cert-file", usage: "the certificate file to serve HTTPS with", value: &c.Server.TLS.CertFile},
+		{env: "TLS_KEY_FILE", flag: "tls-key-file", usage: "the key file to serve HTTPS with", value: &c.Server.TLS.KeyFile},
+		{env: "TLS_MIN_VERSION", flag: "tls-min-version", usage: "the minimum TLS version accepted", value: &c.Server.TLS.MinVersion},
+		{env: "TLS_CLIENT_AUTH", flag: "tls-client-auth", usage: "the client certificate policy: none, optional or require", value: &c.Server.TLS.ClientAuth},
+		{env: "TLS_CLIENT_CA_FILE", flag: "tls-client-ca-file", usage: "the CA file used to verify client certificates", value: &c.Server.TLS.ClientCAFile},
+		{env: "TLS_RELOAD_INTERVAL", flag: "tls-reload-interval", usage: "how often to check the TLS files for changes, 0 disables reloading", value: &c.Server.TLS.ReloadInterval},
+		{env: "TLS_REDIRECT_PORT", flag: "tls-redirect-port", usage: "the port to redirect plaintext requests to HTTPS from", value: &c.Server.TLS.RedirectPort},
+		{env: "CORS_ALLOWED_ORIGINS", flag: "cors-allowed-origins", usage: "the origins allowed to call the APIs from a browser", value: &c.Server.CORS.AllowedOrigins},
+		{env: "CORS_ALLOWED_METHODS", flag: "cors-allowed-methods", usage: "the methods allowed from other origins", value: &c.Server.CORS.AllowedMethods},
+		{env: "CORS_ALLOWED_HEADERS", flag: "cors-allowed-headers", usage: "the request headers allowed from other origins", value: &c.Server.CORS.AllowedHeaders},
+		{env: "CORS_EXPOSED_HEADERS", flag: "cors-exposed-headers", usage: "the response headers exposed to other origins", value: &c.Server.CORS.ExposedHeaders},
+		{env: "CORS_ALLOW_CREDENTIALS", flag: "cors-allow-credentials", usage: "whether other origins can send credentials", value: &c.Server.CORS.AllowCredentials},
+		{env: "CORS_MAX_AGE", flag: "cors-max-age", usage: "how long browsers can cache preflight results", value: &c.Server.CORS.MaxAge},
+		{env: "LEGACY_ROUTES", flag: "legacy-routes", usage: "whether to mount the deprecated unversioned routes at the root", value: &c.Server.LegacyRoutes},
+		{env: "LEGACY_SUNSET", flag: "legacy-sunset", usage: "the date, e.g. 2020-06-30, the legacy routes will be removed", value: &c.Server.LegacySunset},
+		{env: "TRUSTED_TOKENS", flag: "trusted-tokens", usage: "the tokens of the services that can provide when feedback occurred", value: &c.Server.TrustedTokens},
+		{env: "OCCURRED_AT_WINDOW", flag: "occurred-at-window", usage: "how far in the past trusted services can date feedback", value: &c.Server.OccurredAtWindow},
+		{env: "IDEMPOTENCY_TTL", flag: "idempotency-ttl", usage: "how long the responses of requests with an Idempotency-Key are replayed, 0 disables", value: &c.Server.IdempotencyTTL},
+		{env: "GRAPHQL_MAX_COMPLEXITY", flag: "graphql-max-complexity", usage: "how complex a GraphQL query can be", value: &c.Server.GraphQLMaxComplexity},
+		{env: "OPERATOR_TOKENS", flag: "operator-tokens", usage: "the tokens, optionally named name:token, of the operators that review flagged feedback", value: &c.Server.OperatorTokens},
+		{env: "STREAM_HEARTBEAT_INTERVAL", flag: "stream-heartbeat-interval", usage: "how often an idle stream is written to", value: &c.Server.Stream.HeartbeatInterval},
+		{env: "STREAM_HISTORY", flag: "stream-history", usage: "how many of the most recent feedback are kept for clients resuming a stream", value: &c.Server.Stream.History},
+		{env: "STREAM_BUFFER", flag: "stream-buffer", usage: "how many feedback a client can fall behind before its stream is closed", value: &c.Server.Stream.Buffer},
+		{env: "STREAM_MAX_SUBSCRIPTIONS", flag: "stream-max-subscriptions", usage: "how many sessions a WebSocket connection can subscribe to", value: &c.Server.Stream.MaxSubscriptions},
+		{env: "DB_HOST", flag: "db-host", usage: "the host of the MySQL DB", value: &c.DB.Host},
+		{env: "DB_PORT", flag: "db-port", usage: "the port of the MySQL DB", value: &c.DB.Port},
+		{env: "DB_USERNAME", flag: "db-username", usage: "the user that has access to the MySQL DB", value: &c.DB.Username},
+		{env: "DB_PASSWORD", flag: "db-password", usage: "the password of the DB user", value: &c.DB.Password},
+		{env: "DB_DATABASE", flag: "db-database", usage: "the name of the database to connect to", value: &c.DB.DatabaseName},
+		{env: "DB_DSN", flag: "db-dsn", usage: "a complete MySQL DSN, overrides the other DB connection options", value: &c.DB.DSN},
+		{env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "the maximum number of open DB connections, 0 is unlimited", value: &c.DB.MaxOpenConns},
+		{env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "the maximum number of idle DB connections", value: &c.DB.MaxIdleConns},
+		{env: "DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "the maximum duration a DB connection is reused, 0 is forever", value: &c.DB.ConnMaxLifetime},
+		{env: "DB_DIAL_TIMEOUT", flag: "db-dial-timeout", usage: "the timeout for establishing a DB connection", value: &c.DB.DialTimeout},
+		{env: "DB_READ_TIMEOUT", flag: "db-read-timeout", usage: "the I/O read timeout of a DB connection", value: &c.DB.ReadTimeout},
+		{env: "DB_WRITE_TIMEOUT", flag: "db-write-timeout", usage: "the I/O write timeout of a DB connection", value: &c.DB.WriteTimeout},
+		{env: "DB_TLS_MODE", flag: "db-tls-mode", usage: "the DB TLS mode: false, true or skip-verify", value: &c.DB.TLSMode},
+		{env: "DB_TLS_CA_FILE", flag: "db-tls-ca-file", usage: "the CA file used to verify the DB server certificate", value: &c.DB.TLSCAFile},
+		{env: "DB_TLS_CERT_FILE", flag: "db-tls-cert-file", usage: "the client certificate file used to authenticate with the DB", value: &c.DB.TLSCertFile},
+		{env: "DB_TLS_KEY_FILE", flag: "db-tls-key-file", usage: "the client key file used to authenticate with the DB", value: &c.DB.TLSKeyFile},
+		{env: "DB_CHARSET", flag: "db-charset", usage: "the character set of DB connections", value: &c.DB.Charset},
+		{env: "DB_COLLATION", flag: "db-collation", usage: "the collation of DB connections", value: &c.DB.Collation},
+		{env: "STARTUP_RETRY_INITIAL_INTERVAL", flag: "startup-retry-initial-interval", usage: "the interval before first retrying to connect to the DB", value: &c.Startup.RetryInitialInterval},
+		{env: "STARTUP_RETRY_MAX_INTERVAL", flag: "startup-retry-max-interval", usage: "the maximum interval between retries to connect to the DB", value: &c.Startup.RetryMaxInterval},
+		{env: "STARTUP_RETRY_MAX_WAIT", flag: "startup-retry-max-wait", usage: "how long to retry connecting to the DB before exiting, 0 retries forever", value: &c.Startup.RetryMaxWait},
+		{env: "MODERATION_WORDLIST", flag: "moderation-wordlist", usage: "the words that are not allowed in comments", value: &c.Moderation.Wordlist},
+		{env: "MODERATION_WORDLIST_FILE", flag: "moderation-wordlist-file", usage: "a file of words, one per line, that are not allowed in comments", value: &c.Moderation.WordlistFile},
+		{env: "MODERATION_WORDLIST_ACTION", flag: "moderation-wordlist-action", usage: "what to do with comments with listed words: allow, mask, flag or reject", value: &c.Moderation.WordlistAction},
+		{env: "MODERATION_MAX_LINKS", flag: "moderation-max-links", usage: "how many links a comment can have", value: &c.Moderation.MaxLinks},
+		{env: "MODERATION_LINKS_ACTION", flag: "moderation-links-action", usage: "what to do with comments with too many links: allow, mask, flag or reject", value: &c.Moderation.LinksAction},
+		{env: "MODERATION_MAX_REPEATED_CHARACTERS", flag: "moderation-max-repeated-characters", usage: "how many times a character can be repeated in a row, 0 disables", value: &c.Moderation.MaxRepeatedCharacters},
+		{env: "MODERATION_REPEATED_CHARACTERS_ACTION", flag: "moderation-repeated-characters-action", usage: "what to do with comments with too many repeated characters: allow, mask, flag or reject", value: &c.Moderation.RepeatedCharactersAction},
+		{env: "MODERATION_REPORT_THRESHOLD", flag: "moderation-report-threshold", usage: "how many users have to report a feedback for it to be hidden, 0 disables", value: &c.Moderation.ReportThreshold},
+		{env: "WEBHOOK_POLL_INTERVAL", flag: "webhook-poll-interval", usage: "how often the webhook outbox is checked for deliveries, 0 disables delivering", value: &c.Webhooks.PollInterval},
+		{env: "WEBHOOK_TIMEOUT", flag: "webhook-timeout", usage: "how long a webhook has to respond to a delivery", value: &c.Webhooks.Timeout},
+		{env: "WEBHOOK_BATCH_SIZE", flag: "webhook-batch-size", usage: "how many webhook deliveries are attempted at once", value: &c.Webhooks.BatchSize},
+		{env: "WEBHOOK_MAX_ATTEMPTS", flag: "webhook-max-attempts", usage: "how many times a webhook delivery is attempted before it is dead-lettered", value: &c.Webhooks.MaxAttempts},
+		{env: "WEBHOOK_RETRY_INITIAL_INTERVAL", flag: "webhook-retry-initial-interval", usage: "the interval before first retrying a webhook delivery", value: &c.Webhooks.RetryInitialInterval},
+		{env: "WEBHOOK_RETRY_MAX_INTERVAL", flag: "webhook-retry-max-interval", usage: "the maximum interval between retries of a webhook delivery", value: &c.Webhooks.RetryMaxInterval},
+		{env: "EVENTS_PUBLISHER", flag: "events-publisher", usage: "the message broker the events of feedback are published to: kafka, nats or file. Empty disables publishing", value: &c.Events.Publisher},
+		{env: "EVENTS_POLL_INTERVAL", flag: "events-poll-interval", usage: "how often the outbox is checked for events to publish", value: &c.Events.PollInterval},
+		{env: "EVENTS_BATCH_SIZE", flag: "events-batch-size", usage: "how many events are published at once", value: &c.Events.BatchSize},
+		{env: "EVENTS_TIMEOUT", flag: "events-timeout", usage: "how long the message broker has to acknowledge the events", value: &c.Events.Timeout},
+		{env: "EVENTS_KAFKA_BROKERS", flag: "events-kafka-brokers", usage: "the addresses of the Kafka brokers", value: &c.Events.KafkaBrokers},
+		{env: "EVENTS_KAFKA_TOPIC", flag: "events-kafka-topic", usage: "the Kafka topic the events are published to", value: &c.Events.KafkaTopic},
+		{env: "EVENTS_NATS_URL", flag: "events-nats-url", usage: "the URL of the NATS server", value: &c.Events.NATSURL},
+		{env: "EVENTS_NATS_SUBJECT", flag: "events-nats-subject", usage: "the NATS JetStream subject the events are published to", value: &c.Events.NATSSubject},
+		{env: "EVENTS_FILE", flag: "events-file", usage: "the file the events are appended to, - for stdout", value: &c.Events.File},
+	}
+}
+
+// Load loads the configuration. Defaults are overridden by the configuration file, which are overridden by environment
+// variables, which are overridden by the flags parsed from the provided arguments.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	//
+	// Flags are bound to a scratch configuration so only the flags that were explicitly set are applied last
+	//
+	var path string
+	fs.StringVar(&path, flagConfigFile, os.Getenv(environmentConfigFile), "path to a YAML or TOML configuration file")
+	flagConfig := Default()
+	flagSettings := settings(&flagConfig)
+	for _, s := range flagSettings {
+		bindFlag(fs, s)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	//
+	// Apply each source in order of precedence
+	//
+	config := Default()
+	if len(path) > 0 {
+		if err := loadFile(path, &config); err != nil {
+			return Config{}, err
+		}
+	}
+	configSettings := settings(&config)
+	for _, s := range configSettings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := setValue(s.value, value); err != nil {
+			return Config{}, fmt.Errorf("invalid value for environment variable %s: %w", s.env, err)
+		}
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for i, s := range configSettings {
+		if set[s.flag] {
+			copyValue(s.value, flagSettings[i].value)
+		}
+	}
+	return config, nil
+}
+
+func loadFile(path string, config *Config) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file %s: %w", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, config)
+	case ".toml":
+		err = toml.Unmarshal(content, config)
+	default:
+		return fmt.Errorf("unsupported configuration file format %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+func bindFlag(fs *flag.FlagSet, s setting) {
+	switch v := s.value.(type) {
+	case *string:
+		fs.StringVar(v, s.flag, *v, s.usage)
+	case *bool:
+		fs.BoolVar(v, s.flag, *v, s.usage)
+	case *int:
+		fs.IntVar(v, s.flag, *v, s.usage)
+	case *time.Duration:
+		fs.DurationVar(v, s.flag, *v, s.usage)
+	case *[]string:
+		fs.Var((*stringsValue)(v), s.flag, s.usage+" (comma separated)")
+	default:
+		panic(fmt.Sprintf("unsupported setting type %T for flag %s", v, s.flag))
+	}
+}
+
+func setValue(target interface{}, value string) error {
+	switch v := target.(type) {
+	case *string:
+		*v = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*v = b
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*v = i
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*v = d
+	case *[]string:
+		return (*stringsValue)(v).Set(value)
+	default:
+		return fmt.Errorf("unsupported setting type %T", v)
+	}
+	return nil
+}
+
+func copyValue(dst interface{}, src interface{}) {
+	switch v := dst.(type) {
+	case *string:
+		*v = *src.(*string)
+	case *bool:
+		*v = *src.(*bool)
+	case *int:
+		*v = *src.(*int)
+	case *time.Duration:
+		*v = *src.(*time.Duration)
+	case *[]string:
+		*v = *src.(*[]string)
+	}
+}
+
+// stringsValue is a comma separated list of values.
+type stringsValue []string
+
+func (s *stringsValue) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsValue) Set(value string) error {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	*s = values
+	return nil
+}
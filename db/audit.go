@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"strings"
+	"time"
+)
+
+// AuditAction is the kind of change made to a feedback.
+type AuditAction string
+
+const (
+	// AuditCreate is a feedback that was created
+	AuditCreate AuditAction = "create"
+	// AuditUpdate is a feedback that was changed by its user or an import
+	AuditUpdate AuditAction = "update"
+	// AuditDelete is a feedback that was deleted
+	AuditDelete AuditAction = "delete"
+	// AuditModerate is a feedback whose moderation status was changed by an operator
+	AuditModerate AuditAction = "moderate"
+)
+
+const (
+	// ImportActor is the actor of the changes made by the import command.
+	ImportActor = "import"
+	// SystemActor is the actor of the changes the service makes on its own.
+	SystemActor = "system"
+)
+
+// UserActor provides the actor of the changes made by a user.
+func UserActor(userID string) string {
+	return "user:" + userID
+}
+
+// OperatorActor provides the actor of the changes made by an operator.
+func OperatorActor(name string) string {
+	return "operator:" + name
+}
+
+// AuditEntry is a change made to a feedback. Before is nil for created feedback and After is nil for deleted feedback.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	FeedbackID int32           `json:"feedbackId"`
+	Action     AuditAction     `json:"action"`
+	Actor      string          `json:"actor"`
+	Date       time.Time       `json:"date"`
+	Before     *model.Feedback `json:"before"`
+	After      *model.Feedback `json:"after"`
+}
+
+// AuditFilter filters the audit entries. Empty fields do not filter.
+type AuditFilter struct {
+	FeedbackID int32
+	Actor      string
+	Action     AuditAction
+	// From is the inclusive start of the date range.
+	From time.Time
+	// To is the exclusive end of the date range.
+	To time.Time
+	// AfterID only finds the entries after the ID, to page through the entries.
+	AfterID int64
+}
+
+// insertAudit appends the entries to the 'feedback_audit' table, and queues their webhook deliveries and events, within
+// the transaction of the changes they record.
+func (d MySQL) insertAudit(tx *sql.Tx, entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(entries))
+	args := make([]interface{}, 0, len(entries)*5)
+	for i, entry := range entries {
+		before, err := auditValue(entry.Before)
+		if err != nil {
+			return err
+		}
+		after, err := auditValue(entry.After)
+		if err != nil {
+			return err
+		}
+		placeholders[i] = "(?,?,?,?,?)"
+		args = append(args, entry.FeedbackID, entry.Action, entry.Actor, before, after)
+	}
+	_, err := tx.Exec("INSERT INTO feedback_audit(`feedbackID`, `action`, `actor`, `before`, `after`) VALUES "+
+		strings.Join(placeholders, ","), args...)
+	if err != nil {
+		return fmt.Errorf("failed to audit the change: %w", err)
+	}
+	//
+	// Every audited change is an event the webhooks and the message broker can be notified of
+	//
+	events, err := feedbackEvents(entries)
+	if err != nil {
+		return err
+	}
+	if err := enqueueWebhooks(tx, events); err != nil {
+		return err
+	}
+	if !d.PublishEvents {
+		return nil
+	}
+	return insertEvents(tx, events)
+}
+
+func auditValue(feedback *model.Feedback) (interface{}, error) {
+	if feedback == nil {
+		return nil, nil
+	}
+	value, err := json.Marshal(feedback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the audited feedback: %w", err)
+	}
+	return string(value), nil
+}
+
+// FindAudit finds the audit entries matching the filter, oldest first. Results are limited.
+func (d MySQL) FindAudit(filter AuditFilter, limit int) ([]AuditEntry, error) {
+	conditions := []string{"id>?"}
+	args := []interface{}{filter.AfterID}
+	if filter.FeedbackID > 0 {
+		conditions = append(conditions, "feedbackID=?")
+		args = append(args, filter.FeedbackID)
+	}
+	if len(filter.Actor) > 0 {
+		conditions = append(conditions, "actor=?")
+		args = append(args, filter.Actor)
+	}
+	if len(filter.Action) > 0 {
+		conditions = append(conditions, "action=?")
+		args = append(args, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "`date`>=?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "`date`<?")
+		args = append(args, filter.To)
+	}
+	query := fmt.Sprintf("SELECT `id`, `feedbackID`, `action`, `actor`, `date`, `before`, `after` FROM feedback_audit "+
+		"WHERE %s ORDER BY `id` LIMIT %d", strings.Join(conditions, " AND "), limit)
+	rows, err := d.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.FeedbackID, &entry.Action, &entry.Actor, &entry.Date, &before,
+			&after); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		if entry.Before, err = auditFeedback(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = auditFeedback(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func auditFeedback(value sql.NullString) (*model.Feedback, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	var feedback model.Feedback
+	if err := json.Unmarshal([]byte(value.String), &feedback); err != nil {
+		return nil, fmt.Errorf("failed to decode the audited feedback: %w", err)
+	}
+	return &feedback, nil
+}
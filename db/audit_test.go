@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"testing"
+	"time"
+)
+
+func TestMySQL_FindAudit(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery("SELECT `id`, `feedbackID`, `action`, `actor`, `date`, `before`, `after` FROM feedback_audit "+
+		"WHERE id>\\? AND feedbackID=\\? AND action=\\? ORDER BY `id` LIMIT 10").
+		WithArgs(3, 1, "moderate").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "feedbackID", "action", "actor", "date", "before", "after"}).
+			AddRow(4, 1, "moderate", "operator:alice", time.Now(), `{"id":1,"moderationStatus":"approved"}`,
+				`{"id":1,"moderationStatus":"hidden","moderationReason":"spam"}`).
+			AddRow(5, 1, "moderate", "system", time.Now(), `{"id":1,"moderationStatus":"hidden"}`, nil))
+	//
+	// Run the test
+	//
+	entries, findError := mySQL.FindAudit(db.AuditFilter{FeedbackID: 1, Action: db.AuditModerate, AfterID: 3}, 10)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if findError != nil {
+		t.Errorf("unexpected error occurred: %v", findError)
+	} else if len(entries) != 2 || entries[0].Actor != "operator:alice" ||
+		entries[0].After.ModerationStatus != model.ModerationHidden || entries[1].After != nil {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	mock.ExpectClose()
+}
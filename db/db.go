@@ -1,8 +1,19 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"github.com/Piszmog/feedback-service/model"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested feedback does not exist.
+	ErrNotFound = errors.New("feedback not found")
+	// ErrDuplicate is returned when the user has already provided feedback for the session.
+	ErrDuplicate = errors.New("feedback already exists")
+	// ErrVersionMismatch is returned when feedback changed since the version a change was based on.
+	ErrVersionMismatch = errors.New("feedback version does not match")
 )
 
 // DB is an interface for abstracting the interact with a database.
@@ -10,19 +21,116 @@ type DB interface {
 	// Exists check whether the user has provided feedback for the specified session.
 	Exists(userID string, sessionID string) (bool, error)
 
-	// Insert inserts a feedback.
-	Insert(feedback model.Feedback) error
+	// Insert inserts a feedback. Every change made to feedback is audited. The feedback is returned as stored, with its ID.
+	// ErrDuplicate is returned if the user has already provided feedback for the session.
+	Insert(feedback model.Feedback) (model.Feedback, error)
+
+	// InsertBatch inserts the feedback in a single transaction. Feedback a user has already provided for a session is
+	// skipped. The inserted feedback is returned in the order provided, the zero value for the skipped feedback.
+	InsertBatch(feedback []model.Feedback) ([]model.Feedback, error)
+
+	// FindByID finds a single feedback of a session. ErrNotFound is returned if there is none.
+	FindByID(sessionID string, id int32) (model.Feedback, error)
+
+	// Update replaces the comment and rating of a feedback if it is still at the provided version. The feedback is
+	// returned with its new version. ErrNotFound or ErrVersionMismatch is returned if it cannot be updated.
+	Update(feedback model.Feedback, version int32) (model.Feedback, error)
+
+	// Delete deletes a feedback if it is still at the provided version. ErrNotFound or ErrVersionMismatch is returned
+	// if it cannot be deleted.
+	Delete(sessionID string, id int32, version int32) error
+
+	// FindByModerationStatus finds the feedback with the moderation status, oldest first. Limit specifies how many are
+	// returned.
+	FindByModerationStatus(status model.ModerationStatus, limit int) ([]model.Feedback, error)
+
+	// SetModerationStatus sets the moderation status of a feedback along with the reason for it, as decided by the
+	// actor. The feedback is returned as it was before and after. ErrNotFound is returned if there is none.
+	SetModerationStatus(id int32, status model.ModerationStatus, reason string, actor string) (ModerationChange, error)
 
-	// Find finds feedback for a session. Limit specifies how many of the most recent feedback are returned.
+	// Report records a user reporting a feedback. The feedback is hidden once the threshold of reports is reached.
+	// ErrNotFound or ErrDuplicateReport is returned if it cannot be reported.
+	Report(report model.Report, threshold int) (ReportResult, error)
+
+	// ReportCounts counts the reports of each of the feedback.
+	ReportCounts(ids []int32) (map[int32]ReportCount, error)
+
+	// FindReported finds the approved feedback that has been reported, most reported first. Limit specifies how many
+	// are returned.
+	FindReported(limit int) ([]model.Feedback, error)
+
+	// FindAudit finds the audit entries of the changes made to feedback, oldest first. Limit specifies how many are
+	// returned.
+	FindAudit(filter AuditFilter, limit int) ([]AuditEntry, error)
+
+	// Summarize summarizes the approved feedback of a session.
+	Summarize(sessionID string) (Summary, error)
+
+	// SummarizeSessions summarizes the approved feedback of each of the sessions at once. Sessions without approved
+	// feedback have an empty summary.
+	SummarizeSessions(sessionIDs []string) (map[string]Summary, error)
+
+	// FindPages finds a page of the approved feedback of each of the sessions at once, most recent date first.
+	// The pages are returned in the order they were requested.
+	FindPages(pages []Page) ([][]model.Feedback, error)
+
+	// Find finds approved feedback for a session. Limit specifies how many of the most recent feedback are returned.
 	Find(sessionID string, sort Sort, limit int) ([]model.Feedback, error)
 
-	// Find finds feedback for a session and with the provided filter. Limit specifies how many of the most recent feedback are returned.
+	// Find finds approved feedback for a session and with the provided filter. Limit specifies how many of the most recent feedback are returned.
 	FindWithFilter(sessionID string, filter Filter, sort Sort, limit int) ([]model.Feedback, error)
 
+	// Export calls the provided function with each feedback matching the filter, oldest first. The feedback is read as
+	// it is streamed from the DB so that exports of any size do not have to fit in memory.
+	Export(ctx context.Context, filter ExportFilter, fn func(feedback model.Feedback) error) error
+
 	// Close closes the DB connection.
 	Close()
 }
 
+// ExportFilter filters the feedback that is exported. Empty fields do not filter.
+type ExportFilter struct {
+	SessionID        string
+	ModerationStatus model.ModerationStatus
+	// From is the inclusive start of the date range.
+	From time.Time
+	// To is the exclusive end of the date range.
+	To time.Time
+}
+
+// ModerationChange is a feedback before and after its moderation status was set.
+type ModerationChange struct {
+	Before model.Feedback
+	After  model.Feedback
+}
+
+// Summary is the count and sum of the ratings of the approved feedback of a session.
+type Summary struct {
+	Count     int64
+	RatingSum int64
+	// LastID is the ID of the most recent feedback summarized, 0 when there is none.
+	LastID int32
+}
+
+// Average is the average rating of the feedback, 0 when there is none.
+func (s Summary) Average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.RatingSum) / float64(s.Count)
+}
+
+// Page is a page of the approved feedback of a session, most recent date first.
+type Page struct {
+	SessionID string
+	Filter    Filter
+	// BeforeDate and BeforeID start the page after the feedback with the date and ID, the most recent feedback when
+	// the ID is 0.
+	BeforeDate time.Time
+	BeforeID   int32
+	Limit      int
+}
+
 // Filter is an additional filter that can be applied when querying for feedback.
 type Filter struct {
 	Rating string
@@ -38,28 +146,14 @@ const (
 	Descending Sort = "DESC"
 )
 
-// Options are the connection options used to connect to a DB.
-type Options struct {
-	Username     string
-	Password     string
-	Host         string
-	Port         string
-	DatabaseName string
-	ParseTime    bool
-}
+// ImportStatus is the outcome of writing a single imported feedback.
+type ImportStatus string
 
-// Validate validates the provided options.
-func (o Options) Validate() error {
-	if len(o.Username) == 0 {
-		return errors.New("require username to connect to the DB")
-	} else if len(o.Password) == 0 {
-		return errors.New("require password to connect to the DB")
-	} else if len(o.Host) == 0 {
-		return errors.New("require host to connect to the DB")
-	} else if len(o.Port) == 0 {
-		return errors.New("require port to connect to the DB")
-	} else if len(o.DatabaseName) == 0 {
-		return errors.New("require database name to connect to the DB")
-	}
-	return nil
-}
+const (
+	// ImportInserted is a feedback that did not exist and was inserted
+	ImportInserted ImportStatus = "inserted"
+	// ImportUpdated is a feedback that already existed and was replaced
+	ImportUpdated ImportStatus = "updated"
+	// ImportSkipped is a feedback that already existed and was left as is
+	ImportSkipped ImportStatus = "skipped"
+)
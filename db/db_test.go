@@ -3,6 +3,7 @@ package db_test
 import (
 	"github.com/Piszmog/feedback-service/db"
 	"testing"
+	"time"
 )
 
 var optionsTable = []struct {
@@ -70,6 +71,53 @@ var optionsTable = []struct {
 			ParseTime: false,
 		},
 	},
+	{
+		pass: true,
+		options: db.Options{
+			DSN: "user:pass@tcp(localhost:3306)/test?parseTime=true",
+		},
+	},
+	{
+		pass: false,
+		options: db.Options{
+			DSN: "user:pass@localhost:3306",
+		},
+	},
+	{
+		pass: false,
+		options: db.Options{
+			Username:     "user",
+			Password:     "pass",
+			Host:         "localhost",
+			Port:         "8080",
+			DatabaseName: "test",
+			MaxOpenConns: 5,
+			MaxIdleConns: 10,
+		},
+	},
+	{
+		pass: false,
+		options: db.Options{
+			Username:     "user",
+			Password:     "pass",
+			Host:         "localhost",
+			Port:         "8080",
+			DatabaseName: "test",
+			TLSMode:      "maybe",
+		},
+	},
+	{
+		pass: false,
+		options: db.Options{
+			Username:     "user",
+			Password:     "pass",
+			Host:         "localhost",
+			Port:         "8080",
+			DatabaseName: "test",
+			TLSMode:      db.TLSVerify,
+			TLSCertFile:  "client.pem",
+		},
+	},
 }
 
 func TestOptions_Validate(t *testing.T) {
@@ -82,3 +130,54 @@ func TestOptions_Validate(t *testing.T) {
 		}
 	}
 }
+
+func TestOptions_DataSourceName(t *testing.T) {
+	options := db.Options{
+		Username:     "user",
+		Password:     "pass",
+		Host:         "localhost",
+		Port:         "3306",
+		DatabaseName: "test",
+		ParseTime:    true,
+		DialTimeout:  5 * time.Second,
+		TLSMode:      db.TLSSkipVerify,
+		Charset:      "utf8mb4",
+		Collation:    "utf8mb4_unicode_ci",
+	}
+	dsn, err := options.DataSourceName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "user:pass@tcp(localhost:3306)/test?collation=utf8mb4_unicode_ci&parseTime=true&timeout=5s&tls=skip-verify&charset=utf8mb4"
+	if dsn != expected {
+		t.Errorf("unexpected DSN: got %s want %s", dsn, expected)
+	}
+}
+
+func TestOptions_DataSourceName_Passthrough(t *testing.T) {
+	options := db.Options{DSN: "user:pass@unix(/tmp/mysql.sock)/test", Host: "ignored"}
+	dsn, err := options.DataSourceName()
+	if err != nil {
+		t.Fatal(err)
+	} else if dsn != options.DSN {
+		t.Errorf("expected DSN to be passed through: got %s", dsn)
+	}
+}
+
+func TestNewMySQL(t *testing.T) {
+	mySQL, err := db.NewMySQL(db.Options{
+		Username:     "user",
+		Password:     "pass",
+		Host:         "localhost",
+		Port:         "3306",
+		DatabaseName: "test",
+		MaxOpenConns: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mySQL.Close()
+	if stats := mySQL.DB.Stats(); stats.MaxOpenConnections != 10 {
+		t.Errorf("expected max open connections to be 10 but got %d", stats.MaxOpenConnections)
+	}
+}
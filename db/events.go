@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"log"
+	"strings"
+	"time"
+)
+
+// eventsLock is the name of the MySQL lock held by the relay publishing the events.
+const eventsLock = "feedback-service.feedback_events"
+
+// Event is a change made to a feedback queued in the outbox to be published to a message broker. The payload is the
+// same as the payload delivered to webhooks.
+type Event struct {
+	ID        int64              `json:"id"`
+	SessionID string             `json:"sessionId"`
+	Event     model.WebhookEvent `json:"event"`
+	Payload   json.RawMessage    `json:"payload"`
+	Date      time.Time          `json:"date"`
+}
+
+// EventStore is the outbox of the events published to a message broker. Events are written in the transaction of the
+// change to feedback they notify of. The MySQL DB is an EventStore.
+type EventStore interface {
+	// LockEvents acquires the lock of the outbox so only a single relay publishes the events, keeping them in order.
+	// False is returned if another relay holds the lock. The lock is held until unlock is called.
+	LockEvents(ctx context.Context) (unlock func(), locked bool, err error)
+
+	// FindEvents finds the events that have not been published, oldest first. Limit specifies how many are returned.
+	FindEvents(limit int) ([]Event, error)
+
+	// DeleteEvents deletes the published events from the outbox.
+	DeleteEvents(ids []int64) error
+}
+
+// feedbackEvent is an audited change as it is delivered to webhooks and published to the message broker.
+type feedbackEvent struct {
+	event     model.WebhookEvent
+	sessionID string
+	rating    int8
+	payload   string
+}
+
+// auditEvents are the events of each audited action.
+var auditEvents = map[AuditAction]model.WebhookEvent{
+	AuditCreate:   model.EventCreated,
+	AuditUpdate:   model.EventUpdated,
+	AuditDelete:   model.EventDeleted,
+	AuditModerate: model.EventModerated,
+}
+
+// feedbackEvents provides the events of the audited changes.
+func feedbackEvents(entries []AuditEntry) ([]feedbackEvent, error) {
+	now := time.Now().UTC()
+	events := make([]feedbackEvent, len(entries))
+	for i, entry := range entries {
+		payload := WebhookPayload{Event: auditEvents[entry.Action], Date: now, Feedback: entry.After,
+			Previous: entry.Before}
+		if entry.After == nil {
+			payload.Feedback = entry.Before
+			payload.Previous = nil
+		}
+		if payload.Feedback == nil {
+			return nil, fmt.Errorf("failed to create the event of feedback %d: no feedback", entry.FeedbackID)
+		}
+		value, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the event payload: %w", err)
+		}
+		events[i] = feedbackEvent{event: payload.Event, sessionID: payload.Feedback.SessionID,
+			rating: payload.Feedback.Rating, payload: string(value)}
+	}
+	return events, nil
+}
+
+// insertEvents writes the events to the 'feedback_events' outbox within the transaction of the changes.
+func insertEvents(tx *sql.Tx, events []feedbackEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*3)
+	for i, event := range events {
+		placeholders[i] = "(?,?,?)"
+		args = append(args, event.sessionID, event.event, event.payload)
+	}
+	_, err := tx.Exec("INSERT INTO feedback_events(`sessionID`, `event`, `payload`) VALUES "+
+		strings.Join(placeholders, ","), args...)
+	if err != nil {
+		return fmt.Errorf("failed to write the events: %w", err)
+	}
+	return nil
+}
+
+// LockEvents acquires a MySQL named lock on a dedicated connection. The lock is released if the connection is lost, so
+// another relay can take over.
+func (d MySQL) LockEvents(ctx context.Context) (func(), bool, error) {
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open a connection: %w", err)
+	}
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", eventsLock).Scan(&locked); err != nil {
+		closeConn(conn)
+		return nil, false, fmt.Errorf("failed to lock the events: %w", err)
+	} else if locked.Int64 != 1 {
+		closeConn(conn)
+		return nil, false, nil
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", eventsLock); err != nil {
+			log.Println(fmt.Errorf("failed to unlock the events: %w", err))
+		}
+		closeConn(conn)
+	}, true, nil
+}
+
+// FindEvents finds the events in the order they were written.
+func (d MySQL) FindEvents(limit int) ([]Event, error) {
+	rows, err := d.DB.Query(fmt.Sprintf("SELECT `id`, `sessionID`, `event`, `payload`, `date` FROM feedback_events "+
+		"ORDER BY `id` LIMIT %d", limit))
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var payload string
+		if err := rows.Scan(&event.ID, &event.SessionID, &event.Event, &payload, &event.Date); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteEvents deletes the events with the IDs.
+func (d MySQL) DeleteEvents(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	if _, err := d.DB.Exec("DELETE FROM feedback_events WHERE id IN ("+strings.Join(placeholders, ",")+")",
+		args...); err != nil {
+		return fmt.Errorf("failed to delete the published events: %w", err)
+	}
+	return nil
+}
+
+func closeConn(conn *sql.Conn) {
+	if err := conn.Close(); err != nil {
+		log.Println(fmt.Errorf("failed to close the connection: %w", err))
+	}
+}
@@ -0,0 +1,128 @@
+package db_test
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Piszmog/feedback-service/model"
+	"testing"
+	"time"
+)
+
+func TestMySQL_Insert_PublishEvents(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	mySQL.PublishEvents = true
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}, "approved", "").
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO feedback_events\\(`sessionID`, `event`, `payload`\\) VALUES \\(\\?,\\?,\\?\\)$").
+		WithArgs("987", "feedback.created", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	_, insertError := mySQL.Insert(model.Feedback{UserID: "123", SessionID: "987", Comment: "A Test", Rating: 5,
+		Date: time.Now()})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if insertError != nil {
+		t.Errorf("unexpected error occurred: %v", insertError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_LockEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		lock     interface{}
+		expected bool
+	}{
+		{name: "Locked", lock: 1, expected: true},
+		{name: "Held By Another Relay", lock: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//
+			// Mock the SQL DB
+			//
+			mySQL, mock := createMockDB(t)
+			defer mySQL.Close()
+			//
+			// Setup Mocks
+			//
+			mock.ExpectQuery("SELECT GET_LOCK\\(\\?, 0\\)").
+				WithArgs("feedback-service.feedback_events").
+				WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(test.lock))
+			if test.expected {
+				mock.ExpectExec("DO RELEASE_LOCK\\(\\?\\)").
+					WithArgs("feedback-service.feedback_events").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			//
+			// Run the test
+			//
+			unlock, locked, lockError := mySQL.LockEvents(context.Background())
+			if locked {
+				unlock()
+			}
+			//
+			// Ensure expectations were met
+			//
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations %v", err)
+			} else if lockError != nil {
+				t.Errorf("unexpected error occurred: %v", lockError)
+			} else if locked != test.expected {
+				t.Errorf("expected locked to be %v but got %v", test.expected, locked)
+			}
+			mock.ExpectClose()
+		})
+	}
+}
+
+func TestMySQL_FindEvents(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery("SELECT `id`, `sessionID`, `event`, `payload`, `date` FROM feedback_events ORDER BY `id` " +
+		"LIMIT 10").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sessionID", "event", "payload", "date"}).
+			AddRow(3, "987", "feedback.created", `{"event":"feedback.created"}`, time.Now()).
+			AddRow(4, "987", "feedback.updated", `{"event":"feedback.updated"}`, time.Now()))
+	mock.ExpectExec("DELETE FROM feedback_events WHERE id IN \\(\\?,\\?\\)").
+		WithArgs(3, 4).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	//
+	// Run the test
+	//
+	events, findError := mySQL.FindEvents(10)
+	deleteError := mySQL.DeleteEvents([]int64{3, 4})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if findError != nil || deleteError != nil {
+		t.Errorf("unexpected error occurred: %v %v", findError, deleteError)
+	} else if len(events) != 2 || events[1].Event != model.EventUpdated ||
+		string(events[1].Payload) != `{"event":"feedback.updated"}` {
+		t.Errorf("unexpected events %+v", events)
+	}
+	mock.ExpectClose()
+}
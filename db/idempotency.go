@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net/http"
+	"time"
+)
+
+// errDuplicateEntry is the MySQL error number of a duplicate key.
+const errDuplicateEntry = 1062
+
+// IdempotencyRecord is a request made with an idempotency key and, once completed, its response.
+type IdempotencyRecord struct {
+	UserID string
+	Key    string
+	// RequestHash identifies the request so a reused key with a different request can be detected.
+	RequestHash string
+	// StatusCode is 0 while the request is still being processed.
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// LockedUntil is when the reservation of a request still being processed lapses, so the key can be used again if
+	// the response is never recorded.
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+// Completed checks whether the response of the request has been recorded.
+func (r IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// IdempotencyStore records the responses of requests made with idempotency keys. The MySQL DB is an IdempotencyStore.
+type IdempotencyStore interface {
+	// Reserve records that the request is being processed. If the key is already recorded, has not expired and is
+	// either completed or still locked, the existing record is returned and the request is not reserved.
+	Reserve(record IdempotencyRecord) (existing IdempotencyRecord, reserved bool, err error)
+
+	// Complete records the response of a reserved request.
+	Complete(record IdempotencyRecord) error
+
+	// Release removes a reserved request so the key can be retried.
+	Release(userID string, key string) error
+}
+
+// Reserve records that the request is being processed, unless a request with the same key is already recorded.
+func (d MySQL) Reserve(record IdempotencyRecord) (IdempotencyRecord, bool, error) {
+	//
+	// An expired key can be reused, as can a key whose request was never completed once its lock lapsed
+	//
+	now := time.Now().UTC()
+	_, err := d.DB.Exec("DELETE FROM idempotency_keys WHERE userID=? AND `key`=? AND (expiresAt<=? OR "+
+		"(statusCode=0 AND (lockedUntil IS NULL OR lockedUntil<=?)))", record.UserID, record.Key, now, now)
+	if err != nil {
+		return IdempotencyRecord{}, false, fmt.Errorf("failed to remove expired idempotency key: %w", err)
+	}
+	_, err = d.DB.Exec("INSERT INTO idempotency_keys(`userID`, `key`, `requestHash`, `lockedUntil`, `expiresAt`) "+
+		"VALUES (?,?,?,?,?)", record.UserID, record.Key, record.RequestHash, record.LockedUntil.UTC(),
+		record.ExpiresAt.UTC())
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		existing, err := d.findIdempotencyRecord(record.UserID, record.Key)
+		return existing, false, err
+	} else if err != nil {
+		return IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return record, true, nil
+}
+
+func (d MySQL) findIdempotencyRecord(userID string, key string) (IdempotencyRecord, error) {
+	row := d.DB.QueryRow("SELECT requestHash, statusCode, header, body, expiresAt FROM idempotency_keys "+
+		"WHERE userID=? AND `key`=?", userID, key)
+	record := IdempotencyRecord{UserID: userID, Key: key}
+	var header sql.NullString
+	if err := row.Scan(&record.RequestHash, &record.StatusCode, &header, &record.Body, &record.ExpiresAt); err != nil {
+		return IdempotencyRecord{}, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	if header.Valid {
+		if err := json.Unmarshal([]byte(header.String), &record.Header); err != nil {
+			return IdempotencyRecord{}, fmt.Errorf("failed to read idempotency key response header: %w", err)
+		}
+	}
+	return record, nil
+}
+
+// Complete records the response of a reserved request.
+func (d MySQL) Complete(record IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency key response header: %w", err)
+	}
+	_, err = d.DB.Exec("UPDATE idempotency_keys SET statusCode=?, header=?, body=? WHERE userID=? AND `key`=?",
+		record.StatusCode, string(header), record.Body, record.UserID, record.Key)
+	if err != nil {
+		return fmt.Errorf("failed to record idempotency key response: %w", err)
+	}
+	return nil
+}
+
+// Release removes a reserved request so the key can be retried.
+func (d MySQL) Release(userID string, key string) error {
+	if _, err := d.DB.Exec("DELETE FROM idempotency_keys WHERE userID=? AND `key`=?", userID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the idempotency keys that expired before the provided time. The number of keys
+// deleted is returned.
+func (d MySQL) DeleteExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	result, err := d.DB.Exec("DELETE FROM idempotency_keys WHERE expiresAt<=?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,78 @@
+package db_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+	"time"
+)
+
+func TestMySQL_Reserve(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE userID=\\? AND `key`=\\? AND \\(expiresAt<=\\? OR "+
+		"\\(statusCode=0 AND \\(lockedUntil IS NULL OR lockedUntil<=\\?\\)\\)\\)").
+		WithArgs("123", "abc", anyTime{}, anyTime{}).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO idempotency_keys*").WithArgs("123", "abc", "hash", anyTime{}, anyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	//
+	// Run the test
+	//
+	_, reserved, reserveError := mySQL.Reserve(db.IdempotencyRecord{UserID: "123", Key: "abc", RequestHash: "hash",
+		LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour)})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if reserveError != nil {
+		t.Errorf("unexpected error occurred: %v", reserveError)
+	} else if !reserved {
+		t.Error("expected the key to be reserved")
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Reserve_Existing(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("DELETE FROM idempotency_keys*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO idempotency_keys*").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectQuery("SELECT requestHash, statusCode, header, body, expiresAt FROM idempotency_keys*").
+		WithArgs("123", "abc").
+		WillReturnRows(sqlmock.NewRows([]string{"requestHash", "statusCode", "header", "body", "expiresAt"}).
+			AddRow("hash", 201, `{"Location":["/v1/sessions/987/feedback/1"]}`, []byte(`{"id":1}`), time.Now()))
+	//
+	// Run the test
+	//
+	existing, reserved, reserveError := mySQL.Reserve(db.IdempotencyRecord{UserID: "123", Key: "abc",
+		RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if reserveError != nil {
+		t.Errorf("unexpected error occurred: %v", reserveError)
+	} else if reserved {
+		t.Error("expected the key to already be reserved")
+	} else if !existing.Completed() || existing.Header.Get("Location") != "/v1/sessions/987/feedback/1" ||
+		string(existing.Body) != `{"id":1}` {
+		t.Errorf("unexpected existing record %+v", existing)
+	}
+	mock.ExpectClose()
+}
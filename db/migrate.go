@@ -0,0 +1,275 @@
+package db
+
+import (
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"log"
+	"strings"
+)
+
+// migration is a change to the schema. Migrations are applied in order and each is only applied once.
+type migration struct {
+	version     int
+	description string
+	// apply changes the data before the statements are applied, for changes that must be audited. Nil when there are
+	// none.
+	apply      func(d MySQL) error
+	statements []string
+}
+
+// migrations evolve the 'feedback' table created by CreateFeedbackTableIfNotExists. New migrations are only ever
+// appended.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "store feedback dates with microsecond precision",
+		statements: []string{
+			"ALTER TABLE `feedback` MODIFY `date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)",
+		},
+	},
+	{
+		version:     2,
+		description: "record the responses of requests made with idempotency keys",
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS `idempotency_keys`(" +
+				"`userID` VARCHAR(255) NOT NULL, " +
+				"`key` VARCHAR(255) NOT NULL, " +
+				"`requestHash` CHAR(64) NOT NULL, " +
+				"`statusCode` SMALLINT NOT NULL DEFAULT 0, " +
+				"`header` TEXT, " +
+				"`body` MEDIUMBLOB, " +
+				"`expiresAt` TIMESTAMP(6) NOT NULL, " +
+				"PRIMARY KEY (`userID`, `key`), " +
+				"INDEX(`expiresAt`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin",
+		},
+	},
+	{
+		version:     3,
+		description: "version feedback for optimistic concurrency",
+		statements: []string{
+			"ALTER TABLE `feedback` ADD COLUMN `version` INT UNSIGNED NOT NULL DEFAULT 1",
+		},
+	},
+	{
+		version:     4,
+		description: "moderate feedback comments",
+		statements: []string{
+			"ALTER TABLE `feedback` ADD COLUMN `moderationStatus` VARCHAR(16) NOT NULL DEFAULT 'approved', " +
+				"ADD COLUMN `moderationReason` VARCHAR(255) NOT NULL DEFAULT '', " +
+				"ADD INDEX(`moderationStatus`, `date`)",
+		},
+	},
+	{
+		version:     5,
+		description: "audit the changes made to feedback",
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS `feedback_audit`(" +
+				"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+				"`feedbackID` INT UNSIGNED NOT NULL, " +
+				"`action` VARCHAR(16) NOT NULL, " +
+				"`actor` VARCHAR(255) NOT NULL, " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"`before` JSON, " +
+				"`after` JSON, " +
+				"PRIMARY KEY (`id`), " +
+				"INDEX(`feedbackID`), " +
+				"INDEX(`actor`), " +
+				"INDEX(`date`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+		},
+	},
+	{
+		version:     6,
+		description: "record the reports of abusive feedback",
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS `feedback_reports`(" +
+				"`feedbackID` INT UNSIGNED NOT NULL, " +
+				"`reporterID` VARCHAR(255) NOT NULL, " +
+				"`reason` VARCHAR(16) NOT NULL, " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"PRIMARY KEY (`feedbackID`, `reporterID`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+		},
+	},
+	{
+		version:     7,
+		description: "deliver feedback events to webhooks from an outbox",
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS `webhooks`(" +
+				"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+				"`url` VARCHAR(2048) NOT NULL, " +
+				"`events` VARCHAR(255) NOT NULL, " +
+				"`minRating` TINYINT NOT NULL, " +
+				"`maxRating` TINYINT NOT NULL, " +
+				"`secret` VARCHAR(255) NOT NULL, " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"PRIMARY KEY (`id`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+			"CREATE TABLE IF NOT EXISTS `webhook_deliveries`(" +
+				"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+				"`webhookID` BIGINT UNSIGNED NOT NULL, " +
+				"`event` VARCHAR(32) NOT NULL, " +
+				"`payload` MEDIUMTEXT NOT NULL, " +
+				"`status` VARCHAR(16) NOT NULL DEFAULT 'pending', " +
+				"`attempts` INT UNSIGNED NOT NULL DEFAULT 0, " +
+				"`nextAttempt` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"`lastError` VARCHAR(1024) NOT NULL DEFAULT '', " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"PRIMARY KEY (`id`), " +
+				"INDEX(`status`, `nextAttempt`), " +
+				"INDEX(`webhookID`, `status`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+			"CREATE TABLE IF NOT EXISTS `webhook_attempts`(" +
+				"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+				"`deliveryID` BIGINT UNSIGNED NOT NULL, " +
+				"`webhookID` BIGINT UNSIGNED NOT NULL, " +
+				"`attempt` INT UNSIGNED NOT NULL, " +
+				"`statusCode` SMALLINT NOT NULL DEFAULT 0, " +
+				"`error` VARCHAR(1024) NOT NULL DEFAULT '', " +
+				"`durationMs` INT UNSIGNED NOT NULL, " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"PRIMARY KEY (`id`), " +
+				"INDEX(`webhookID`), " +
+				"INDEX(`deliveryID`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+		},
+	},
+	{
+		version:     8,
+		description: "publish feedback events to a message broker from an outbox",
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS `feedback_events`(" +
+				"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, " +
+				"`sessionID` VARCHAR(255) NOT NULL, " +
+				"`event` VARCHAR(32) NOT NULL, " +
+				"`payload` MEDIUMTEXT NOT NULL, " +
+				"`date` TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6), " +
+				"PRIMARY KEY (`id`)) " +
+				"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci",
+		},
+	},
+	{
+		version:     9,
+		description: "allow a single feedback per user for a session",
+		apply:       MySQL.deleteDuplicateFeedback,
+		statements: []string{
+			"ALTER TABLE `feedback` DROP INDEX `userID`, ADD UNIQUE INDEX `userID`(`userID`, `sessionID`)",
+		},
+	},
+	{
+		version:     10,
+		description: "scope idempotency keys to the user or operator making the request",
+		statements: []string{
+			"ALTER TABLE `idempotency_keys` MODIFY `userID` VARCHAR(320) NOT NULL",
+			"UPDATE `idempotency_keys` SET `userID`=CONCAT('user:', `userID`) WHERE `userID` NOT LIKE 'user:%'",
+		},
+	},
+	{
+		version:     11,
+		description: "lock idempotency keys while their request is processed",
+		statements: []string{
+			"ALTER TABLE `idempotency_keys` ADD COLUMN `lockedUntil` TIMESTAMP(6) NULL AFTER `body`",
+		},
+	},
+}
+
+// Migrate applies the migrations that have not been applied yet. The applied versions are recorded in the
+// 'schema_migrations' table.
+func (d MySQL) Migrate() error {
+	_, err := d.DB.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations`(" +
+		"`version` INT UNSIGNED NOT NULL, " +
+		"`description` VARCHAR(255) NOT NULL, " +
+		"`appliedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, " +
+		"PRIMARY KEY (`version`))")
+	if err != nil {
+		return fmt.Errorf("failed to create table 'schema_migrations': %w", err)
+	}
+	var current int
+	if err := d.DB.QueryRow("SELECT COALESCE(MAX(`version`), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		//
+		// MySQL commits DDL implicitly, so each statement is applied on its own before the version is recorded
+		//
+		if m.apply != nil {
+			if err := m.apply(d); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+			}
+		}
+		for _, statement := range m.statements {
+			if _, err := d.DB.Exec(statement); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+			}
+		}
+		if _, err := d.DB.Exec("INSERT INTO schema_migrations(`version`, `description`) VALUES (?,?)", m.version,
+			m.description); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		log.Printf("Applied migration %d: %s\n", m.version, m.description)
+	}
+	return nil
+}
+
+// deleteDuplicateFeedback deletes all but the first feedback of a user for a session, which could slip in before the
+// unique index existed. Each deletion is audited, so webhooks and the message broker are notified of it, and logged.
+func (d MySQL) deleteDuplicateFeedback() error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	rows, err := tx.Query("SELECT " + feedbackColumns + " FROM feedback WHERE id IN (" +
+		"SELECT newer.`id` FROM `feedback` newer JOIN `feedback` older ON newer.`userID`=older.`userID` " +
+		"AND newer.`sessionID`=older.`sessionID` AND newer.`id`>older.`id`) FOR UPDATE")
+	if err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to find duplicate feedback: %w", err)
+	}
+	var duplicates []model.Feedback
+	for rows.Next() {
+		row, err := scanFeedback(rows)
+		if err != nil {
+			closeRows(rows)
+			rollback(tx)
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+		duplicates = append(duplicates, row)
+	}
+	closeRows(rows)
+	if err := rows.Err(); err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to find duplicate feedback: %w", err)
+	}
+	if len(duplicates) == 0 {
+		return tx.Commit()
+	}
+	placeholders := make([]string, len(duplicates))
+	args := make([]interface{}, len(duplicates))
+	ids := make([]string, len(duplicates))
+	entries := make([]AuditEntry, len(duplicates))
+	for i := range duplicates {
+		placeholders[i] = "?"
+		args[i] = duplicates[i].ID
+		ids[i] = fmt.Sprint(duplicates[i].ID)
+		entries[i] = AuditEntry{FeedbackID: duplicates[i].ID, Action: AuditDelete, Actor: SystemActor,
+			Before: &duplicates[i]}
+	}
+	_, err = tx.Exec("DELETE FROM feedback WHERE id IN ("+strings.Join(placeholders, ",")+")", args...)
+	if err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to delete duplicate feedback: %w", err)
+	}
+	if err := d.insertAudit(tx, entries...); err != nil {
+		rollback(tx)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("Deleted %d duplicate feedback: %s\n", len(duplicates), strings.Join(ids, ", "))
+	return nil
+}
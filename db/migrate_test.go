@@ -0,0 +1,137 @@
+package db_test
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestMySQL_Migrate(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_migrations`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(`version`\\), 0\\) FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	mock.ExpectExec("ALTER TABLE `feedback` MODIFY `date` TIMESTAMP\\(6\\)*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `idempotency_keys`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE `feedback` ADD COLUMN `version`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE `feedback` ADD COLUMN `moderationStatus`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(4, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `feedback_audit`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `feedback_reports`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(6, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `webhooks`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `webhook_deliveries`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `webhook_attempts`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(7, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `feedback_events`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(8, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM feedback WHERE id IN \\(SELECT newer.`id` FROM `feedback` newer JOIN*").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(8, "123", "1", "Again", 3, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("DELETE FROM feedback WHERE id IN \\(\\?\\)").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").WithArgs(8, "delete", "system", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec("ALTER TABLE `feedback` DROP INDEX `userID`, ADD UNIQUE INDEX*").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(9, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE `idempotency_keys` MODIFY `userID`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE `idempotency_keys` SET `userID`=CONCAT\\('user:', `userID`\\) WHERE `userID` NOT LIKE*").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(10, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE `idempotency_keys` ADD COLUMN `lockedUntil`*").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations*").WithArgs(11, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	//
+	// Run the test
+	//
+	migrateError := mySQL.Migrate()
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if migrateError != nil {
+		t.Errorf("unexpected error occurred: %v", migrateError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Migrate_UpToDate(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_migrations`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(`version`\\), 0\\) FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1 << 20))
+	//
+	// Run the test
+	//
+	migrateError := mySQL.Migrate()
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if migrateError != nil {
+		t.Errorf("unexpected error occurred: %v", migrateError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Migrate_WithError(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_migrations`*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(`version`\\), 0\\) FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	mock.ExpectExec("ALTER TABLE `feedback`*").WillReturnError(errors.New("failed"))
+	//
+	// Run the test
+	//
+	migrateError := mySQL.Migrate()
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if migrateError == nil {
+		t.Error("expected error to occurred")
+	}
+	mock.ExpectClose()
+}
@@ -1,17 +1,48 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/Piszmog/feedback-service/model"
+	"github.com/go-sql-driver/mysql"
 	"log"
-	"time"
+	"strings"
 )
 
+// batchAttempts is how many times a batch is written when feedback is inserted concurrently.
+const batchAttempts = 3
+
+// feedbackColumns are the columns of the 'feedback' table, in the order they are scanned.
+const feedbackColumns = "`id`, `userID`, `sessionID`, `comment`, `rating`, `date`, `version`, `moderationStatus`, " +
+	"`moderationReason`"
+
 // MySQL is a wrapper around interacting with a MySQL DB.
 type MySQL struct {
 	DB *sql.DB
+	// PublishEvents writes every change made to feedback to the 'feedback_events' outbox, to be published by a relay.
+	PublishEvents bool
+}
+
+// NewMySQL opens a pool of connections to the MySQL DB with the provided options. The DB is not contacted until it is
+// first used.
+func NewMySQL(options Options) (*MySQL, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	dsn, err := options.DataSourceName()
+	if err != nil {
+		return nil, err
+	}
+	dbConnection, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the MySQL DB: %w", err)
+	}
+	dbConnection.SetMaxOpenConns(options.MaxOpenConns)
+	dbConnection.SetMaxIdleConns(options.MaxIdleConns)
+	dbConnection.SetConnMaxLifetime(options.ConnMaxLifetime)
+	return &MySQL{DB: dbConnection}, nil
 }
 
 // CreateFeedbackTableIfNotExists creates the 'feedback' table if it does not exist.
@@ -25,7 +56,8 @@ func (d MySQL) CreateFeedbackTableIfNotExists() error {
 		"`date` TIMESTAMP NOT NULL, " +
 		"PRIMARY KEY (`id`), " +
 		"INDEX(`userID`, `sessionID`), " +
-		"INDEX(`sessionID`, `date` DESC))")
+		"INDEX(`sessionID`, `date` DESC)) " +
+		"DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci")
 	if err != nil {
 		return fmt.Errorf("failed to create table 'feedback': %w", err)
 	}
@@ -45,26 +77,533 @@ func (d MySQL) Exists(userID string, sessionID string) (bool, error) {
 	return exists, nil
 }
 
-// Insert inserts the provided feedback.
-func (d MySQL) Insert(feedback model.Feedback) error {
-	_, err := d.DB.Exec("INSERT INTO feedback(`userID`, `sessionID`, `comment`, `rating`, `date`) VALUES (?,?,?,?,?)",
-		feedback.UserID, feedback.SessionID, feedback.Comment, feedback.Rating, time.Now())
+// Insert inserts the provided feedback and audits its creation. The date of the feedback is stored in UTC and feedback
+// without a moderation status is approved. The feedback is returned as stored, with the ID assigned by the DB.
+// ErrDuplicate is returned if the user has already provided feedback for the session.
+func (d MySQL) Insert(feedback model.Feedback) (model.Feedback, error) {
+	feedback.Date = feedback.Date.UTC()
+	feedback.ModerationStatus = moderationStatus(feedback)
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	result, err := tx.Exec("INSERT INTO feedback(`userID`, `sessionID`, `comment`, `rating`, `date`, "+
+		"`moderationStatus`, `moderationReason`) VALUES (?,?,?,?,?,?,?)", feedback.UserID, feedback.SessionID,
+		feedback.Comment, feedback.Rating, feedback.Date, feedback.ModerationStatus, feedback.ModerationReason)
+	if err != nil {
+		rollback(tx)
+		if duplicateEntry(err) {
+			return model.Feedback{}, ErrDuplicate
+		}
+		return model.Feedback{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		rollback(tx)
+		return model.Feedback{}, fmt.Errorf("failed to read the ID of the inserted feedback: %w", err)
+	}
+	feedback.ID = int32(id)
+	feedback.Version = 1
+	if err := d.insertAudit(tx, AuditEntry{FeedbackID: feedback.ID, Action: AuditCreate,
+		Actor: UserActor(feedback.UserID), After: &feedback}); err != nil {
+		rollback(tx)
+		return model.Feedback{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return feedback, nil
+}
+
+// InsertBatch inserts the provided feedback with a multi-row insert in a single transaction. Feedback matching an
+// existing userID and sessionID, or an earlier feedback in the batch, is skipped.
+func (d MySQL) InsertBatch(feedback []model.Feedback) ([]model.Feedback, error) {
+	_, stored, err := d.writeBatch(feedback, false, func(f model.Feedback) string {
+		return UserActor(f.UserID)
+	})
+	return stored, err
+}
+
+// Import writes the provided feedback, keeping their dates, in a single transaction. Feedback matching an existing
+// userID and sessionID, or an earlier feedback in the batch, is skipped unless upsert is set, in which case it replaces
+// the comment, rating and date of the existing feedback.
+func (d MySQL) Import(feedback []model.Feedback, upsert bool) ([]ImportStatus, error) {
+	statuses, _, err := d.writeBatch(feedback, upsert, func(model.Feedback) string {
+		return ImportActor
+	})
+	return statuses, err
+}
+
+// writeBatch writes the feedback and audits the changes as made by the actor of each feedback. The status of each
+// feedback is returned along with the feedback as it was stored, the zero value when it was skipped.
+func (d MySQL) writeBatch(feedback []model.Feedback, upsert bool, actor func(f model.Feedback) string) ([]ImportStatus,
+	[]model.Feedback, error) {
+	//
+	// Feedback inserted concurrently for the same userID and sessionID breaks the unique index rather than creating a
+	// duplicate. The batch is written again so that feedback is locked, and skipped or updated, like any other
+	//
+	for attempt := 1; ; attempt++ {
+		statuses, stored, err := d.writeBatchOnce(feedback, upsert, actor)
+		if !duplicateEntry(err) || attempt == batchAttempts {
+			return statuses, stored, err
+		}
+	}
+}
+
+func (d MySQL) writeBatchOnce(feedback []model.Feedback, upsert bool, actor func(f model.Feedback) string) (
+	[]ImportStatus, []model.Feedback, error) {
+	statuses := make([]ImportStatus, len(feedback))
+	stored := make([]model.Feedback, len(feedback))
+	if len(feedback) == 0 {
+		return statuses, stored, nil
+	}
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	//
+	// Lock the existing feedback so a concurrent insert cannot create a duplicate
+	//
+	existing, err := lockFeedback(tx, feedback)
+	if err != nil {
+		rollback(tx)
+		return nil, nil, err
+	}
+	//
+	// New feedback is inserted at once. A later duplicate in the batch replaces the pending insert when upserting
+	//
+	pending := make(map[feedbackKey]int)
+	inserts := make([]model.Feedback, 0, len(feedback))
+	updates := make([]model.Feedback, 0)
+	for i, f := range feedback {
+		key := feedbackKey{userID: f.UserID, sessionID: f.SessionID}
+		if index, ok := pending[key]; ok {
+			if upsert {
+				inserts[index] = f
+				statuses[i] = ImportUpdated
+			} else {
+				statuses[i] = ImportSkipped
+			}
+		} else if before, ok := existing[key]; ok {
+			if upsert {
+				//
+				// Feedback an operator already moderated keeps its status
+				//
+				if moderationStatus(before) != model.ModerationApproved {
+					f.ModerationStatus = before.ModerationStatus
+					f.ModerationReason = before.ModerationReason
+				}
+				updates = append(updates, f)
+				statuses[i] = ImportUpdated
+			} else {
+				statuses[i] = ImportSkipped
+			}
+		} else {
+			pending[key] = len(inserts)
+			inserts = append(inserts, f)
+			statuses[i] = ImportInserted
+		}
+	}
+	if len(inserts) > 0 {
+		placeholders := make([]string, len(inserts))
+		args := make([]interface{}, 0, len(inserts)*7)
+		for i, f := range inserts {
+			placeholders[i] = "(?,?,?,?,?,?,?)"
+			args = append(args, f.UserID, f.SessionID, f.Comment, f.Rating, f.Date.UTC(), moderationStatus(f),
+				f.ModerationReason)
+		}
+		query := "INSERT INTO feedback(`userID`, `sessionID`, `comment`, `rating`, `date`, `moderationStatus`, " +
+			"`moderationReason`) VALUES " + strings.Join(placeholders, ",")
+		if _, err := tx.Exec(query, args...); err != nil {
+			rollback(tx)
+			return nil, nil, err
+		}
+	}
+	for _, f := range updates {
+		_, err := tx.Exec("UPDATE feedback SET `comment`=?, `rating`=?, `date`=?, `moderationStatus`=?, "+
+			"`moderationReason`=?, `version`=`version`+1 WHERE userID=? AND sessionID=?", f.Comment, f.Rating,
+			f.Date.UTC(), moderationStatus(f), f.ModerationReason, f.UserID, f.SessionID)
+		if err != nil {
+			rollback(tx)
+			return nil, nil, err
+		}
+	}
+	//
+	// Read back what was written to audit it, the IDs of the inserted feedback are only known to the DB
+	//
+	written, err := lockFeedback(tx, append(inserts, updates...))
+	if err != nil {
+		rollback(tx)
+		return nil, nil, err
+	}
+	entries := make([]AuditEntry, 0, len(inserts)+len(updates))
+	for _, f := range inserts {
+		after := written[feedbackKey{userID: f.UserID, sessionID: f.SessionID}]
+		entries = append(entries, AuditEntry{FeedbackID: after.ID, Action: AuditCreate, Actor: actor(f), After: &after})
+	}
+	for _, f := range updates {
+		key := feedbackKey{userID: f.UserID, sessionID: f.SessionID}
+		before, after := existing[key], written[key]
+		entries = append(entries, AuditEntry{FeedbackID: after.ID, Action: AuditUpdate, Actor: actor(f), Before: &before,
+			After: &after})
+	}
+	if err := d.insertAudit(tx, entries...); err != nil {
+		rollback(tx)
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for i, f := range feedback {
+		if statuses[i] != ImportSkipped {
+			stored[i] = written[feedbackKey{userID: f.UserID, sessionID: f.SessionID}]
+		}
+	}
+	return statuses, stored, nil
+}
+
+// duplicateEntry checks whether the error is an insert breaking a unique index, e.g. a second feedback of a user for a
+// session.
+func duplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry
+}
+
+// moderationStatus provides the moderation status of the feedback, approving feedback that was not moderated.
+func moderationStatus(feedback model.Feedback) model.ModerationStatus {
+	if len(feedback.ModerationStatus) == 0 {
+		return model.ModerationApproved
+	}
+	return feedback.ModerationStatus
+}
+
+type feedbackKey struct {
+	userID    string
+	sessionID string
+}
+
+// lockFeedback reads, and locks, the feedback matching the userID and sessionID of any of the provided feedback.
+func lockFeedback(tx *sql.Tx, feedback []model.Feedback) (map[feedbackKey]model.Feedback, error) {
+	existing := make(map[feedbackKey]model.Feedback)
+	if len(feedback) == 0 {
+		return existing, nil
+	}
+	placeholders := make([]string, len(feedback))
+	args := make([]interface{}, 0, len(feedback)*2)
+	for i, f := range feedback {
+		placeholders[i] = "(?,?)"
+		args = append(args, f.UserID, f.SessionID)
+	}
+	query := "SELECT " + feedbackColumns + " FROM feedback WHERE (userID, sessionID) IN (" +
+		strings.Join(placeholders, ",") + ") FOR UPDATE"
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		row, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		existing[feedbackKey{userID: row.UserID, sessionID: row.SessionID}] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		log.Println(fmt.Errorf("failed to rollback transaction: %w", err))
+	}
+}
+
+// FindByID finds the feedback with the ID in the session. ErrNotFound is returned if there is none.
+func (d MySQL) FindByID(sessionID string, id int32) (model.Feedback, error) {
+	row := d.DB.QueryRow("SELECT "+feedbackColumns+" FROM feedback WHERE id=? AND sessionID=?", id, sessionID)
+	feedback, err := scanFeedback(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Feedback{}, ErrNotFound
+	} else if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to read row: %w", err)
+	}
+	return feedback, nil
+}
+
+// Update replaces the comment, rating and moderation of the feedback if it is still at the expected version and audits
+// the change. The version is incremented and the updated feedback is returned. ErrNotFound is returned if the feedback
+// does not exist and ErrVersionMismatch if it changed since the expected version.
+func (d MySQL) Update(feedback model.Feedback, version int32) (model.Feedback, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	before, err := lockFeedbackByID(tx, "id=? AND sessionID=?", feedback.ID, feedback.SessionID)
+	if err != nil {
+		rollback(tx)
+		return model.Feedback{}, err
+	} else if before.Version != version {
+		rollback(tx)
+		return model.Feedback{}, ErrVersionMismatch
+	}
+	after := before
+	after.Comment = feedback.Comment
+	after.Rating = feedback.Rating
+	after.ModerationStatus = moderationStatus(feedback)
+	after.ModerationReason = feedback.ModerationReason
+	after.Version++
+	_, err = tx.Exec("UPDATE feedback SET `comment`=?, `rating`=?, `moderationStatus`=?, `moderationReason`=?, "+
+		"`version`=? WHERE id=?", after.Comment, after.Rating, after.ModerationStatus, after.ModerationReason,
+		after.Version, after.ID)
+	if err != nil {
+		rollback(tx)
+		return model.Feedback{}, err
+	}
+	if err := d.commitAudited(tx, AuditEntry{FeedbackID: after.ID, Action: AuditUpdate,
+		Actor: UserActor(before.UserID), Before: &before, After: &after}); err != nil {
+		return model.Feedback{}, err
+	}
+	return after, nil
+}
+
+// Delete deletes the feedback if it is still at the expected version and audits the deletion. ErrNotFound is returned
+// if the feedback does not exist and ErrVersionMismatch if it changed since the expected version.
+func (d MySQL) Delete(sessionID string, id int32, version int32) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	before, err := lockFeedbackByID(tx, "id=? AND sessionID=?", id, sessionID)
 	if err != nil {
+		rollback(tx)
 		return err
+	} else if before.Version != version {
+		rollback(tx)
+		return ErrVersionMismatch
+	}
+	if _, err := tx.Exec("DELETE FROM feedback WHERE id=?", id); err != nil {
+		rollback(tx)
+		return err
+	}
+	return d.commitAudited(tx, AuditEntry{FeedbackID: id, Action: AuditDelete, Actor: UserActor(before.UserID),
+		Before: &before})
+}
+
+// lockFeedbackByID reads, and locks, the single feedback matching the condition. ErrNotFound is returned if there is
+// none.
+func lockFeedbackByID(tx *sql.Tx, condition string, args ...interface{}) (model.Feedback, error) {
+	row := tx.QueryRow("SELECT "+feedbackColumns+" FROM feedback WHERE "+condition+" FOR UPDATE", args...)
+	feedback, err := scanFeedback(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Feedback{}, ErrNotFound
+	} else if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to read row: %w", err)
+	}
+	return feedback, nil
+}
+
+// commitAudited audits the change made in the transaction and commits it.
+func (d MySQL) commitAudited(tx *sql.Tx, entry AuditEntry) error {
+	if err := d.insertAudit(tx, entry); err != nil {
+		rollback(tx)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
-// Find finds the rows matching the sessionID. Results are limited.
+// Find finds the approved rows matching the sessionID. Results are limited.
 func (d MySQL) Find(sessionID string, sort Sort, limit int) ([]model.Feedback, error) {
-	query := fmt.Sprintf("SELECT * FROM feedback where sessionID=? ORDER BY `date` %s LIMIT %d", sort, limit)
-	return d.findRows(query, sessionID)
+	query := fmt.Sprintf("SELECT %s FROM feedback where sessionID=? AND moderationStatus=? ORDER BY `date` %s LIMIT %d",
+		feedbackColumns, sort, limit)
+	return d.findRows(query, sessionID, model.ModerationApproved)
 }
 
-// FindWithFilter finds the rows matching the sessionID and with the additional filter. Results are ordered and limited.
+// FindWithFilter finds the approved rows matching the sessionID and with the additional filter. Results are ordered
+// and limited.
 func (d MySQL) FindWithFilter(sessionID string, filter Filter, sort Sort, limit int) ([]model.Feedback, error) {
-	query := fmt.Sprintf("SELECT * FROM feedback where sessionID=? AND rating=? ORDER BY `date` %s LIMIT %d", sort, limit)
-	return d.findRows(query, sessionID, filter.Rating)
+	query := fmt.Sprintf("SELECT %s FROM feedback where sessionID=? AND moderationStatus=? AND rating=? "+
+		"ORDER BY `date` %s LIMIT %d", feedbackColumns, sort, limit)
+	return d.findRows(query, sessionID, model.ModerationApproved, filter.Rating)
+}
+
+// Summarize counts and sums the ratings of the approved rows matching the sessionID.
+func (d MySQL) Summarize(sessionID string) (Summary, error) {
+	var summary Summary
+	if err := d.DB.QueryRow("SELECT COUNT(*), COALESCE(SUM(rating), 0), COALESCE(MAX(id), 0) FROM feedback "+
+		"where sessionID=? AND moderationStatus=?", sessionID, model.ModerationApproved).
+		Scan(&summary.Count, &summary.RatingSum, &summary.LastID); err != nil {
+		return Summary{}, fmt.Errorf("failed to summarize feedback for session %s: %w", sessionID, err)
+	}
+	return summary, nil
+}
+
+// SummarizeSessions counts and sums the ratings of the approved rows of each of the sessions in a single query.
+func (d MySQL) SummarizeSessions(sessionIDs []string) (map[string]Summary, error) {
+	summaries := make(map[string]Summary, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return summaries, nil
+	}
+	placeholders := make([]string, len(sessionIDs))
+	args := make([]interface{}, 0, len(sessionIDs)+1)
+	for i, sessionID := range sessionIDs {
+		placeholders[i] = "?"
+		args = append(args, sessionID)
+		summaries[sessionID] = Summary{}
+	}
+	args = append(args, model.ModerationApproved)
+	rows, err := d.DB.Query("SELECT `sessionID`, COUNT(*), COALESCE(SUM(rating), 0), COALESCE(MAX(id), 0) "+
+		"FROM feedback WHERE sessionID IN ("+strings.Join(placeholders, ",")+") AND moderationStatus=? "+
+		"GROUP BY `sessionID`", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize feedback for the sessions: %w", err)
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var sessionID string
+		var summary Summary
+		if err := rows.Scan(&sessionID, &summary.Count, &summary.RatingSum, &summary.LastID); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		summaries[sessionID] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// FindPages finds the approved rows of each page with a query per page, unioned into a single query. Each row is
+// selected with the index of its page.
+func (d MySQL) FindPages(pages []Page) ([][]model.Feedback, error) {
+	found := make([][]model.Feedback, len(pages))
+	if len(pages) == 0 {
+		return found, nil
+	}
+	queries := make([]string, len(pages))
+	var args []interface{}
+	for i, page := range pages {
+		condition := "sessionID=? AND moderationStatus=?"
+		args = append(args, i, page.SessionID, model.ModerationApproved)
+		if len(page.Filter.Rating) > 0 {
+			condition += " AND rating=?"
+			args = append(args, page.Filter.Rating)
+		}
+		if page.BeforeID > 0 {
+			condition += " AND (`date`<? OR (`date`=? AND id<?))"
+			args = append(args, page.BeforeDate.UTC(), page.BeforeDate.UTC(), page.BeforeID)
+		}
+		queries[i] = fmt.Sprintf("(SELECT ? AS `page`, %s FROM feedback WHERE %s ORDER BY `date` DESC, `id` DESC "+
+			"LIMIT %d)", feedbackColumns, condition, page.Limit)
+	}
+	rows, err := d.DB.Query(strings.Join(queries, " UNION ALL ")+" ORDER BY `page`, `date` DESC, `id` DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the pages of feedback: %w", err)
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var page int
+		feedback, err := scanFeedback(pageScanner{rows: rows, page: &page})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		} else if page < 0 || page >= len(pages) {
+			return nil, fmt.Errorf("failed to read row: unknown page %d", page)
+		}
+		found[page] = append(found[page], feedback)
+	}
+	return found, rows.Err()
+}
+
+// pageScanner scans the index of the page a row belongs to before the feedback of the row.
+type pageScanner struct {
+	rows *sql.Rows
+	page *int
+}
+
+func (p pageScanner) Scan(dest ...interface{}) error {
+	return p.rows.Scan(append([]interface{}{p.page}, dest...)...)
+}
+
+// FindByModerationStatus finds the rows with the moderation status, oldest first. Results are limited.
+func (d MySQL) FindByModerationStatus(status model.ModerationStatus, limit int) ([]model.Feedback, error) {
+	query := fmt.Sprintf("SELECT %s FROM feedback where moderationStatus=? ORDER BY `date`, `id` LIMIT %d",
+		feedbackColumns, limit)
+	return d.findRows(query, status)
+}
+
+// SetModerationStatus sets the moderation status and reason of the feedback with the ID and audits the change as made
+// by the actor. The version is incremented and the feedback is returned as it was before and after. ErrNotFound is
+// returned if the feedback does not exist.
+func (d MySQL) SetModerationStatus(id int32, status model.ModerationStatus, reason string, actor string) (
+	ModerationChange, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return ModerationChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	before, err := lockFeedbackByID(tx, "id=?", id)
+	if err != nil {
+		rollback(tx)
+		return ModerationChange{}, err
+	}
+	after := before
+	after.ModerationStatus = status
+	after.ModerationReason = reason
+	after.Version++
+	_, err = tx.Exec("UPDATE feedback SET `moderationStatus`=?, `moderationReason`=?, `version`=? WHERE id=?", status,
+		reason, after.Version, id)
+	if err != nil {
+		rollback(tx)
+		return ModerationChange{}, err
+	}
+	if err := d.commitAudited(tx, AuditEntry{FeedbackID: id, Action: AuditModerate, Actor: actor, Before: &before,
+		After: &after}); err != nil {
+		return ModerationChange{}, err
+	}
+	return ModerationChange{Before: before, After: after}, nil
+}
+
+// Export streams the rows matching the filter, ordered by date, to the provided function. Rows are read from the
+// server as they are consumed rather than loaded at once.
+func (d MySQL) Export(ctx context.Context, filter ExportFilter, fn func(feedback model.Feedback) error) error {
+	conditions := make([]string, 0, 4)
+	args := make([]interface{}, 0, 4)
+	if len(filter.SessionID) > 0 {
+		conditions = append(conditions, "sessionID=?")
+		args = append(args, filter.SessionID)
+	}
+	if len(filter.ModerationStatus) > 0 {
+		conditions = append(conditions, "moderationStatus=?")
+		args = append(args, filter.ModerationStatus)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "`date`>=?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "`date`<?")
+		args = append(args, filter.To)
+	}
+	query := "SELECT " + feedbackColumns + " FROM feedback"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY `date`, `id`"
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		row, err := scanFeedback(rows)
+		if err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 func (d MySQL) findRows(query string, args ...interface{}) ([]model.Feedback, error) {
@@ -78,8 +617,8 @@ func (d MySQL) findRows(query string, args ...interface{}) ([]model.Feedback, er
 	// Read each row
 	//
 	for rows.Next() {
-		var row model.Feedback
-		if err := rows.Scan(&row.ID, &row.UserID, &row.SessionID, &row.Comment, &row.Rating, &row.Date); err != nil {
+		row, err := scanFeedback(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to read row: %w", err)
 		}
 		feedback = append(feedback, row)
@@ -87,6 +626,18 @@ func (d MySQL) findRows(query string, args ...interface{}) ([]model.Feedback, er
 	return feedback, nil
 }
 
+// scanner is either a single row or the current row of rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFeedback(row scanner) (model.Feedback, error) {
+	var feedback model.Feedback
+	err := row.Scan(&feedback.ID, &feedback.UserID, &feedback.SessionID, &feedback.Comment, &feedback.Rating,
+		&feedback.Date, &feedback.Version, &feedback.ModerationStatus, &feedback.ModerationReason)
+	return feedback, err
+}
+
 func closeRows(rows *sql.Rows) {
 	if err := rows.Close(); err != nil {
 		log.Println(fmt.Errorf("failed to close MySQL rows: %w", err))
@@ -1,12 +1,14 @@
 package db_test
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Piszmog/feedback-service/db"
 	"github.com/Piszmog/feedback-service/model"
+	"github.com/go-sql-driver/mysql"
 	"testing"
 	"time"
 )
@@ -154,12 +156,19 @@ func TestMySQL_Insert(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}, "approved", "").
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit\\(`feedbackID`, `action`, `actor`, `before`, `after`\\) VALUES \\(\\?,\\?,\\?,\\?,\\?\\)$").
+		WithArgs(42, "create", "user:123", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries\\(`webhookID`, `event`, `payload`, `nextAttempt`\\) "+
+		"SELECT w.`id`, e.`event`, e.`payload`, \\? FROM webhooks w JOIN \\(SELECT \\? AS `event`, \\? AS `rating`, \\? AS `payload`\\) e*").
+		WithArgs(anyTime{}, "feedback.created", 5, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 	//
 	// Run the test
 	//
-	insertError := mySQL.Insert(model.Feedback{
+	feedback, insertError := mySQL.Insert(model.Feedback{
 		UserID:    "123",
 		SessionID: "987",
 		Comment:   "A Test",
@@ -173,6 +182,8 @@ func TestMySQL_Insert(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations %v", err)
 	} else if insertError != nil {
 		t.Errorf("unexpected error occurred: %v", err)
+	} else if feedback.ID != 42 || feedback.Date.Location() != time.UTC {
+		t.Errorf("expected the stored feedback with its ID but got %+v", feedback)
 	}
 	mock.ExpectClose()
 }
@@ -186,12 +197,14 @@ func TestMySQL_Insert_WithError(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}).
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}, "approved", "").
 		WillReturnError(errors.New("failed"))
+	mock.ExpectRollback()
 	//
 	// Run the test
 	//
-	insertError := mySQL.Insert(model.Feedback{
+	_, insertError := mySQL.Insert(model.Feedback{
 		UserID:    "123",
 		SessionID: "987",
 		Comment:   "A Test",
@@ -209,6 +222,459 @@ func TestMySQL_Insert_WithError(t *testing.T) {
 	mock.ExpectClose()
 }
 
+func TestMySQL_Insert_Duplicate(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO feedback*").WithArgs("123", "987", "A Test", 5, anyTime{}, "approved", "").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	_, insertError := mySQL.Insert(model.Feedback{
+		UserID:    "123",
+		SessionID: "987",
+		Comment:   "A Test",
+		Rating:    5,
+		Date:      time.Now(),
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(insertError, db.ErrDuplicate) {
+		t.Errorf("expected a duplicate error but got %v", insertError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_InsertBatch(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE \\(userID, sessionID\\) IN \\(\\(\\?,\\?\\),\\(\\?,\\?\\),\\(\\?,\\?\\)\\) FOR UPDATE").
+		WithArgs("123", "1", "123", "2", "123", "1").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "123", "2", "Old", 2, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback\\(`userID`, `sessionID`, `comment`, `rating`, `date`, `moderationStatus`, `moderationReason`\\) VALUES \\(\\?,\\?,\\?,\\?,\\?,\\?,\\?\\)$").
+		WithArgs("123", "1", "A Test", 5, anyTime{}, "approved", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(selectFeedback+" WHERE \\(userID, sessionID\\) IN \\(\\(\\?,\\?\\)\\) FOR UPDATE").
+		WithArgs("123", "1").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(8, "123", "1", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback_audit*").WithArgs(8, "create", "user:123", nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	now := time.Now()
+	inserted, insertError := mySQL.InsertBatch([]model.Feedback{
+		{UserID: "123", SessionID: "1", Comment: "A Test", Rating: 5, Date: now},
+		{UserID: "123", SessionID: "2", Comment: "A Test", Rating: 4, Date: now},
+		{UserID: "123", SessionID: "1", Comment: "Again", Rating: 3, Date: now},
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if insertError != nil {
+		t.Errorf("unexpected error occurred: %v", insertError)
+	} else if len(inserted) != 3 || inserted[0].ID != 8 || inserted[1].ID != 0 || inserted[2].ID != 0 {
+		t.Errorf("expected only the first feedback to be inserted but got %v", inserted)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_InsertBatch_WithError(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM feedback WHERE \\(userID, sessionID\\) IN*").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec("INSERT INTO feedback*").WillReturnError(errors.New("failed"))
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	inserted, insertError := mySQL.InsertBatch([]model.Feedback{
+		{UserID: "123", SessionID: "1", Comment: "A Test", Rating: 5, Date: time.Now()},
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if insertError == nil {
+		t.Error("expected error to occurred")
+	} else if inserted != nil {
+		t.Error("expected no results")
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_InsertBatch_ConcurrentDuplicate(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM feedback WHERE \\(userID, sessionID\\) IN*").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec("INSERT INTO feedback*").
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectRollback()
+	//
+	// The feedback inserted concurrently is found when the batch is written again
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM feedback WHERE \\(userID, sessionID\\) IN*").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "123", "1", "Other", 2, time.Now(), 1, "approved", ""))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	inserted, insertError := mySQL.InsertBatch([]model.Feedback{
+		{UserID: "123", SessionID: "1", Comment: "A Test", Rating: 5, Date: time.Now()},
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if insertError != nil {
+		t.Errorf("unexpected error occurred: %v", insertError)
+	} else if len(inserted) != 1 || inserted[0].ID != 0 {
+		t.Errorf("expected the feedback to be a duplicate but got %v", inserted)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Import_Upsert(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	first := time.Date(2019, 11, 1, 10, 0, 0, 0, time.UTC)
+	second := time.Date(2019, 11, 2, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE \\(userID, sessionID\\) IN .* FOR UPDATE").
+		WithArgs("123", "1", "123", "2", "123", "1").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "123", "2", "Old", 2, first, 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback\\(`userID`, `sessionID`, `comment`, `rating`, `date`, `moderationStatus`, `moderationReason`\\) VALUES \\(\\?,\\?,\\?,\\?,\\?,\\?,\\?\\)$").
+		WithArgs("123", "1", "Again", 3, second, "approved", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE feedback SET `comment`=\\?, `rating`=\\?, `date`=\\?, `moderationStatus`=\\?, "+
+		"`moderationReason`=\\?, `version`=`version`\\+1 WHERE userID=\\? AND sessionID=\\?").
+		WithArgs("Changed", 4, first, "approved", "", "123", "2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(selectFeedback+" WHERE \\(userID, sessionID\\) IN .* FOR UPDATE").
+		WithArgs("123", "1", "123", "2").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(8, "123", "1", "Again", 3, second, 1, "approved", "").
+			AddRow(7, "123", "2", "Changed", 4, first, 2, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback_audit*").
+		WithArgs(8, "create", "import", nil, sqlmock.AnyArg(), 7, "update", "import", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	statuses, importError := mySQL.Import([]model.Feedback{
+		{UserID: "123", SessionID: "1", Comment: "A Test", Rating: 5, Date: first},
+		{UserID: "123", SessionID: "2", Comment: "Changed", Rating: 4, Date: first},
+		{UserID: "123", SessionID: "1", Comment: "Again", Rating: 3, Date: second},
+	}, true)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if importError != nil {
+		t.Errorf("unexpected error occurred: %v", importError)
+	} else if len(statuses) != 3 || statuses[0] != db.ImportInserted || statuses[1] != db.ImportUpdated ||
+		statuses[2] != db.ImportUpdated {
+		t.Errorf("expected inserted, updated, updated but got %v", statuses)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_FindByID(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\?").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	//
+	// Run the test
+	//
+	feedback, findError := mySQL.FindByID("987", 1)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if findError != nil {
+		t.Errorf("unexpected error occurred: %v", findError)
+	} else if feedback.ID != 1 || feedback.UserID != "123" {
+		t.Errorf("unexpected feedback %+v", feedback)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_FindByID_NotFound(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\?").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns))
+	//
+	// Run the test
+	//
+	_, findError := mySQL.FindByID("987", 1)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(findError, db.ErrNotFound) {
+		t.Errorf("expected not found but got %v", findError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Update(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("UPDATE feedback SET `comment`=\\?, `rating`=\\?, `moderationStatus`=\\?, `moderationReason`=\\?, `version`=\\? WHERE id=\\?").
+		WithArgs("Changed", 3, "approved", "", 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").
+		WithArgs(1, "update", "user:123", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	feedback, updateError := mySQL.Update(model.Feedback{ID: 1, SessionID: "987", Comment: "Changed", Rating: 3}, 1)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if updateError != nil {
+		t.Errorf("unexpected error occurred: %v", updateError)
+	} else if feedback.Version != 2 {
+		t.Errorf("expected version 2 but got %d", feedback.Version)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_SetModerationStatus(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback + " WHERE id=\\? FOR UPDATE").
+		WithArgs(1).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("UPDATE feedback SET `moderationStatus`=\\?, `moderationReason`=\\?, `version`=\\? WHERE id=\\?").
+		WithArgs("rejected", "advertising", 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").
+		WithArgs(1, "moderate", "operator:alice", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	change, moderateError := mySQL.SetModerationStatus(1, model.ModerationRejected, "advertising", "operator:alice")
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if moderateError != nil {
+		t.Errorf("unexpected error occurred: %v", moderateError)
+	} else if change.After.ModerationStatus != model.ModerationRejected || change.After.Version != 2 ||
+		change.Before.Version != 1 {
+		t.Errorf("unexpected change %+v", change)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_SetModerationStatus_NotFound(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback + " WHERE id=\\? FOR UPDATE").WithArgs(1).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	_, moderateError := mySQL.SetModerationStatus(1, model.ModerationApproved, "", "operator:alice")
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(moderateError, db.ErrNotFound) {
+		t.Errorf("expected not found but got %v", moderateError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Update_VersionMismatch(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 2, "approved", ""))
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	_, updateError := mySQL.Update(model.Feedback{ID: 1, SessionID: "987", Comment: "Changed", Rating: 3}, 1)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(updateError, db.ErrVersionMismatch) {
+		t.Errorf("expected version mismatch but got %v", updateError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Delete(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 2, "approved", ""))
+	mock.ExpectExec("DELETE FROM feedback WHERE id=\\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").WithArgs(1, "delete", "user:123", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	deleteError := mySQL.Delete("987", 1, 2)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if deleteError != nil {
+		t.Errorf("unexpected error occurred: %v", deleteError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Delete_NotFound(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	deleteError := mySQL.Delete("987", 1, 2)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(deleteError, db.ErrNotFound) {
+		t.Errorf("expected not found but got %v", deleteError)
+	}
+	mock.ExpectClose()
+}
+
 func TestMySQL_Find(t *testing.T) {
 	//
 	// Mock the SQL DB
@@ -218,9 +684,9 @@ func TestMySQL_Find(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectQuery("SELECT \\* FROM feedback where sessionID=\\? ORDER BY `date` DESC LIMIT 1").
-		WithArgs("987").WillReturnRows(sqlmock.NewRows([]string{"id", "userID", "sessionID", "comment", "rating", "date"}).
-		AddRow(1, "123", "987", "A Test", 5, time.Now()))
+	mock.ExpectQuery(selectFeedback+" where sessionID=\\? AND moderationStatus=\\? ORDER BY `date` DESC LIMIT 1").
+		WithArgs("987", "approved").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
 	//
 	// Run the test
 	//
@@ -238,6 +704,108 @@ func TestMySQL_Find(t *testing.T) {
 	mock.ExpectClose()
 }
 
+func TestMySQL_Summarize(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COALESCE\\(SUM\\(rating\\), 0\\), COALESCE\\(MAX\\(id\\), 0\\) FROM feedback "+
+		"where sessionID=\\? AND moderationStatus=\\?").WithArgs("987", "approved").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum", "max"}).AddRow(3, 11, 7))
+	//
+	// Run the test
+	//
+	summary, summarizeError := mySQL.Summarize("987")
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if summarizeError != nil {
+		t.Errorf("unexpected error occurred: %v", summarizeError)
+	} else if summary.Count != 3 || summary.RatingSum != 11 || summary.LastID != 7 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_SummarizeSessions(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery("SELECT `sessionID`, COUNT\\(\\*\\), COALESCE\\(SUM\\(rating\\), 0\\), "+
+		"COALESCE\\(MAX\\(id\\), 0\\) FROM feedback WHERE sessionID IN \\(\\?,\\?\\) AND moderationStatus=\\? "+
+		"GROUP BY `sessionID`").
+		WithArgs("987", "654", "approved").
+		WillReturnRows(sqlmock.NewRows([]string{"sessionID", "count", "sum", "max"}).AddRow("987", 3, 11, 7))
+	//
+	// Run the test
+	//
+	summaries, summarizeError := mySQL.SummarizeSessions([]string{"987", "654"})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if summarizeError != nil {
+		t.Errorf("unexpected error occurred: %v", summarizeError)
+	} else if summary, ok := summaries["654"]; len(summaries) != 2 || summaries["987"].RatingSum != 11 || !ok ||
+		summary.Count != 0 {
+		t.Errorf("unexpected summaries %+v", summaries)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_FindPages(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	before := time.Date(2019, 11, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("\\(SELECT \\? AS `page`, `id`, .* FROM feedback WHERE sessionID=\\? AND "+
+		"moderationStatus=\\? ORDER BY `date` DESC, `id` DESC LIMIT 2\\) UNION ALL \\(SELECT \\? AS `page`, `id`, .* "+
+		"FROM feedback WHERE sessionID=\\? AND moderationStatus=\\? AND rating=\\? AND \\(`date`<\\? OR "+
+		"\\(`date`=\\? AND id<\\?\\)\\) ORDER BY `date` DESC, `id` DESC LIMIT 3\\) "+
+		"ORDER BY `page`, `date` DESC, `id` DESC").
+		WithArgs(0, "987", "approved", 1, "654", "approved", "5", before, before, 40).
+		WillReturnRows(sqlmock.NewRows(append([]string{"page"}, columns...)).
+			AddRow(0, 9, "123", "987", "A Test", 4, time.Now(), 1, "approved", "").
+			AddRow(1, 31, "456", "654", "Another Test", 5, time.Now(), 1, "approved", "").
+			AddRow(1, 30, "789", "654", "", 5, time.Now(), 2, "approved", ""))
+	//
+	// Run the test
+	//
+	pages, findError := mySQL.FindPages([]db.Page{
+		{SessionID: "987", Limit: 2},
+		{SessionID: "654", Filter: db.Filter{Rating: "5"}, BeforeDate: before, BeforeID: 40, Limit: 3},
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if findError != nil {
+		t.Errorf("unexpected error occurred: %v", findError)
+	} else if len(pages) != 2 || len(pages[0]) != 1 || pages[0][0].ID != 9 || len(pages[1]) != 2 ||
+		pages[1][1].ID != 30 {
+		t.Errorf("unexpected pages %+v", pages)
+	}
+	mock.ExpectClose()
+}
+
 func TestMySQL_Find_WithError(t *testing.T) {
 	//
 	// Mock the SQL DB
@@ -247,8 +815,8 @@ func TestMySQL_Find_WithError(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectQuery("SELECT \\* FROM feedback where sessionID=\\? ORDER BY `date` DESC LIMIT 1").
-		WithArgs("987").WillReturnError(errors.New("failed"))
+	mock.ExpectQuery(selectFeedback+" where sessionID=\\? AND moderationStatus=\\? ORDER BY `date` DESC LIMIT 1").
+		WithArgs("987", "approved").WillReturnError(errors.New("failed"))
 	//
 	// Run the test
 	//
@@ -275,8 +843,8 @@ func TestMySQL_Find_BadColumns(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectQuery("SELECT \\* FROM feedback where sessionID=\\? ORDER BY `date` DESC LIMIT 1").
-		WithArgs("987").WillReturnRows(sqlmock.NewRows([]string{"id", "userID", "sessionID", "comment"}).
+	mock.ExpectQuery(selectFeedback+" where sessionID=\\? AND moderationStatus=\\? ORDER BY `date` DESC LIMIT 1").
+		WithArgs("987", "approved").WillReturnRows(sqlmock.NewRows([]string{"id", "userID", "sessionID", "comment"}).
 		AddRow("1", 123, "987", "A Test"))
 	//
 	// Run the test
@@ -304,9 +872,9 @@ func TestMySQL_FindWithFilter(t *testing.T) {
 	//
 	// Setup Mocks
 	//
-	mock.ExpectQuery("SELECT \\* FROM feedback where sessionID=\\? AND rating=\\? ORDER BY `date` DESC LIMIT 1").
-		WithArgs("987", "5").WillReturnRows(sqlmock.NewRows([]string{"id", "userID", "sessionID", "comment", "rating", "date"}).
-		AddRow(1, "123", "987", "A Test", 5, time.Now()))
+	mock.ExpectQuery(selectFeedback+" where sessionID=\\? AND moderationStatus=\\? AND rating=\\? ORDER BY `date` DESC LIMIT 1").
+		WithArgs("987", "approved", "5").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
 	//
 	// Run the test
 	//
@@ -324,6 +892,87 @@ func TestMySQL_FindWithFilter(t *testing.T) {
 	mock.ExpectClose()
 }
 
+func TestMySQL_Export(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	from := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(selectFeedback+" WHERE sessionID=\\? AND moderationStatus=\\? AND `date`>=\\? AND `date`<\\? "+
+		"ORDER BY `date`, `id`").
+		WithArgs("987", model.ModerationApproved, from, to).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", "").
+		AddRow(2, "456", "987", "A Test", 3, time.Now(), 1, "approved", ""))
+	//
+	// Run the test
+	//
+	var exported []model.Feedback
+	exportError := mySQL.Export(context.Background(), db.ExportFilter{SessionID: "987",
+		ModerationStatus: model.ModerationApproved, From: from, To: to},
+		func(feedback model.Feedback) error {
+			exported = append(exported, feedback)
+			return nil
+		})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if exportError != nil {
+		t.Errorf("unexpected error occurred: %v", exportError)
+	} else if len(exported) != 2 {
+		t.Errorf("expected 2 feedback to be exported but got %d", len(exported))
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Export_CallbackError(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery(selectFeedback + " ORDER BY `date`, `id`").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", "").
+			AddRow(2, "456", "987", "A Test", 3, time.Now(), 1, "approved", ""))
+	//
+	// Run the test
+	//
+	calls := 0
+	exportError := mySQL.Export(context.Background(), db.ExportFilter{}, func(feedback model.Feedback) error {
+		calls++
+		return errors.New("failed")
+	})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if exportError == nil {
+		t.Error("expected error to occurred")
+	} else if calls != 1 {
+		t.Errorf("expected the export to stop after the first failure but got %d calls", calls)
+	}
+	mock.ExpectClose()
+}
+
+// selectFeedback is the start of the queries that read feedback.
+const selectFeedback = "SELECT `id`, `userID`, `sessionID`, `comment`, `rating`, `date`, `version`, " +
+	"`moderationStatus`, `moderationReason` FROM feedback"
+
+// columns are the columns of the rows that read feedback.
+var columns = []string{"id", "userID", "sessionID", "comment", "rating", "date", "version", "moderationStatus",
+	"moderationReason"}
+
 func createMockDB(t *testing.T) (*db.MySQL, sqlmock.Sqlmock) {
 	connection, mock, err := sqlmock.New()
 	if err != nil {
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+const tlsConfigName = "feedback-service"
+
+// TLS modes for connecting to the DB.
+const (
+	// TLSDisabled connects without TLS.
+	TLSDisabled = "false"
+	// TLSVerify connects with TLS and verifies the server certificate.
+	TLSVerify = "true"
+	// TLSSkipVerify connects with TLS but does not verify the server certificate.
+	TLSSkipVerify = "skip-verify"
+)
+
+// Options are the connection options used to connect to a DB.
+type Options struct {
+	Username     string `yaml:"username" toml:"username"`
+	Password     string `yaml:"password" toml:"password"`
+	Host         string `yaml:"host" toml:"host"`
+	Port         string `yaml:"port" toml:"port"`
+	DatabaseName string `yaml:"database" toml:"database"`
+	ParseTime    bool   `yaml:"parseTime" toml:"parseTime"`
+	// DSN is a complete data source name. When provided, it is used as is and the other connection options, except for
+	// the pool options, are ignored.
+	DSN string `yaml:"dsn" toml:"dsn"`
+
+	MaxOpenConns    int           `yaml:"maxOpenConns" toml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" toml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime"`
+
+	DialTimeout  time.Duration `yaml:"dialTimeout" toml:"dialTimeout"`
+	ReadTimeout  time.Duration `yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+
+	// TLSMode is one of TLSDisabled, TLSVerify or TLSSkipVerify.
+	TLSMode     string `yaml:"tlsMode" toml:"tlsMode"`
+	TLSCAFile   string `yaml:"tlsCAFile" toml:"tlsCAFile"`
+	TLSCertFile string `yaml:"tlsCertFile" toml:"tlsCertFile"`
+	TLSKeyFile  string `yaml:"tlsKeyFile" toml:"tlsKeyFile"`
+
+	Charset   string `yaml:"charset" toml:"charset"`
+	Collation string `yaml:"collation" toml:"collation"`
+}
+
+// Validate validates the provided options.
+func (o Options) Validate() error {
+	if err := o.validatePool(); err != nil {
+		return err
+	}
+	if len(o.DSN) > 0 {
+		if _, err := mysql.ParseDSN(o.DSN); err != nil {
+			return fmt.Errorf("invalid DSN to connect to the DB: %w", err)
+		}
+		return nil
+	}
+	if len(o.Username) == 0 {
+		return errors.New("require username to connect to the DB")
+	} else if len(o.Password) == 0 {
+		return errors.New("require password to connect to the DB")
+	} else if len(o.Host) == 0 {
+		return errors.New("require host to connect to the DB")
+	} else if len(o.Port) == 0 {
+		return errors.New("require port to connect to the DB")
+	} else if len(o.DatabaseName) == 0 {
+		return errors.New("require database name to connect to the DB")
+	} else if o.DialTimeout < 0 || o.ReadTimeout < 0 || o.WriteTimeout < 0 {
+		return errors.New("require DB timeouts to not be negative")
+	}
+	switch o.TLSMode {
+	case "", TLSDisabled:
+		if len(o.TLSCAFile) > 0 || len(o.TLSCertFile) > 0 {
+			return errors.New("require DB TLS mode to be enabled when providing TLS files")
+		}
+	case TLSVerify, TLSSkipVerify:
+	default:
+		return fmt.Errorf("unknown DB TLS mode '%s', expected one of '%s', '%s' or '%s'",
+			o.TLSMode, TLSDisabled, TLSVerify, TLSSkipVerify)
+	}
+	if (len(o.TLSCertFile) == 0) != (len(o.TLSKeyFile) == 0) {
+		return errors.New("require both a DB TLS certificate and key file for client authentication")
+	}
+	return nil
+}
+
+func (o Options) validatePool() error {
+	if o.MaxOpenConns < 0 {
+		return errors.New("require max open DB connections to not be negative")
+	} else if o.MaxIdleConns < 0 {
+		return errors.New("require max idle DB connections to not be negative")
+	} else if o.MaxOpenConns > 0 && o.MaxIdleConns > o.MaxOpenConns {
+		return errors.New("require max idle DB connections to not exceed max open DB connections")
+	} else if o.ConnMaxLifetime < 0 {
+		return errors.New("require DB connection max lifetime to not be negative")
+	}
+	return nil
+}
+
+// MySQLConfig provides the driver configuration used to open a connection to the DB.
+func (o Options) MySQLConfig() (*mysql.Config, error) {
+	if len(o.DSN) > 0 {
+		return mysql.ParseDSN(o.DSN)
+	}
+	config := mysql.NewConfig()
+	config.User = o.Username
+	config.Passwd = o.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(o.Host, o.Port)
+	config.DBName = o.DatabaseName
+	config.ParseTime = o.ParseTime
+	config.Timeout = o.DialTimeout
+	config.ReadTimeout = o.ReadTimeout
+	config.WriteTimeout = o.WriteTimeout
+	if len(o.Collation) > 0 {
+		config.Collation = o.Collation
+	}
+	if len(o.Charset) > 0 {
+		config.Params = map[string]string{"charset": o.Charset}
+	}
+	//
+	// Use the TLS files if any were provided, otherwise let the driver handle the mode
+	//
+	switch {
+	case len(o.TLSCAFile) > 0 || len(o.TLSCertFile) > 0:
+		tlsConfig, err := o.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		if err := mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to register the DB TLS configuration: %w", err)
+		}
+		config.TLSConfig = tlsConfigName
+	case len(o.TLSMode) > 0:
+		config.TLSConfig = o.TLSMode
+	}
+	return config, nil
+}
+
+func (o Options) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         o.Host,
+		InsecureSkipVerify: o.TLSMode == TLSSkipVerify,
+	}
+	if len(o.TLSCAFile) > 0 {
+		pem, err := ioutil.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the DB TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the DB TLS CA file %s", o.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(o.TLSCertFile) > 0 {
+		certificate, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the DB TLS certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// DataSourceName provides the DSN used to open a connection to the DB.
+func (o Options) DataSourceName() (string, error) {
+	if len(o.DSN) > 0 {
+		return o.DSN, nil
+	}
+	config, err := o.MySQLConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.FormatDSN(), nil
+}
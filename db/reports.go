@@ -0,0 +1,130 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+)
+
+// ErrDuplicateReport is returned when the user has already reported the feedback.
+var ErrDuplicateReport = errors.New("feedback already reported by the user")
+
+// ReportResult is the outcome of a report.
+type ReportResult struct {
+	// Reports is how many users have reported the feedback, including this report.
+	Reports int
+	// Hidden is whether this report hid the feedback.
+	Hidden bool
+	// Feedback is the feedback as it was hidden, only set when the report hid it.
+	Feedback model.Feedback
+}
+
+// ReportCount is how many users reported a feedback, in total and for each reason.
+type ReportCount struct {
+	Total   int                        `json:"total"`
+	Reasons map[model.ReportReason]int `json:"reasons"`
+}
+
+// Report records the report of the feedback. When the report is the one that brings the reports of approved feedback
+// to the threshold, the feedback is hidden and the change audited as made by the system. A threshold of 0 never hides
+// feedback. ErrNotFound is returned if the feedback does not exist and ErrDuplicateReport if the reporter has already
+// reported it.
+func (d MySQL) Report(report model.Report, threshold int) (ReportResult, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return ReportResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	before, err := lockFeedbackByID(tx, "id=? AND sessionID=?", report.FeedbackID, report.SessionID)
+	if err != nil {
+		rollback(tx)
+		return ReportResult{}, err
+	}
+	_, err = tx.Exec("INSERT INTO feedback_reports(`feedbackID`, `reporterID`, `reason`, `date`) VALUES (?,?,?,?)",
+		report.FeedbackID, report.ReporterID, report.Reason, report.Date.UTC())
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		rollback(tx)
+		return ReportResult{}, ErrDuplicateReport
+	} else if err != nil {
+		rollback(tx)
+		return ReportResult{}, fmt.Errorf("failed to record the report: %w", err)
+	}
+	var result ReportResult
+	if err := tx.QueryRow("SELECT COUNT(*) FROM feedback_reports WHERE feedbackID=?", report.FeedbackID).
+		Scan(&result.Reports); err != nil {
+		rollback(tx)
+		return ReportResult{}, fmt.Errorf("failed to count the reports: %w", err)
+	}
+	//
+	// Only the report reaching the threshold hides the feedback, so feedback an operator unhid is not hidden again
+	//
+	if threshold <= 0 || result.Reports != threshold || !before.Visible() {
+		if err := tx.Commit(); err != nil {
+			return ReportResult{}, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return result, nil
+	}
+	after := before
+	after.ModerationStatus = model.ModerationHidden
+	after.ModerationReason = fmt.Sprintf("reported by %d users", result.Reports)
+	after.Version++
+	_, err = tx.Exec("UPDATE feedback SET `moderationStatus`=?, `moderationReason`=?, `version`=? WHERE id=?",
+		after.ModerationStatus, after.ModerationReason, after.Version, after.ID)
+	if err != nil {
+		rollback(tx)
+		return ReportResult{}, err
+	}
+	if err := d.commitAudited(tx, AuditEntry{FeedbackID: after.ID, Action: AuditModerate, Actor: SystemActor,
+		Before: &before, After: &after}); err != nil {
+		return ReportResult{}, err
+	}
+	result.Hidden = true
+	result.Feedback = after
+	return result, nil
+}
+
+// ReportCounts counts the reports of each feedback. Feedback without reports is not in the counts.
+func (d MySQL) ReportCounts(ids []int32) (map[int32]ReportCount, error) {
+	counts := make(map[int32]ReportCount)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := d.DB.Query("SELECT `feedbackID`, `reason`, COUNT(*) FROM feedback_reports WHERE feedbackID IN ("+
+		strings.Join(placeholders, ",")+") GROUP BY `feedbackID`, `reason`", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var id int32
+		var reason model.ReportReason
+		var count int
+		if err := rows.Scan(&id, &reason, &count); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		c, ok := counts[id]
+		if !ok {
+			c.Reasons = make(map[model.ReportReason]int)
+		}
+		c.Total += count
+		c.Reasons[reason] = count
+		counts[id] = c
+	}
+	return counts, rows.Err()
+}
+
+// FindReported finds the approved feedback that has been reported, most reported first. Results are limited.
+func (d MySQL) FindReported(limit int) ([]model.Feedback, error) {
+	query := fmt.Sprintf("SELECT %s FROM feedback JOIN (SELECT `feedbackID`, COUNT(*) AS `reports` "+
+		"FROM feedback_reports GROUP BY `feedbackID`) AS r ON r.feedbackID=feedback.id WHERE moderationStatus=? "+
+		"ORDER BY r.reports DESC, `id` LIMIT %d", feedbackColumns, limit)
+	return d.findRows(query, model.ModerationApproved)
+}
@@ -0,0 +1,147 @@
+package db_test
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+	"time"
+)
+
+func TestMySQL_Report(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback_reports\\(`feedbackID`, `reporterID`, `reason`, `date`\\) VALUES \\(\\?,\\?,\\?,\\?\\)").
+		WithArgs(1, "456", "spam", anyTime{}).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM feedback_reports WHERE feedbackID=\\?").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	result, reportError := mySQL.Report(model.Report{FeedbackID: 1, SessionID: "987", ReporterID: "456",
+		Reason: model.ReportSpam, Date: time.Now()}, 3)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if reportError != nil {
+		t.Errorf("unexpected error occurred: %v", reportError)
+	} else if result.Reports != 2 || result.Hidden {
+		t.Errorf("expected 2 reports without hiding but got %+v", result)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Report_Threshold(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback_reports*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM feedback_reports WHERE feedbackID=\\?").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec("UPDATE feedback SET `moderationStatus`=\\?, `moderationReason`=\\?, `version`=\\? WHERE id=\\?").
+		WithArgs("hidden", "reported by 3 users", 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO feedback_audit*").
+		WithArgs(1, "moderate", "system", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	result, reportError := mySQL.Report(model.Report{FeedbackID: 1, SessionID: "987", ReporterID: "456",
+		Reason: model.ReportHate, Date: time.Now()}, 3)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if reportError != nil {
+		t.Errorf("unexpected error occurred: %v", reportError)
+	} else if result.Reports != 3 || !result.Hidden || result.Feedback.ModerationStatus != model.ModerationHidden {
+		t.Errorf("expected the feedback to be hidden but got %+v", result)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_Report_Duplicate(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectFeedback+" WHERE id=\\? AND sessionID=\\? FOR UPDATE").
+		WithArgs(1, "987").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "123", "987", "A Test", 5, time.Now(), 1, "approved", ""))
+	mock.ExpectExec("INSERT INTO feedback_reports*").WillReturnError(&mysql.MySQLError{Number: 1062})
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	_, reportError := mySQL.Report(model.Report{FeedbackID: 1, SessionID: "987", ReporterID: "456",
+		Reason: model.ReportSpam, Date: time.Now()}, 3)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if !errors.Is(reportError, db.ErrDuplicateReport) {
+		t.Errorf("expected duplicate report but got %v", reportError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_ReportCounts(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectQuery("SELECT `feedbackID`, `reason`, COUNT\\(\\*\\) FROM feedback_reports WHERE feedbackID IN \\(\\?,\\?\\) GROUP BY `feedbackID`, `reason`").
+		WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"feedbackID", "reason", "count"}).
+		AddRow(1, "spam", 2).AddRow(1, "other", 1))
+	//
+	// Run the test
+	//
+	counts, countError := mySQL.ReportCounts([]int32{1, 2})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if countError != nil {
+		t.Errorf("unexpected error occurred: %v", countError)
+	} else if len(counts) != 1 || counts[1].Total != 3 || counts[1].Reasons[model.ReportSpam] != 2 {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+	mock.ExpectClose()
+}
@@ -0,0 +1,391 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrWebhookNotFound is returned when the requested webhook, or delivery of a webhook, does not exist.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotDead is returned when retrying a delivery that has not been dead-lettered.
+	ErrDeliveryNotDead = errors.New("webhook delivery is not dead")
+)
+
+// DeliveryStatus is where a webhook delivery is in its lifecycle.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is a delivery waiting for its next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered is a delivery the webhook accepted
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is a delivery that failed every attempt and is no longer retried
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookPayload is the body delivered to webhooks. Feedback is the feedback after the change, or the deleted
+// feedback, and Previous the feedback before the change, nil for created and deleted feedback.
+type WebhookPayload struct {
+	Event    model.WebhookEvent `json:"event"`
+	Date     time.Time          `json:"date"`
+	Feedback *model.Feedback    `json:"feedback"`
+	Previous *model.Feedback    `json:"previous,omitempty"`
+}
+
+// WebhookDelivery is an event queued in the outbox to be delivered to a webhook. The URL and secret of the webhook are
+// only set on the deliveries claimed to be delivered.
+type WebhookDelivery struct {
+	ID          int64              `json:"id"`
+	WebhookID   int64              `json:"webhookId"`
+	Event       model.WebhookEvent `json:"event"`
+	Payload     json.RawMessage    `json:"payload"`
+	Status      DeliveryStatus     `json:"status"`
+	Attempts    int                `json:"attempts"`
+	NextAttempt time.Time          `json:"nextAttempt"`
+	LastError   string             `json:"lastError,omitempty"`
+	Date        time.Time          `json:"date"`
+	URL         string             `json:"-"`
+	Secret      string             `json:"-"`
+}
+
+// WebhookAttempt is an attempt to deliver an event to a webhook, as recorded in the delivery log. StatusCode is 0 when
+// no response was received.
+type WebhookAttempt struct {
+	ID         int64     `json:"id"`
+	DeliveryID int64     `json:"deliveryId"`
+	WebhookID  int64     `json:"webhookId"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	Date       time.Time `json:"date"`
+}
+
+// WebhookStore manages the webhooks and the outbox of their deliveries. Deliveries are queued in the transaction of
+// the change to feedback they notify of. The MySQL DB is a WebhookStore.
+type WebhookStore interface {
+	// InsertWebhook inserts the webhook. The webhook is returned as stored, with its ID.
+	InsertWebhook(webhook model.Webhook) (model.Webhook, error)
+
+	// FindWebhooks finds every webhook, without their secrets.
+	FindWebhooks() ([]model.Webhook, error)
+
+	// FindWebhookByID finds a single webhook, without its secret. ErrWebhookNotFound is returned if there is none.
+	FindWebhookByID(id int64) (model.Webhook, error)
+
+	// DeleteWebhook deletes the webhook along with its deliveries and their log. ErrWebhookNotFound is returned if there
+	// is none.
+	DeleteWebhook(id int64) error
+
+	// FindWebhookDeliveries finds the deliveries of the webhook, oldest first, after the ID. An empty status does not
+	// filter. Limit specifies how many are returned.
+	FindWebhookDeliveries(webhookID int64, status DeliveryStatus, afterID int64, limit int) ([]WebhookDelivery, error)
+
+	// RetryWebhookDelivery queues a dead delivery to be attempted again. ErrWebhookNotFound or ErrDeliveryNotDead is
+	// returned if it cannot be retried.
+	RetryWebhookDelivery(webhookID int64, deliveryID int64) error
+
+	// FindWebhookAttempts finds the log of the attempts to deliver to the webhook, oldest first, after the ID. Limit
+	// specifies how many are returned.
+	FindWebhookAttempts(webhookID int64, afterID int64, limit int) ([]WebhookAttempt, error)
+
+	// ClaimWebhookDeliveries claims the pending deliveries due by now, oldest first. Claimed deliveries are not claimed
+	// again until the lease expires, so a delivery is retried if its attempt is never recorded. Limit specifies how
+	// many are claimed.
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+
+	// RecordWebhookAttempt records the attempt in the delivery log and updates the delivery to its status, attempts,
+	// next attempt and last error.
+	RecordWebhookAttempt(delivery WebhookDelivery, attempt WebhookAttempt) error
+}
+
+// enqueueWebhooks queues the deliveries of the events to the webhooks subscribed to their event and rating within the
+// transaction of the changes.
+func enqueueWebhooks(tx *sql.Tx, events []feedbackEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	selects := make([]string, len(events))
+	args := make([]interface{}, 0, 1+len(events)*3)
+	args = append(args, time.Now().UTC())
+	for i, event := range events {
+		selects[i] = "SELECT ? AS `event`, ? AS `rating`, ? AS `payload`"
+		args = append(args, event.event, event.rating, event.payload)
+	}
+	_, err := tx.Exec("INSERT INTO webhook_deliveries(`webhookID`, `event`, `payload`, `nextAttempt`) "+
+		"SELECT w.`id`, e.`event`, e.`payload`, ? FROM webhooks w JOIN ("+strings.Join(selects, " UNION ALL ")+") e "+
+		"ON FIND_IN_SET(e.`event`, w.`events`) AND e.`rating` BETWEEN w.`minRating` AND w.`maxRating`", args...)
+	if err != nil {
+		return fmt.Errorf("failed to queue the webhooks: %w", err)
+	}
+	return nil
+}
+
+// InsertWebhook inserts the webhook with its events stored as a comma separated list.
+func (d MySQL) InsertWebhook(webhook model.Webhook) (model.Webhook, error) {
+	webhook.Date = model.NormalizeDate(webhook.Date)
+	result, err := d.DB.Exec("INSERT INTO webhooks(`url`, `events`, `minRating`, `maxRating`, `secret`, `date`) "+
+		"VALUES (?,?,?,?,?,?)", webhook.URL, joinEvents(webhook.Events), webhook.MinRating, webhook.MaxRating,
+		webhook.Secret, webhook.Date)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to insert the webhook: %w", err)
+	}
+	if webhook.ID, err = result.LastInsertId(); err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to read the ID of the inserted webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// FindWebhooks finds every webhook, oldest first.
+func (d MySQL) FindWebhooks() ([]model.Webhook, error) {
+	rows, err := d.DB.Query("SELECT `id`, `url`, `events`, `minRating`, `maxRating`, `date` FROM webhooks ORDER BY `id`")
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	var webhooks []model.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// FindWebhookByID finds the webhook with the ID.
+func (d MySQL) FindWebhookByID(id int64) (model.Webhook, error) {
+	row := d.DB.QueryRow("SELECT `id`, `url`, `events`, `minRating`, `maxRating`, `date` FROM webhooks WHERE id=?", id)
+	webhook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Webhook{}, ErrWebhookNotFound
+	} else if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to find webhook %d: %w", id, err)
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook deletes the webhook, its deliveries and their log in a single transaction.
+func (d MySQL) DeleteWebhook(id int64) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id=?", id)
+	if err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to delete webhook %d: %w", id, err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to read the deleted webhooks: %w", err)
+	} else if deleted == 0 {
+		rollback(tx)
+		return ErrWebhookNotFound
+	}
+	for _, table := range []string{"webhook_deliveries", "webhook_attempts"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE webhookID=?", id); err != nil {
+			rollback(tx)
+			return fmt.Errorf("failed to delete the %s of webhook %d: %w", table, id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// FindWebhookDeliveries finds the deliveries of the webhook with the status, oldest first. Results are limited.
+func (d MySQL) FindWebhookDeliveries(webhookID int64, status DeliveryStatus, afterID int64,
+	limit int) ([]WebhookDelivery, error) {
+	conditions := []string{"webhookID=?", "id>?"}
+	args := []interface{}{webhookID, afterID}
+	if len(status) > 0 {
+		conditions = append(conditions, "status=?")
+		args = append(args, status)
+	}
+	rows, err := d.DB.Query(fmt.Sprintf("SELECT `id`, `webhookID`, `event`, `payload`, `status`, `attempts`, "+
+		"`nextAttempt`, `lastError`, `date` FROM webhook_deliveries WHERE %s ORDER BY `id` LIMIT %d",
+		strings.Join(conditions, " AND "), limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttempt, &delivery.LastError, &delivery.Date); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryWebhookDelivery resets the attempts of the dead delivery and queues it to be attempted now.
+func (d MySQL) RetryWebhookDelivery(webhookID int64, deliveryID int64) error {
+	result, err := d.DB.Exec("UPDATE webhook_deliveries SET `status`=?, `attempts`=0, `nextAttempt`=? "+
+		"WHERE id=? AND webhookID=? AND status=?", DeliveryPending, time.Now().UTC(), deliveryID, webhookID,
+		DeliveryDead)
+	if err != nil {
+		return fmt.Errorf("failed to retry delivery %d: %w", deliveryID, err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to read the retried deliveries: %w", err)
+	} else if updated > 0 {
+		return nil
+	}
+	//
+	// Nothing was retried, either the delivery does not exist or it is not dead
+	//
+	var exists bool
+	if err := d.DB.QueryRow("SELECT EXISTS(SELECT * FROM webhook_deliveries WHERE id=? AND webhookID=?)", deliveryID,
+		webhookID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to find delivery %d: %w", deliveryID, err)
+	} else if !exists {
+		return ErrWebhookNotFound
+	}
+	return ErrDeliveryNotDead
+}
+
+// FindWebhookAttempts finds the delivery log of the webhook, oldest first. Results are limited.
+func (d MySQL) FindWebhookAttempts(webhookID int64, afterID int64, limit int) ([]WebhookAttempt, error) {
+	rows, err := d.DB.Query(fmt.Sprintf("SELECT `id`, `deliveryID`, `webhookID`, `attempt`, `statusCode`, `error`, "+
+		"`durationMs`, `date` FROM webhook_attempts WHERE webhookID=? AND id>? ORDER BY `id` LIMIT %d", limit),
+		webhookID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+	var attempts []WebhookAttempt
+	for rows.Next() {
+		var attempt WebhookAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.DeliveryID, &attempt.WebhookID, &attempt.Attempt,
+			&attempt.StatusCode, &attempt.Error, &attempt.DurationMs, &attempt.Date); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// ClaimWebhookDeliveries locks the pending deliveries that are due and pushes their next attempt back by the lease, so
+// other instances of the application do not claim them as well.
+func (d MySQL) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	now = now.UTC()
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT d.`id`, d.`webhookID`, d.`event`, d.`payload`, d.`attempts`, "+
+		"d.`date`, w.`url`, w.`secret` FROM webhook_deliveries d JOIN webhooks w ON w.`id`=d.`webhookID` "+
+		"WHERE d.`status`=? AND d.`nextAttempt`<=? ORDER BY d.`nextAttempt`, d.`id` LIMIT %d FOR UPDATE", limit),
+		DeliveryPending, now)
+	if err != nil {
+		rollback(tx)
+		return nil, fmt.Errorf("failed to find the pending deliveries: %w", err)
+	}
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		delivery := WebhookDelivery{Status: DeliveryPending, NextAttempt: now.Add(lease)}
+		var payload string
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Attempts,
+			&delivery.Date, &delivery.URL, &delivery.Secret); err != nil {
+			closeRows(rows)
+			rollback(tx)
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	closeRows(rows)
+	if err := rows.Err(); err != nil {
+		rollback(tx)
+		return nil, fmt.Errorf("failed to read the pending deliveries: %w", err)
+	}
+	if len(deliveries) == 0 {
+		rollback(tx)
+		return nil, nil
+	}
+	placeholders := make([]string, len(deliveries))
+	args := []interface{}{now.Add(lease)}
+	for i, delivery := range deliveries {
+		placeholders[i] = "?"
+		args = append(args, delivery.ID)
+	}
+	if _, err := tx.Exec("UPDATE webhook_deliveries SET `nextAttempt`=? WHERE id IN ("+
+		strings.Join(placeholders, ",")+")", args...); err != nil {
+		rollback(tx)
+		return nil, fmt.Errorf("failed to claim the pending deliveries: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt logs the attempt and updates the delivery in a single transaction.
+func (d MySQL) RecordWebhookAttempt(delivery WebhookDelivery, attempt WebhookAttempt) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO webhook_attempts(`deliveryID`, `webhookID`, `attempt`, `statusCode`, `error`, "+
+		"`durationMs`, `date`) VALUES (?,?,?,?,?,?,?)", delivery.ID, delivery.WebhookID, attempt.Attempt,
+		attempt.StatusCode, truncate(attempt.Error, maxWebhookErrorLength), attempt.DurationMs,
+		attempt.Date.UTC()); err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to log the attempt of delivery %d: %w", delivery.ID, err)
+	}
+	if _, err := tx.Exec("UPDATE webhook_deliveries SET `status`=?, `attempts`=?, `nextAttempt`=?, `lastError`=? "+
+		"WHERE id=?", delivery.Status, delivery.Attempts, delivery.NextAttempt.UTC(),
+		truncate(delivery.LastError, maxWebhookErrorLength), delivery.ID); err != nil {
+		rollback(tx)
+		return fmt.Errorf("failed to update delivery %d: %w", delivery.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// maxWebhookErrorLength is how many characters of the error of an attempt are stored.
+const maxWebhookErrorLength = 1024
+
+func truncate(value string, length int) string {
+	if runes := []rune(value); len(runes) > length {
+		return string(runes[:length])
+	}
+	return value
+}
+
+func scanWebhook(row scanner) (model.Webhook, error) {
+	var webhook model.Webhook
+	var events string
+	if err := row.Scan(&webhook.ID, &webhook.URL, &events, &webhook.MinRating, &webhook.MaxRating,
+		&webhook.Date); err != nil {
+		return model.Webhook{}, err
+	}
+	for _, event := range strings.Split(events, ",") {
+		webhook.Events = append(webhook.Events, model.WebhookEvent(event))
+	}
+	return webhook, nil
+}
+
+func joinEvents(events []model.WebhookEvent) string {
+	values := make([]string, len(events))
+	for i, event := range events {
+		values[i] = string(event)
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,252 @@
+package db_test
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"testing"
+	"time"
+)
+
+func TestMySQL_InsertWebhook(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectExec("INSERT INTO webhooks*").
+		WithArgs("https://example.com/hook", "feedback.created,feedback.deleted", 1, 2, "secret", anyTime{}).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	//
+	// Run the test
+	//
+	webhook, insertError := mySQL.InsertWebhook(model.Webhook{URL: "https://example.com/hook",
+		Events: []model.WebhookEvent{model.EventCreated, model.EventDeleted}, MinRating: 1, MaxRating: 2,
+		Secret: "secret", Date: time.Now()})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if insertError != nil {
+		t.Errorf("unexpected error occurred: %v", insertError)
+	} else if webhook.ID != 7 {
+		t.Errorf("expected the ID of the inserted webhook but got %d", webhook.ID)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_FindWebhookByID(t *testing.T) {
+	tests := []struct {
+		name          string
+		rows          *sqlmock.Rows
+		expectedError error
+	}{
+		{
+			name: "Found",
+			rows: sqlmock.NewRows([]string{"id", "url", "events", "minRating", "maxRating", "date"}).
+				AddRow(7, "https://example.com/hook", "feedback.created,feedback.moderated", 1, 5, time.Now()),
+		},
+		{
+			name:          "Not Found",
+			rows:          sqlmock.NewRows([]string{"id", "url", "events", "minRating", "maxRating", "date"}),
+			expectedError: db.ErrWebhookNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//
+			// Mock the SQL DB
+			//
+			mySQL, mock := createMockDB(t)
+			defer mySQL.Close()
+			//
+			// Setup Mocks
+			//
+			mock.ExpectQuery("SELECT `id`, `url`, `events`, `minRating`, `maxRating`, `date` FROM webhooks*").
+				WithArgs(7).
+				WillReturnRows(test.rows)
+			//
+			// Run the test
+			//
+			webhook, findError := mySQL.FindWebhookByID(7)
+			//
+			// Ensure expectations were met
+			//
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations %v", err)
+			} else if !errors.Is(findError, test.expectedError) {
+				t.Errorf("expected error %v but got %v", test.expectedError, findError)
+			} else if test.expectedError == nil && (len(webhook.Events) != 2 ||
+				webhook.Events[1] != model.EventModerated || len(webhook.Secret) > 0) {
+				t.Errorf("unexpected webhook %+v", webhook)
+			}
+			mock.ExpectClose()
+		})
+	}
+}
+
+func TestMySQL_DeleteWebhook(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM webhooks WHERE id=\\?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM webhook_deliveries WHERE webhookID=\\?").WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM webhook_attempts WHERE webhookID=\\?").WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM webhooks WHERE id=\\?").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	//
+	// Run the test
+	//
+	deleteError := mySQL.DeleteWebhook(7)
+	missingError := mySQL.DeleteWebhook(8)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if deleteError != nil {
+		t.Errorf("unexpected error occurred: %v", deleteError)
+	} else if !errors.Is(missingError, db.ErrWebhookNotFound) {
+		t.Errorf("expected the webhook to not be found but got %v", missingError)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_RetryWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name          string
+		updated       int64
+		exists        bool
+		expectedError error
+	}{
+		{name: "Retried", updated: 1},
+		{name: "Not Dead", exists: true, expectedError: db.ErrDeliveryNotDead},
+		{name: "Not Found", expectedError: db.ErrWebhookNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//
+			// Mock the SQL DB
+			//
+			mySQL, mock := createMockDB(t)
+			defer mySQL.Close()
+			//
+			// Setup Mocks
+			//
+			mock.ExpectExec("UPDATE webhook_deliveries SET `status`=\\?, `attempts`=0*").
+				WithArgs("pending", anyTime{}, 3, 7, "dead").
+				WillReturnResult(sqlmock.NewResult(0, test.updated))
+			if test.updated == 0 {
+				mock.ExpectQuery("SELECT EXISTS*").
+					WithArgs(3, 7).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(test.exists))
+			}
+			//
+			// Run the test
+			//
+			retryError := mySQL.RetryWebhookDelivery(7, 3)
+			//
+			// Ensure expectations were met
+			//
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations %v", err)
+			} else if !errors.Is(retryError, test.expectedError) {
+				t.Errorf("expected error %v but got %v", test.expectedError, retryError)
+			}
+			mock.ExpectClose()
+		})
+	}
+}
+
+func TestMySQL_ClaimWebhookDeliveries(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	now := time.Now()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT d.`id`, d.`webhookID`, d.`event`, d.`payload`, d.`attempts`, d.`date`, w.`url`, "+
+		"w.`secret` FROM webhook_deliveries d JOIN webhooks w*").
+		WithArgs("pending", anyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhookID", "event", "payload", "attempts", "date", "url",
+			"secret"}).
+			AddRow(3, 7, "feedback.created", `{"event":"feedback.created"}`, 0, now, "https://example.com/hook", "s").
+			AddRow(4, 7, "feedback.deleted", `{"event":"feedback.deleted"}`, 2, now, "https://example.com/hook", "s"))
+	mock.ExpectExec("UPDATE webhook_deliveries SET `nextAttempt`=\\? WHERE id IN \\(\\?,\\?\\)").
+		WithArgs(anyTime{}, 3, 4).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	deliveries, claimError := mySQL.ClaimWebhookDeliveries(now, time.Minute, 10)
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if claimError != nil {
+		t.Errorf("unexpected error occurred: %v", claimError)
+	} else if len(deliveries) != 2 || deliveries[1].Attempts != 2 || deliveries[1].URL != "https://example.com/hook" ||
+		string(deliveries[1].Payload) != `{"event":"feedback.deleted"}` {
+		t.Errorf("unexpected deliveries %+v", deliveries)
+	} else if !deliveries[0].NextAttempt.Equal(now.UTC().Add(time.Minute)) {
+		t.Errorf("expected the delivery to be leased until %v but got %v", now.Add(time.Minute),
+			deliveries[0].NextAttempt)
+	}
+	mock.ExpectClose()
+}
+
+func TestMySQL_RecordWebhookAttempt(t *testing.T) {
+	//
+	// Mock the SQL DB
+	//
+	mySQL, mock := createMockDB(t)
+	defer mySQL.Close()
+	//
+	// Setup Mocks
+	//
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO webhook_attempts*").
+		WithArgs(3, 7, 2, 500, "webhook responded with 500", 12, anyTime{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE webhook_deliveries SET `status`=\\?, `attempts`=\\?, `nextAttempt`=\\?, `lastError`=\\?*").
+		WithArgs("pending", 2, anyTime{}, "webhook responded with 500", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	//
+	// Run the test
+	//
+	recordError := mySQL.RecordWebhookAttempt(db.WebhookDelivery{ID: 3, WebhookID: 7, Status: db.DeliveryPending,
+		Attempts: 2, NextAttempt: time.Now(), LastError: "webhook responded with 500"},
+		db.WebhookAttempt{Attempt: 2, StatusCode: 500, Error: "webhook responded with 500", DurationMs: 12,
+			Date: time.Now()})
+	//
+	// Ensure expectations were met
+	//
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations %v", err)
+	} else if recordError != nil {
+		t.Errorf("unexpected error occurred: %v", recordError)
+	}
+	mock.ExpectClose()
+}
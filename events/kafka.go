@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderEvent is the header with the event, e.g. feedback.created.
+	HeaderEvent = "Feedback-Event"
+	// HeaderEventID is the header with the ID of the event. It is the same every time the event is published so
+	// consumers can ignore duplicates.
+	HeaderEventID = "Feedback-Event-Id"
+	// HeaderSession is the header with the session of the feedback of the event.
+	HeaderSession = "Feedback-Session"
+)
+
+// Kafka publishes the events to a Kafka topic. The events are keyed by their session so the events of a session are
+// written to the same partition, in order.
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a publisher to the topic of the Kafka brokers. Events are acknowledged once every in-sync replica
+// has written them.
+func NewKafka(brokers []string, topic string, timeout time.Duration) *Kafka {
+	return &Kafka{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		//
+		// The relay writes batches synchronously, there is no point waiting on more events to fill a batch
+		//
+		BatchTimeout: time.Millisecond,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}}
+}
+
+// Publish writes the events to the topic in a single call.
+func (k *Kafka) Publish(ctx context.Context, events []db.Event) error {
+	messages := make([]kafka.Message, len(events))
+	for i, event := range events {
+		messages[i] = kafka.Message{
+			Key:   []byte(event.SessionID),
+			Value: event.Payload,
+			Headers: []kafka.Header{
+				{Key: HeaderEvent, Value: []byte(event.Event)},
+				{Key: HeaderEventID, Value: []byte(strconv.FormatInt(event.ID, 10))},
+				{Key: HeaderSession, Value: []byte(event.SessionID)},
+			},
+			Time: event.Date,
+		}
+	}
+	if err := k.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to write to Kafka: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
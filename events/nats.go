@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/nats-io/nats.go"
+	"strconv"
+	"time"
+)
+
+// NATS publishes the events to a subject of a NATS JetStream stream. The stream has to exist and capture the subject.
+// Events are published one at a time, waiting on the stream to acknowledge each, so the events of a session are stored
+// in order. The ID of the event is the message ID so the stream drops events published again within its duplicate
+// window.
+type NATS struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+	timeout time.Duration
+}
+
+// NewNATS connects to the NATS server at the URL.
+func NewNATS(url string, subject string, timeout time.Duration) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("feedback-service"), nats.Timeout(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to use JetStream: %w", err)
+	}
+	return &NATS{conn: conn, js: js, subject: subject, timeout: timeout}, nil
+}
+
+// Publish publishes the events in order, stopping at the first that is not acknowledged.
+func (n *NATS) Publish(ctx context.Context, events []db.Event) error {
+	for _, event := range events {
+		id := strconv.FormatInt(event.ID, 10)
+		message := nats.NewMsg(n.subject)
+		message.Data = event.Payload
+		message.Header.Set(HeaderEvent, string(event.Event))
+		message.Header.Set(HeaderEventID, id)
+		message.Header.Set(HeaderSession, event.SessionID)
+		publishCtx, cancel := context.WithTimeout(ctx, n.timeout)
+		_, err := n.js.PublishMsg(message, nats.MsgId(id), nats.Context(publishCtx))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to publish event %d to NATS: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// Close drains the connection to the server.
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
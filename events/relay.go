@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"log"
+	"time"
+)
+
+// Publisher publishes events to a message broker.
+type Publisher interface {
+	// Publish publishes the events in the order provided. An error is returned unless the broker acknowledged every
+	// event, in which case the events are published again.
+	Publish(ctx context.Context, events []db.Event) error
+
+	// Close flushes the events being published and closes the connection to the broker.
+	Close() error
+}
+
+// Relay publishes the events written to the outbox. An event is only deleted from the outbox once it is published, so
+// it is published at least once. Only a single relay, across every instance of the application, publishes at a time
+// and the events are published in the order they were written, so the events of a session stay in order.
+type Relay struct {
+	Store     db.EventStore
+	Publisher Publisher
+	// BatchSize is how many events are published at once.
+	BatchSize int
+	// PollInterval is how often the outbox is checked for events.
+	PollInterval time.Duration
+}
+
+// Run publishes the events every poll interval until the context is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Relay(ctx); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// Relay publishes the events in the outbox, a batch at a time, until it is empty. Nothing is published if another
+// relay holds the lock of the outbox. How many events were published is returned.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	unlock, locked, err := r.Store.LockEvents(ctx)
+	if err != nil {
+		return 0, err
+	} else if !locked {
+		return 0, nil
+	}
+	defer unlock()
+	published := 0
+	for ctx.Err() == nil {
+		events, err := r.Store.FindEvents(r.BatchSize)
+		if err != nil {
+			return published, fmt.Errorf("failed to find the events: %w", err)
+		} else if len(events) == 0 {
+			break
+		}
+		//
+		// A batch that fails is published again, from its first event, so no event of a session overtakes another
+		//
+		if err := r.Publisher.Publish(ctx, events); err != nil {
+			return published, fmt.Errorf("failed to publish the events: %w", err)
+		}
+		ids := make([]int64, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		if err := r.Store.DeleteEvents(ids); err != nil {
+			return published, err
+		}
+		published += len(events)
+		if len(events) < r.BatchSize {
+			break
+		}
+	}
+	return published, nil
+}
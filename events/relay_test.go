@@ -0,0 +1,123 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/events"
+	"testing"
+)
+
+// mockStore is an outbox in memory.
+type mockStore struct {
+	lockedByOther bool
+	unlocked      bool
+	events        []db.Event
+}
+
+func (m *mockStore) LockEvents(ctx context.Context) (func(), bool, error) {
+	if m.lockedByOther {
+		return nil, false, nil
+	}
+	return func() { m.unlocked = true }, true, nil
+}
+
+func (m *mockStore) FindEvents(limit int) ([]db.Event, error) {
+	if len(m.events) < limit {
+		limit = len(m.events)
+	}
+	return append([]db.Event(nil), m.events[:limit]...), nil
+}
+
+func (m *mockStore) DeleteEvents(ids []int64) error {
+	deleted := make(map[int64]bool)
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	var remaining []db.Event
+	for _, event := range m.events {
+		if !deleted[event.ID] {
+			remaining = append(remaining, event)
+		}
+	}
+	m.events = remaining
+	return nil
+}
+
+// failingPublisher fails to publish after publishing a number of batches.
+type failingPublisher struct {
+	batches int
+}
+
+func (f *failingPublisher) Publish(ctx context.Context, events []db.Event) error {
+	if f.batches == 0 {
+		return errors.New("broker unavailable")
+	}
+	f.batches--
+	return nil
+}
+
+func (f *failingPublisher) Close() error {
+	return nil
+}
+
+func newEvents(count int) []db.Event {
+	outbox := make([]db.Event, count)
+	for i := range outbox {
+		outbox[i] = db.Event{ID: int64(i + 1), SessionID: "987", Event: "feedback.created", Payload: []byte("{}")}
+	}
+	return outbox
+}
+
+func TestRelay_Relay(t *testing.T) {
+	store := &mockStore{events: newEvents(5)}
+	var out bytes.Buffer
+	relay := events.Relay{Store: store, Publisher: events.NewWriter(&out), BatchSize: 2}
+	published, err := relay.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error occurred: %v", err)
+	} else if published != 5 || len(store.events) != 0 || !store.unlocked {
+		t.Errorf("expected every event to be published but published %d, %d remain", published, len(store.events))
+	}
+	//
+	// The events are written in order, one per line
+	//
+	decoder := json.NewDecoder(&out)
+	for id := int64(1); id <= 5; id++ {
+		var event db.Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("failed to decode event %d: %v", id, err)
+		} else if event.ID != id || event.SessionID != "987" {
+			t.Errorf("expected event %d but got %+v", id, event)
+		}
+	}
+}
+
+func TestRelay_Relay_PublishError(t *testing.T) {
+	store := &mockStore{events: newEvents(5)}
+	relay := events.Relay{Store: store, Publisher: &failingPublisher{batches: 1}, BatchSize: 2}
+	published, err := relay.Relay(context.Background())
+	if err == nil {
+		t.Fatal("expected the failed publish to be returned")
+	}
+	//
+	// The failed batch stays in the outbox, from its first event, to be published again
+	//
+	if published != 2 || len(store.events) != 3 || store.events[0].ID != 3 || !store.unlocked {
+		t.Errorf("expected the first batch to be published but published %d, remaining %+v", published, store.events)
+	}
+}
+
+func TestRelay_Relay_LockedByOther(t *testing.T) {
+	store := &mockStore{lockedByOther: true, events: newEvents(5)}
+	var out bytes.Buffer
+	relay := events.Relay{Store: store, Publisher: events.NewWriter(&out), BatchSize: 2}
+	published, err := relay.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error occurred: %v", err)
+	} else if published != 0 || len(store.events) != 5 || out.Len() > 0 {
+		t.Errorf("expected nothing to be published while another relay holds the lock but published %d", published)
+	}
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"io"
+	"os"
+	"sync"
+)
+
+// Writer writes the events as JSON lines, e.g. to stdout or a file, to run the application locally without a message
+// broker.
+type Writer struct {
+	mu     sync.Mutex
+	writer io.Writer
+	file   *os.File
+}
+
+// NewWriter creates a publisher writing to the writer.
+func NewWriter(writer io.Writer) *Writer {
+	return &Writer{writer: writer}
+}
+
+// NewFile creates a publisher appending to the file at the path, created if it does not exist. The events are written
+// to stdout when the path is '-'.
+func NewFile(path string) (*Writer, error) {
+	if path == "-" {
+		return NewWriter(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the events file %s: %w", path, err)
+	}
+	return &Writer{writer: file, file: file}, nil
+}
+
+// Publish writes each event on its own line. Events written to a file are synced to disk before returning.
+func (w *Writer) Publish(ctx context.Context, events []db.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	encoder := json.NewEncoder(w.writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write event %d: %w", event.ID, err)
+		}
+	}
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync the events file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the file. Nothing is closed when writing to stdout or a provided writer.
+func (w *Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,50 @@
+package feedback
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDuplicate is the kind of error returned when a user has already submitted feedback for a session.
+	ErrDuplicate = errors.New("feedback already submitted")
+	// ErrInvalidRating is the kind of error returned when a rating is not within the allowed range.
+	ErrInvalidRating = errors.New("invalid rating")
+	// ErrInvalidComment is the kind of error returned when a comment is longer than allowed.
+	ErrInvalidComment = errors.New("invalid comment")
+	// ErrRejected is the kind of error returned when moderation rejects a comment.
+	ErrRejected = errors.New("comment rejected")
+	// ErrInvalidDate is the kind of error returned when feedback is dated outside the allowed window.
+	ErrInvalidDate = errors.New("invalid date")
+	// ErrNotFound is the kind of error returned when feedback does not exist or is not shown to the user.
+	ErrNotFound = errors.New("feedback not found")
+	// ErrInvalidSession is the kind of error returned when feedback is not for a session.
+	ErrInvalidSession = errors.New("invalid session")
+	// ErrForbidden is the kind of error returned when a user changes feedback of someone else.
+	ErrForbidden = errors.New("feedback of another user")
+	// ErrChanged is the kind of error returned when feedback changed since the version a change was based on.
+	ErrChanged = errors.New("feedback changed")
+	// ErrDuplicateReport is the kind of error returned when a user has already reported a feedback.
+	ErrDuplicateReport = errors.New("feedback already reported")
+)
+
+// Error is a business rule the feedback broke. Its kind is one of the errors of the package, so callers can tell the
+// rules apart with errors.Is, and its reason explains it to the user.
+type Error struct {
+	Kind   error
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+// Unwrap provides the kind of the error.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// newError creates an error of the kind with the formatted reason.
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,386 @@
+// Package feedback applies the business rules of the feedback users provide for sessions. The rules are shared by every
+// API, and anything else submitting feedback, so feedback is validated the same way however it is submitted.
+package feedback
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"strings"
+	"time"
+)
+
+const (
+	// ListLimit is how many of the most recent feedback of a session are listed.
+	ListLimit = 15
+	// occurredAtSkew is how far in the future feedback can be dated, allowing for clock differences.
+	occurredAtSkew = time.Minute
+)
+
+// Service submits and reads feedback on top of the DB.
+type Service struct {
+	DB db.DB
+	// Moderator moderates the comments of feedback. Comments are not moderated when nil.
+	Moderator moderation.Moderator
+	// Broker streams the submitted feedback to the clients watching its session, along with the feedback that is no
+	// longer shown. Feedback is not streamed when nil.
+	Broker *pubsub.Broker
+	// OccurredAtWindow is how far in the past feedback can be dated.
+	OccurredAtWindow time.Duration
+}
+
+// Submission is the feedback a user submits for a session.
+type Submission struct {
+	UserID    string
+	SessionID string
+	Comment   string
+	Rating    int8
+	// OccurredAt is when the feedback occurred, now when nil. Only trusted callers should be allowed to provide it.
+	OccurredAt *time.Time
+}
+
+// Submit validates, moderates and inserts the feedback of a user for a session, then streams it to the clients watching
+// the session unless it awaits review. The feedback is returned as it was stored. An Error of kind ErrDuplicate,
+// ErrInvalidRating, ErrInvalidComment, ErrRejected or ErrInvalidDate is returned if the feedback breaks a rule.
+func (s *Service) Submit(submission Submission) (model.Feedback, error) {
+	userID := submission.UserID
+	sessionID := submission.SessionID
+	//
+	// Check if user has already submitted feedback for the session
+	//
+	exists, err := s.DB.Exists(userID, sessionID)
+	if err != nil {
+		return model.Feedback{}, fmt.Errorf(
+			"failed to check if user %s has previously submitted feedback for session %s: %w", userID, sessionID, err)
+	}
+	if exists {
+		return model.Feedback{}, newError(ErrDuplicate, "User %s has already submitted feedback for session %s", userID,
+			sessionID)
+	}
+	feedback := model.Feedback{UserID: userID, SessionID: sessionID, Comment: submission.Comment,
+		Rating: submission.Rating}
+	if !model.ValidRating(feedback.Rating) {
+		return model.Feedback{}, newError(ErrInvalidRating,
+			"User %s submitted rating %d is not within the allowed range of %d-%d for session %s", userID,
+			feedback.Rating, model.MinRating, model.MaxRating, sessionID)
+	}
+	if !model.ValidComment(feedback.Comment) {
+		return model.Feedback{}, newError(ErrInvalidComment,
+			"User %s submitted comment is longer than %d characters for session %s", userID, model.MaxCommentLength,
+			sessionID)
+	}
+	//
+	// Moderate the comment, it may be masked or held for review
+	//
+	if reason, ok := s.moderate(&feedback); !ok {
+		return model.Feedback{}, newError(ErrRejected, "User %s submitted comment was rejected for session %s: %s",
+			userID, sessionID, reason)
+	}
+	//
+	// The feedback occurred now unless the submission says otherwise
+	//
+	now := model.NormalizeDate(time.Now())
+	feedback.Date = now
+	if submission.OccurredAt != nil {
+		occurredAt := model.NormalizeDate(*submission.OccurredAt)
+		if occurredAt.Before(now.Add(-s.OccurredAtWindow)) || occurredAt.After(now.Add(occurredAtSkew)) {
+			return model.Feedback{}, newError(ErrInvalidDate,
+				"User %s feedback for session %s must have occurred within the last %s", userID, sessionID,
+				s.OccurredAtWindow)
+		}
+		feedback.Date = occurredAt
+	}
+	//
+	// A feedback submitted concurrently by the user is only caught by the DB
+	//
+	feedback, err = s.DB.Insert(feedback)
+	if errors.Is(err, db.ErrDuplicate) {
+		return model.Feedback{}, newError(ErrDuplicate, "User %s has already submitted feedback for session %s", userID,
+			sessionID)
+	} else if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to insert user %s feedback for session %s: %w", userID, sessionID,
+			err)
+	}
+	//
+	// Stream the feedback to the clients watching the session, unless it awaits review
+	//
+	s.publish(feedback)
+	return feedback, nil
+}
+
+// Outcome is the outcome of a single feedback of a batch.
+type Outcome struct {
+	// Feedback is the feedback as it was stored, when it was inserted.
+	Feedback model.Feedback
+	// Err is why the feedback was not inserted.
+	Err error
+}
+
+// SubmitBatch validates, moderates and inserts the feedback of a user for several sessions at once, then streams the
+// inserted feedback like Submit. The valid feedback is inserted in a single transaction, all of it dated now. The
+// outcome of each feedback is returned in the order provided, with an Error of kind ErrInvalidSession,
+// ErrInvalidRating, ErrInvalidComment, ErrRejected or ErrDuplicate for the feedback that was not inserted.
+func (s *Service) SubmitBatch(userID string, batch []model.Feedback) ([]Outcome, error) {
+	outcomes := make([]Outcome, len(batch))
+	valid := make([]model.Feedback, 0, len(batch))
+	validIndexes := make([]int, 0, len(batch))
+	now := model.NormalizeDate(time.Now())
+	for i, feedback := range batch {
+		if len(strings.TrimSpace(feedback.SessionID)) == 0 {
+			outcomes[i].Err = newError(ErrInvalidSession, "Missing sessionId")
+			continue
+		} else if err := s.Validate(feedback); err != nil {
+			outcomes[i].Err = err
+			continue
+		} else if err := s.Moderate(&feedback); err != nil {
+			outcomes[i].Err = err
+			continue
+		}
+		feedback.ID = 0
+		feedback.UserID = userID
+		feedback.Date = now
+		valid = append(valid, feedback)
+		validIndexes = append(validIndexes, i)
+	}
+	inserted, err := s.DB.InsertBatch(valid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user %s feedback batch: %w", userID, err)
+	}
+	for i, index := range validIndexes {
+		if inserted[i].ID == 0 {
+			outcomes[index].Err = newError(ErrDuplicate, "User %s has already submitted feedback for session %s",
+				userID, valid[i].SessionID)
+			continue
+		}
+		outcomes[index].Feedback = inserted[i]
+		s.publish(inserted[i])
+	}
+	return outcomes, nil
+}
+
+// Change is a change a user makes to their feedback. The comment and rating are left as is when nil.
+type Change struct {
+	UserID    string
+	SessionID string
+	ID        int32
+	// Matches checks whether the change is based on the version of the feedback, any version matches when nil.
+	Matches func(version int32) bool
+	Comment *string
+	Rating  *int8
+}
+
+// Update changes the comment and rating of the feedback of a user. A changed comment is moderated again, feedback an
+// operator rejected is held for review again rather than approved and hidden feedback stays hidden. The feedback is
+// returned with its new version. An Error of kind ErrNotFound, ErrForbidden, ErrInvalidRating, ErrInvalidComment or
+// ErrRejected is returned if the change breaks a rule. An Error of kind ErrChanged is returned, along with the feedback
+// when it is known, if the feedback changed since the version the change is based on.
+func (s *Service) Update(change Change) (model.Feedback, error) {
+	feedback, err := s.findOwn(change.UserID, change.SessionID, change.ID, change.Matches)
+	if err != nil {
+		return feedback, err
+	}
+	commentChanged := change.Comment != nil && *change.Comment != feedback.Comment
+	if change.Comment != nil {
+		feedback.Comment = *change.Comment
+	}
+	if change.Rating != nil {
+		feedback.Rating = *change.Rating
+	}
+	if err := s.Validate(feedback); err != nil {
+		return model.Feedback{}, err
+	}
+	//
+	// A changed comment is moderated again. Feedback an operator rejected is reviewed again rather than approved and
+	// hidden feedback stays hidden
+	//
+	if commentChanged {
+		before := feedback
+		if err := s.Moderate(&feedback); err != nil {
+			return model.Feedback{}, err
+		}
+		if before.ModerationStatus == model.ModerationHidden {
+			feedback.ModerationStatus = before.ModerationStatus
+			feedback.ModerationReason = before.ModerationReason
+		} else if before.ModerationStatus == model.ModerationRejected &&
+			feedback.ModerationStatus == model.ModerationApproved {
+			feedback.ModerationStatus = model.ModerationFlagged
+			feedback.ModerationReason = "comment changed after it was rejected"
+		}
+	}
+	updated, err := s.DB.Update(feedback, feedback.Version)
+	if err != nil {
+		return model.Feedback{}, changeError(err, feedback)
+	}
+	return updated, nil
+}
+
+// Delete deletes the feedback of a user, returning the feedback that was deleted. An Error of kind ErrNotFound or
+// ErrForbidden is returned if the user cannot delete it, or of kind ErrChanged, along with the feedback when it is
+// known, if the feedback changed since the version the deletion is based on.
+func (s *Service) Delete(userID string, sessionID string, id int32, matches func(version int32) bool) (model.Feedback,
+	error) {
+	feedback, err := s.findOwn(userID, sessionID, id, matches)
+	if err != nil {
+		return feedback, err
+	}
+	if err := s.DB.Delete(sessionID, id, feedback.Version); err != nil {
+		return model.Feedback{}, changeError(err, feedback)
+	}
+	//
+	// Deleted feedback is streamed without a moderation status so clients stop showing it
+	//
+	deleted := feedback
+	deleted.Version++
+	deleted.ModerationStatus = ""
+	deleted.ModerationReason = ""
+	s.publishChange(feedback, deleted)
+	return feedback, nil
+}
+
+// Review sets the moderation status of a feedback, as decided by an operator, and streams the feedback to the clients
+// watching its session when it is shown or no longer shown because of it. An Error of kind ErrNotFound is returned if
+// the feedback does not exist.
+func (s *Service) Review(id int32, status model.ModerationStatus, reason string, actor string) (model.Feedback, error) {
+	change, err := s.DB.SetModerationStatus(id, status, reason, actor)
+	if errors.Is(err, db.ErrNotFound) {
+		return model.Feedback{}, newError(ErrNotFound, "Feedback %d does not exist", id)
+	} else if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to review feedback %d: %w", id, err)
+	}
+	s.publishChange(change.Before, change.After)
+	return change.After, nil
+}
+
+// Report records a user reporting a feedback, hiding it once the threshold of reports is reached. Feedback hidden by
+// the report is streamed to the clients watching its session so they stop showing it. An Error of kind ErrNotFound
+// or ErrDuplicateReport is returned if the feedback cannot be reported.
+func (s *Service) Report(report model.Report, threshold int) (db.ReportResult, error) {
+	result, err := s.DB.Report(report, threshold)
+	if errors.Is(err, db.ErrNotFound) {
+		return db.ReportResult{}, newError(ErrNotFound, "Feedback %d does not exist for session %s", report.FeedbackID,
+			report.SessionID)
+	} else if errors.Is(err, db.ErrDuplicateReport) {
+		return db.ReportResult{}, newError(ErrDuplicateReport, "User %s has already reported feedback %d",
+			report.ReporterID, report.FeedbackID)
+	} else if err != nil {
+		return db.ReportResult{}, fmt.Errorf("failed to record user %s report of feedback %d: %w", report.ReporterID,
+			report.FeedbackID, err)
+	}
+	if result.Hidden && s.Broker != nil {
+		s.Broker.Publish(result.Feedback)
+	}
+	return result, nil
+}
+
+// findOwn finds the feedback a user changes and checks the user can change its version.
+func (s *Service) findOwn(userID string, sessionID string, id int32, matches func(version int32) bool) (model.Feedback,
+	error) {
+	feedback, err := s.DB.FindByID(sessionID, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return model.Feedback{}, newError(ErrNotFound, "Feedback %d does not exist for session %s", id, sessionID)
+	} else if err != nil {
+		return model.Feedback{}, fmt.Errorf("failed to find feedback %d for session %s: %w", id, sessionID, err)
+	}
+	if feedback.UserID != userID {
+		return model.Feedback{}, newError(ErrForbidden, "User %s cannot change feedback %d for session %s", userID, id,
+			sessionID)
+	}
+	if matches != nil && !matches(feedback.Version) {
+		return feedback, newError(ErrChanged, "Feedback %d for session %s has changed since it was retrieved", id,
+			sessionID)
+	}
+	return feedback, nil
+}
+
+// changeError provides the error of a failed change to the feedback.
+func changeError(err error, feedback model.Feedback) error {
+	if errors.Is(err, db.ErrVersionMismatch) {
+		return newError(ErrChanged, "Feedback %d for session %s has changed since it was retrieved", feedback.ID,
+			feedback.SessionID)
+	} else if errors.Is(err, db.ErrNotFound) {
+		return newError(ErrNotFound, "Feedback %d does not exist for session %s", feedback.ID, feedback.SessionID)
+	}
+	return fmt.Errorf("failed to change feedback %d for session %s: %w", feedback.ID, feedback.SessionID, err)
+}
+
+// Get gets a single feedback of a session. Feedback that is not approved is only shown to the user that provided it, an
+// Error of kind ErrNotFound is returned to anyone else.
+func (s *Service) Get(sessionID string, id int32, userID string) (model.Feedback, error) {
+	feedback, err := s.DB.FindByID(sessionID, id)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !feedback.Visible() && feedback.UserID != userID) {
+		return model.Feedback{}, newError(ErrNotFound, "Feedback %d does not exist for session %s", id, sessionID)
+	}
+	return feedback, err
+}
+
+// List lists the most recent approved feedback of a session, only those matching the filter when it is provided.
+func (s *Service) List(sessionID string, filter db.Filter) ([]model.Feedback, error) {
+	if len(filter.Rating) > 0 {
+		return s.DB.FindWithFilter(sessionID, filter, db.Descending, ListLimit)
+	}
+	return s.DB.Find(sessionID, db.Descending, ListLimit)
+}
+
+// Summarize summarizes the approved feedback of a session.
+func (s *Service) Summarize(sessionID string) (db.Summary, error) {
+	return s.DB.Summarize(sessionID)
+}
+
+// Validate checks the rating and comment of the feedback. An Error of kind ErrInvalidRating or ErrInvalidComment is
+// returned if they are not allowed.
+func (s *Service) Validate(feedback model.Feedback) error {
+	if !model.ValidRating(feedback.Rating) {
+		return newError(ErrInvalidRating, "Rating %d is not within the allowed range of %d-%d", feedback.Rating,
+			model.MinRating, model.MaxRating)
+	} else if !model.ValidComment(feedback.Comment) {
+		return newError(ErrInvalidComment, "Comment is longer than %d characters", model.MaxCommentLength)
+	}
+	return nil
+}
+
+// Moderate moderates the comment of the feedback, masking it and setting its moderation status. An Error of kind
+// ErrRejected is returned when the comment is rejected.
+func (s *Service) Moderate(feedback *model.Feedback) error {
+	if reason, ok := s.moderate(feedback); !ok {
+		return newError(ErrRejected, "Comment was rejected: %s", reason)
+	}
+	return nil
+}
+
+// publish streams the feedback to the clients watching its session, unless it awaits review.
+func (s *Service) publish(feedback model.Feedback) {
+	if s.Broker != nil && feedback.Visible() {
+		s.Broker.Publish(feedback)
+	}
+}
+
+// publishChange streams the changed feedback to the clients watching its session when the change shows it, or stops
+// showing it. Feedback that is still shown, or still not shown, is not streamed again.
+func (s *Service) publishChange(before model.Feedback, after model.Feedback) {
+	if s.Broker != nil && before.Visible() != after.Visible() {
+		s.Broker.Publish(after)
+	}
+}
+
+// moderate moderates the comment of the feedback. The reason is returned along with false when the comment is rejected.
+func (s *Service) moderate(feedback *model.Feedback) (string, bool) {
+	feedback.ModerationStatus = model.ModerationApproved
+	feedback.ModerationReason = ""
+	if s.Moderator == nil {
+		return "", true
+	}
+	verdict := s.Moderator.Moderate(feedback.Comment)
+	reason := strings.Join(verdict.Reasons, "; ")
+	switch verdict.Action {
+	case moderation.Reject:
+		return reason, false
+	case moderation.Flag:
+		feedback.ModerationStatus = model.ModerationFlagged
+		feedback.ModerationReason = reason
+	}
+	feedback.Comment = verdict.Comment
+	return "", true
+}
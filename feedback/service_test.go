@@ -0,0 +1,538 @@
+package feedback_test
+
+import (
+	"errors"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockDB only implements the reads and writes of the service.
+type mockDB struct {
+	db.DB
+	existsError bool
+	exists      bool
+	insertError bool
+	duplicate   bool
+	findError   bool
+	duplicates  map[string]bool
+	feedbacks   []model.Feedback
+}
+
+func (m mockDB) Exists(userID string, sessionID string) (bool, error) {
+	if m.existsError {
+		return false, errors.New("failed to check existence")
+	}
+	return m.exists, nil
+}
+
+func (m mockDB) Insert(feedback model.Feedback) (model.Feedback, error) {
+	if m.insertError {
+		return model.Feedback{}, errors.New("failed to insert")
+	} else if m.duplicate {
+		return model.Feedback{}, db.ErrDuplicate
+	}
+	feedback.ID = 1
+	feedback.Version = 1
+	return feedback, nil
+}
+
+func (m mockDB) InsertBatch(feedback []model.Feedback) ([]model.Feedback, error) {
+	if m.insertError {
+		return nil, errors.New("failed to insert")
+	}
+	inserted := make([]model.Feedback, len(feedback))
+	for i, f := range feedback {
+		if !m.duplicates[f.SessionID] {
+			f.ID = int32(i + 1)
+			f.Version = 1
+			inserted[i] = f
+		}
+	}
+	return inserted, nil
+}
+
+func (m mockDB) Update(feedback model.Feedback, version int32) (model.Feedback, error) {
+	if m.insertError {
+		return model.Feedback{}, errors.New("failed to update")
+	}
+	feedback.Version = version + 1
+	return feedback, nil
+}
+
+func (m mockDB) Delete(sessionID string, id int32, version int32) error {
+	if m.insertError {
+		return db.ErrVersionMismatch
+	}
+	return nil
+}
+
+func (m mockDB) FindByID(sessionID string, id int32) (model.Feedback, error) {
+	if m.findError {
+		return model.Feedback{}, errors.New("failed to find feedback")
+	}
+	for _, f := range m.feedbacks {
+		if f.ID == id && f.SessionID == sessionID {
+			return f, nil
+		}
+	}
+	return model.Feedback{}, db.ErrNotFound
+}
+
+func TestService_Submit(t *testing.T) {
+	service := feedback.Service{DB: mockDB{}}
+	before := time.Now().Add(-time.Second)
+	submitted, err := service.Submit(feedback.Submission{UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Date.Location() != time.UTC || submitted.Date.Before(before) {
+		t.Errorf("expected the current date in UTC but got %s", submitted.Date)
+	} else if submitted.ID != 1 || submitted.UserID != "123" || submitted.SessionID != "987" || submitted.Rating != 4 ||
+		submitted.ModerationStatus != model.ModerationApproved {
+		t.Errorf("unexpected feedback %+v", submitted)
+	}
+}
+
+func TestService_Submit_Invalid(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             mockDB
+		moderator      moderation.Moderator
+		submission     feedback.Submission
+		expectedKind   error
+		expectedReason string
+	}{
+		{
+			name:           "Already Exists",
+			db:             mockDB{exists: true},
+			submission:     feedback.Submission{UserID: "123", SessionID: "987", Rating: 4},
+			expectedKind:   feedback.ErrDuplicate,
+			expectedReason: "User 123 has already submitted feedback for session 987",
+		},
+		{
+			name:           "Inserted Concurrently",
+			db:             mockDB{duplicate: true},
+			submission:     feedback.Submission{UserID: "123", SessionID: "987", Rating: 4},
+			expectedKind:   feedback.ErrDuplicate,
+			expectedReason: "User 123 has already submitted feedback for session 987",
+		},
+		{
+			name:           "Too High Rating",
+			submission:     feedback.Submission{UserID: "123", SessionID: "987", Rating: 6},
+			expectedKind:   feedback.ErrInvalidRating,
+			expectedReason: "User 123 submitted rating 6 is not within the allowed range of 1-5 for session 987",
+		},
+		{
+			name:           "Too Low Rating",
+			submission:     feedback.Submission{UserID: "123", SessionID: "987", Rating: 0},
+			expectedKind:   feedback.ErrInvalidRating,
+			expectedReason: "User 123 submitted rating 0 is not within the allowed range of 1-5 for session 987",
+		},
+		{
+			name: "Too Long Comment",
+			submission: feedback.Submission{UserID: "123", SessionID: "987", Rating: 4,
+				Comment: string(make([]byte, model.MaxCommentLength+1))},
+			expectedKind: feedback.ErrInvalidComment,
+		},
+		{
+			name:           "Rejected Comment",
+			moderator:      moderation.NewWordlist([]string{"spam"}, moderation.Reject),
+			submission:     feedback.Submission{UserID: "123", SessionID: "987", Comment: "spam", Rating: 4},
+			expectedKind:   feedback.ErrRejected,
+			expectedReason: "User 123 submitted comment was rejected for session 987",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := feedback.Service{DB: test.db, Moderator: test.moderator}
+			_, err := service.Submit(test.submission)
+			var ruleErr *feedback.Error
+			if !errors.Is(err, test.expectedKind) || !errors.As(err, &ruleErr) {
+				t.Fatalf("expected an error of kind %v but got %v", test.expectedKind, err)
+			}
+			if !strings.HasPrefix(ruleErr.Reason, test.expectedReason) {
+				t.Errorf("expected reason %q but got %q", test.expectedReason, ruleErr.Reason)
+			}
+		})
+	}
+}
+
+func TestService_Submit_DBError(t *testing.T) {
+	tests := []struct {
+		name string
+		db   mockDB
+	}{
+		{name: "Exists Error", db: mockDB{existsError: true}},
+		{name: "Insert Error", db: mockDB{insertError: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := feedback.Service{DB: test.db}
+			_, err := service.Submit(feedback.Submission{UserID: "123", SessionID: "987", Rating: 4})
+			//
+			// A failure of the DB is not a broken business rule
+			//
+			var ruleErr *feedback.Error
+			if err == nil || errors.As(err, &ruleErr) {
+				t.Errorf("expected a DB error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestService_Submit_OccurredAt(t *testing.T) {
+	occurredAt := time.Now().Add(-48 * time.Hour).Truncate(time.Microsecond).UTC()
+	tests := []struct {
+		name         string
+		occurredAt   time.Time
+		expectedKind error
+	}{
+		{name: "Within Window", occurredAt: occurredAt},
+		{name: "Too Old", occurredAt: time.Now().Add(-14 * 24 * time.Hour), expectedKind: feedback.ErrInvalidDate},
+		{name: "Future", occurredAt: time.Now().Add(time.Hour), expectedKind: feedback.ErrInvalidDate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := feedback.Service{DB: mockDB{}, OccurredAtWindow: 7 * 24 * time.Hour}
+			submitted, err := service.Submit(feedback.Submission{UserID: "123", SessionID: "987", Rating: 4,
+				OccurredAt: &test.occurredAt})
+			if test.expectedKind != nil {
+				if !errors.Is(err, test.expectedKind) {
+					t.Errorf("expected an error of kind %v but got %v", test.expectedKind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			} else if !submitted.Date.Equal(occurredAt) {
+				t.Errorf("expected date %s but got %s", occurredAt, submitted.Date)
+			}
+		})
+	}
+}
+
+func TestService_Submit_Publishes(t *testing.T) {
+	tests := []struct {
+		name            string
+		comment         string
+		expectPublished bool
+	}{
+		{name: "Approved", comment: "A Test", expectPublished: true},
+		{name: "Flagged", comment: "spam", expectPublished: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := pubsub.NewBroker(10, 10)
+			subscription, _ := broker.Subscribe("987", 0)
+			defer broker.Unsubscribe(subscription)
+			service := feedback.Service{
+				DB:        mockDB{},
+				Moderator: moderation.NewWordlist([]string{"spam"}, moderation.Flag),
+				Broker:    broker,
+			}
+			if _, err := service.Submit(feedback.Submission{UserID: "123", SessionID: "987", Comment: test.comment,
+				Rating: 4}); err != nil {
+				t.Fatal(err)
+			}
+			//
+			// Feedback awaiting review is not streamed
+			//
+			published := false
+			select {
+			case <-subscription.Feedback():
+				published = true
+			default:
+			}
+			if published != test.expectPublished {
+				t.Errorf("expected published to be %t but got %t", test.expectPublished, published)
+			}
+		})
+	}
+}
+
+func TestService_Get(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "123", SessionID: "987", ModerationStatus: model.ModerationFlagged},
+	}
+	tests := []struct {
+		name         string
+		db           mockDB
+		sessionID    string
+		id           int32
+		userID       string
+		expectedKind error
+	}{
+		{name: "Approved", db: mockDB{feedbacks: feedbacks}, sessionID: "987", id: 1},
+		{name: "Other Session", db: mockDB{feedbacks: feedbacks}, sessionID: "654", id: 1,
+			expectedKind: feedback.ErrNotFound},
+		{name: "Missing", db: mockDB{feedbacks: feedbacks}, sessionID: "987", id: 3,
+			expectedKind: feedback.ErrNotFound},
+		{name: "Flagged Own", db: mockDB{feedbacks: feedbacks}, sessionID: "987", id: 2, userID: "123"},
+		{name: "Flagged Other User", db: mockDB{feedbacks: feedbacks}, sessionID: "987", id: 2, userID: "456",
+			expectedKind: feedback.ErrNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := feedback.Service{DB: test.db}
+			found, err := service.Get(test.sessionID, test.id, test.userID)
+			if test.expectedKind != nil {
+				if !errors.Is(err, test.expectedKind) {
+					t.Errorf("expected an error of kind %v but got %v", test.expectedKind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			} else if found.ID != test.id {
+				t.Errorf("expected feedback %d but got %+v", test.id, found)
+			}
+		})
+	}
+}
+
+func TestService_Get_FindError(t *testing.T) {
+	service := feedback.Service{DB: mockDB{findError: true}}
+	_, err := service.Get("987", 1, "123")
+	if err == nil || errors.Is(err, feedback.ErrNotFound) {
+		t.Errorf("expected a DB error but got %v", err)
+	}
+}
+
+func TestService_SubmitBatch(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	subscription, _ := broker.Subscribe("1", 0)
+	defer broker.Unsubscribe(subscription)
+	service := feedback.Service{
+		DB:        mockDB{duplicates: map[string]bool{"2": true}},
+		Moderator: moderation.NewWordlist([]string{"spam"}, moderation.Reject),
+		Broker:    broker,
+	}
+	before := time.Now().Add(-time.Second)
+	outcomes, err := service.SubmitBatch("123", []model.Feedback{
+		{SessionID: "1", Comment: "A Test", Rating: 4, UserID: "456", ID: 9},
+		{SessionID: "2", Comment: "A Test", Rating: 5},
+		{SessionID: "3", Comment: "A Test", Rating: 9},
+		{SessionID: "4", Comment: "spam", Rating: 3},
+		{Comment: "A Test", Rating: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedKinds := []error{nil, feedback.ErrDuplicate, feedback.ErrInvalidRating, feedback.ErrRejected,
+		feedback.ErrInvalidSession}
+	if len(outcomes) != len(expectedKinds) {
+		t.Fatalf("expected %d outcomes but got %d", len(expectedKinds), len(outcomes))
+	}
+	for i, kind := range expectedKinds {
+		if (kind == nil && outcomes[i].Err != nil) || !errors.Is(outcomes[i].Err, kind) {
+			t.Errorf("expected outcome %d to be of kind %v but got %v", i, kind, outcomes[i].Err)
+		}
+	}
+	//
+	// The inserted feedback belongs to the user, is dated now and is streamed
+	//
+	created := outcomes[0].Feedback
+	if created.ID != 1 || created.UserID != "123" || created.Date.Before(before) {
+		t.Errorf("unexpected feedback %+v", created)
+	}
+	select {
+	case published := <-subscription.Feedback():
+		if published.ID != created.ID {
+			t.Errorf("expected feedback %d to be streamed but got %+v", created.ID, published)
+		}
+	default:
+		t.Error("expected the inserted feedback to be streamed")
+	}
+}
+
+func TestService_SubmitBatch_InsertError(t *testing.T) {
+	service := feedback.Service{DB: mockDB{insertError: true}}
+	if _, err := service.SubmitBatch("123", []model.Feedback{{SessionID: "1", Rating: 4}}); err == nil {
+		t.Error("expected a DB error")
+	}
+}
+
+func (m mockDB) SetModerationStatus(id int32, status model.ModerationStatus, reason string, actor string) (
+	db.ModerationChange, error) {
+	for _, f := range m.feedbacks {
+		if f.ID == id {
+			after := f
+			after.ModerationStatus = status
+			after.ModerationReason = reason
+			after.Version++
+			return db.ModerationChange{Before: f, After: after}, nil
+		}
+	}
+	return db.ModerationChange{}, db.ErrNotFound
+}
+
+func TestService_Review(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Version: 1, ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "123", SessionID: "987", Version: 1, ModerationStatus: model.ModerationFlagged},
+	}
+	tests := []struct {
+		name            string
+		id              int32
+		status          model.ModerationStatus
+		expectedKind    error
+		expectPublished bool
+	}{
+		{name: "Approve Flagged", id: 2, status: model.ModerationApproved, expectPublished: true},
+		{name: "Approve Approved", id: 1, status: model.ModerationApproved},
+		{name: "Hide Approved", id: 1, status: model.ModerationHidden, expectPublished: true},
+		{name: "Reject Flagged", id: 2, status: model.ModerationRejected},
+		{name: "Missing", id: 3, status: model.ModerationApproved, expectedKind: feedback.ErrNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := pubsub.NewBroker(10, 10)
+			subscription, _ := broker.Subscribe("987", 0)
+			defer broker.Unsubscribe(subscription)
+			service := feedback.Service{DB: mockDB{feedbacks: feedbacks}, Broker: broker}
+			reviewed, err := service.Review(test.id, test.status, "", "operator:alice")
+			if test.expectedKind != nil {
+				if !errors.Is(err, test.expectedKind) {
+					t.Errorf("expected an error of kind %v but got %v", test.expectedKind, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			} else if reviewed.ModerationStatus != test.status {
+				t.Errorf("expected moderation status %s but got %+v", test.status, reviewed)
+			}
+			//
+			// Only feedback that is shown, or no longer shown, is streamed
+			//
+			published := false
+			select {
+			case streamed := <-subscription.Feedback():
+				if streamed.ModerationStatus != test.status {
+					t.Errorf("expected the reviewed feedback to be streamed but got %+v", streamed)
+				}
+				published = true
+			default:
+			}
+			if published != test.expectPublished {
+				t.Errorf("expected published to be %t but got %t", test.expectPublished, published)
+			}
+		})
+	}
+}
+
+func TestService_Update(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Version: 2,
+			ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "123", SessionID: "987", Comment: "spam", Rating: 4, Version: 2,
+			ModerationStatus: model.ModerationRejected},
+		{ID: 3, UserID: "123", SessionID: "987", Comment: "Reported", Rating: 4, Version: 2,
+			ModerationStatus: model.ModerationHidden, ModerationReason: "reported 3 times"},
+	}
+	comment := func(c string) *string { return &c }
+	rating := func(r int8) *int8 { return &r }
+	version := func(v int32) func(int32) bool {
+		return func(current int32) bool { return current == v }
+	}
+	tests := []struct {
+		name           string
+		change         feedback.Change
+		expectedKind   error
+		expectedStatus model.ModerationStatus
+		expectedReason string
+	}{
+		{name: "Rating", change: feedback.Change{UserID: "123", SessionID: "987", ID: 1, Matches: version(2),
+			Rating: rating(5)}, expectedStatus: model.ModerationApproved},
+		{name: "Comment Flagged", change: feedback.Change{UserID: "123", SessionID: "987", ID: 1,
+			Comment: comment("advert")}, expectedStatus: model.ModerationFlagged},
+		{name: "Rejected Reviewed Again", change: feedback.Change{UserID: "123", SessionID: "987", ID: 2,
+			Comment: comment("Changed")}, expectedStatus: model.ModerationFlagged},
+		{name: "Hidden Stays Hidden", change: feedback.Change{UserID: "123", SessionID: "987", ID: 3,
+			Comment: comment("Changed")}, expectedStatus: model.ModerationHidden, expectedReason: "reported 3 times"},
+		{name: "Hidden Flagged Stays Hidden", change: feedback.Change{UserID: "123", SessionID: "987", ID: 3,
+			Comment: comment("advert")}, expectedStatus: model.ModerationHidden, expectedReason: "reported 3 times"},
+		{name: "Missing", change: feedback.Change{UserID: "123", SessionID: "987", ID: 4},
+			expectedKind: feedback.ErrNotFound},
+		{name: "Other User", change: feedback.Change{UserID: "456", SessionID: "987", ID: 1},
+			expectedKind: feedback.ErrForbidden},
+		{name: "Stale", change: feedback.Change{UserID: "123", SessionID: "987", ID: 1, Matches: version(1)},
+			expectedKind: feedback.ErrChanged},
+		{name: "Invalid Rating", change: feedback.Change{UserID: "123", SessionID: "987", ID: 1, Rating: rating(9)},
+			expectedKind: feedback.ErrInvalidRating},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := feedback.Service{
+				DB:        mockDB{feedbacks: feedbacks},
+				Moderator: moderation.NewWordlist([]string{"advert"}, moderation.Flag),
+			}
+			updated, err := service.Update(test.change)
+			if test.expectedKind != nil {
+				if !errors.Is(err, test.expectedKind) {
+					t.Errorf("expected an error of kind %v but got %v", test.expectedKind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			} else if updated.Version != 3 || updated.ModerationStatus != test.expectedStatus {
+				t.Errorf("expected version 3 and moderation status %s but got %+v", test.expectedStatus, updated)
+			} else if len(test.expectedReason) > 0 && updated.ModerationReason != test.expectedReason {
+				t.Errorf("expected moderation reason '%s' but got '%s'", test.expectedReason, updated.ModerationReason)
+			}
+		})
+	}
+}
+
+func TestService_Delete(t *testing.T) {
+	feedbacks := []model.Feedback{{ID: 1, UserID: "123", SessionID: "987", Version: 2,
+		ModerationStatus: model.ModerationApproved}}
+	tests := []struct {
+		name         string
+		db           mockDB
+		userID       string
+		id           int32
+		expectedKind error
+	}{
+		{name: "Deleted", db: mockDB{feedbacks: feedbacks}, userID: "123", id: 1},
+		{name: "Missing", db: mockDB{feedbacks: feedbacks}, userID: "123", id: 2, expectedKind: feedback.ErrNotFound},
+		{name: "Other User", db: mockDB{feedbacks: feedbacks}, userID: "456", id: 1,
+			expectedKind: feedback.ErrForbidden},
+		{name: "Changed Concurrently", db: mockDB{feedbacks: feedbacks, insertError: true}, userID: "123", id: 1,
+			expectedKind: feedback.ErrChanged},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := pubsub.NewBroker(10, 10)
+			subscription, _ := broker.Subscribe("987", 0)
+			defer broker.Unsubscribe(subscription)
+			service := feedback.Service{DB: test.db, Broker: broker}
+			_, err := service.Delete(test.userID, "987", test.id, nil)
+			if test.expectedKind == nil && err != nil {
+				t.Fatal(err)
+			} else if !errors.Is(err, test.expectedKind) {
+				t.Errorf("expected an error of kind %v but got %v", test.expectedKind, err)
+			}
+			//
+			// Deleted feedback is streamed without a moderation status so clients stop showing it
+			//
+			select {
+			case deleted := <-subscription.Feedback():
+				if test.expectedKind != nil || deleted.ID != test.id || deleted.Visible() {
+					t.Errorf("unexpected streamed feedback %+v", deleted)
+				}
+			default:
+				if test.expectedKind == nil {
+					t.Error("expected the deleted feedback to be streamed")
+				}
+			}
+		})
+	}
+}
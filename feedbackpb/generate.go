@@ -0,0 +1,4 @@
+// Package feedbackpb is the gRPC API generated from proto/feedback.proto.
+package feedbackpb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative feedback.proto
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Piszmog/feedback-service/config"
+	"github.com/Piszmog/feedback-service/importer"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runImport imports the feedback in the files provided as arguments. The DB is configured the same as when running the
+// server. The exit code is returned.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "the format of the files, 'csv' or 'ndjson', determined by the file extension when not set")
+	batchSize := fs.Int("batch-size", importer.DefaultBatchSize, "the number of feedback written per transaction")
+	upsert := fs.Bool("upsert", false, "replace existing feedback rather than skipping it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [flags] FILE...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := cfg.DB.Validate(); err != nil {
+		log.Println(fmt.Errorf("invalid configuration: %w", err))
+		return 1
+	}
+	if err := cfg.Startup.Validate(); err != nil {
+		log.Println(fmt.Errorf("invalid configuration: %w", err))
+		return 1
+	}
+	//
+	// Imported comments are moderated like submitted ones
+	//
+	moderator, err := cfg.Moderation.Moderator()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	//
+	// Stop waiting on the DB on SIGINT or SIGTERM. Batches already written stay committed
+	//
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	mysql, err := createMySQLDB(ctx, cfg.DB, cfg.Startup.Backoff())
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer mysql.Close()
+	//
+	// Imported changes are published by the relay of the running application
+	//
+	mysql.PublishEvents = len(cfg.Events.Publisher) > 0
+	//
+	// Import each file, reporting the lines that were rejected
+	//
+	var total importer.Summary
+	for _, file := range files {
+		if ctx.Err() != nil {
+			log.Println("Import interrupted")
+			return 1
+		}
+		summary, err := importFile(file, *format, importer.Options{BatchSize: *batchSize, Upsert: *upsert,
+			Moderator: moderator}, mysql)
+		for _, rejection := range summary.Rejected {
+			log.Printf("Rejected %s:%d: %s\n", file, rejection.Line, rejection.Reason)
+		}
+		log.Printf("Imported %s: %s\n", file, summary)
+		total.Inserted += summary.Inserted
+		total.Updated += summary.Updated
+		total.Skipped += summary.Skipped
+		total.Rejected = append(total.Rejected, summary.Rejected...)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+	}
+	log.Printf("Import finished: %s\n", total)
+	return 0
+}
+
+func importFile(path string, format string, options importer.Options, store importer.Store) (importer.Summary, error) {
+	options.Format = format
+	if len(options.Format) == 0 {
+		var err error
+		if options.Format, err = importer.FormatOf(path); err != nil {
+			return importer.Summary{}, err
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return importer.Summary{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	summary, err := importer.Import(file, store, options)
+	if err != nil {
+		return summary, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,260 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/moderation"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of the files that can be imported.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// DefaultBatchSize is the number of feedback written per transaction when not configured.
+const DefaultBatchSize = 500
+
+// maxLineLength is the longest NDJSON line that can be read.
+const maxLineLength = 1024 * 1024
+
+// Store writes imported feedback. The MySQL DB is a Store.
+type Store interface {
+	// Import writes the feedback in a single transaction. Whether each feedback was inserted, updated or skipped is
+	// returned in the order provided.
+	Import(feedback []model.Feedback, upsert bool) ([]db.ImportStatus, error)
+}
+
+// Options configures how feedback is imported.
+type Options struct {
+	// Format is either 'csv' or 'ndjson'.
+	Format string
+	// BatchSize is the number of feedback written per transaction.
+	BatchSize int
+	// Upsert replaces existing feedback rather than skipping it.
+	Upsert bool
+	// Moderator moderates the imported comments like submitted ones. Comments are not moderated when nil.
+	Moderator moderation.Moderator
+}
+
+// Rejection is a line that could not be imported.
+type Rejection struct {
+	Line   int
+	Reason string
+}
+
+// Summary is the outcome of an import.
+type Summary struct {
+	Inserted int
+	Updated  int
+	Skipped  int
+	Rejected []Rejection
+}
+
+// String provides a single line summary of the import.
+func (s Summary) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d skipped, %d rejected", s.Inserted, s.Updated, s.Skipped,
+		len(s.Rejected))
+}
+
+// FormatOf determines the format of a file from its extension.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl", ".json":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("cannot determine the format of %s, it must be '%s' or '%s'", path, FormatCSV,
+			FormatNDJSON)
+	}
+}
+
+// Import reads the feedback from the reader and writes them to the store in batches. Each line is validated and
+// moderated with the same rules as submitted feedback, the lines that are not valid are rejected and reported in the
+// summary. The date of each feedback is kept as is. An error is returned if the reader cannot be read or the store
+// fails, the summary then covers the batches written before the failure.
+func Import(r io.Reader, store Store, options Options) (Summary, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var read func(r io.Reader, fn lineFunc) error
+	switch options.Format {
+	case FormatCSV:
+		read = readCSV
+	case FormatNDJSON:
+		read = readNDJSON
+	default:
+		return Summary{}, fmt.Errorf("format '%s' is not one of '%s' or '%s'", options.Format, FormatCSV, FormatNDJSON)
+	}
+	service := &feedback.Service{Moderator: options.Moderator}
+	var summary Summary
+	batch := make([]model.Feedback, 0, batchSize)
+	write := func() error {
+		statuses, err := store.Import(batch, options.Upsert)
+		if err != nil {
+			return fmt.Errorf("failed to import batch of %d feedback: %w", len(batch), err)
+		}
+		for _, status := range statuses {
+			switch status {
+			case db.ImportInserted:
+				summary.Inserted++
+			case db.ImportUpdated:
+				summary.Updated++
+			case db.ImportSkipped:
+				summary.Skipped++
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err := read(r, func(line int, imported model.Feedback, err error) error {
+		if err == nil {
+			err = validate(service, &imported)
+		}
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, Rejection{Line: line, Reason: err.Error()})
+			return nil
+		}
+		batch = append(batch, imported)
+		if len(batch) == batchSize {
+			return write()
+		}
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+	if len(batch) > 0 {
+		if err := write(); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// lineFunc is called with each feedback read along with the line it starts on. The error is set when the line could
+// not be parsed.
+type lineFunc func(line int, feedback model.Feedback, err error) error
+
+// validate validates the imported feedback and moderates its comment, setting its moderation status.
+func validate(service *feedback.Service, imported *model.Feedback) error {
+	if len(imported.UserID) == 0 {
+		return errors.New("missing userId")
+	} else if len(imported.SessionID) == 0 {
+		return errors.New("missing sessionId")
+	} else if imported.Date.IsZero() {
+		return errors.New("missing date")
+	} else if err := service.Validate(*imported); err != nil {
+		return err
+	}
+	return service.Moderate(imported)
+}
+
+// readCSV reads a CSV file with a header, in the same layout as exported. The 'id' column is optional and ignored.
+func readCSV(r io.Reader, fn lineFunc) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"userId", "sessionId", "comment", "rating", "date"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("the CSV header is missing the column '%s'", name)
+		}
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := fn(parseErr.StartLine, model.Feedback{}, parseErr.Err); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read the CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		feedback, err := parseRecord(record, header, columns)
+		if err := fn(line, feedback, err); err != nil {
+			return err
+		}
+	}
+}
+
+func parseRecord(record []string, header []string, columns map[string]int) (model.Feedback, error) {
+	if len(record) != len(header) {
+		return model.Feedback{}, fmt.Errorf("expected %d columns but got %d", len(header), len(record))
+	}
+	feedback := model.Feedback{
+		UserID:    strings.TrimSpace(record[columns["userId"]]),
+		SessionID: strings.TrimSpace(record[columns["sessionId"]]),
+		Comment:   record[columns["comment"]],
+	}
+	rating, err := strconv.ParseInt(strings.TrimSpace(record[columns["rating"]]), 10, 8)
+	if err != nil {
+		return feedback, fmt.Errorf("invalid rating: %w", err)
+	}
+	feedback.Rating = int8(rating)
+	if date := strings.TrimSpace(record[columns["date"]]); len(date) > 0 {
+		if feedback.Date, err = time.Parse(time.RFC3339Nano, date); err != nil {
+			return feedback, fmt.Errorf("date must be an RFC 3339 date: %w", err)
+		}
+	}
+	return feedback, nil
+}
+
+// readNDJSON reads a feedback JSON object per line. Blank lines are ignored. The ID, version and moderation of the
+// feedback are not imported.
+func readNDJSON(r io.Reader, fn lineFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+		var feedback model.Feedback
+		err := json.Unmarshal([]byte(text), &feedback)
+		if err != nil {
+			err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		feedback.ID = 0
+		feedback.Version = 0
+		feedback.ModerationStatus = ""
+		feedback.ModerationReason = ""
+		feedback.UserID = strings.TrimSpace(feedback.UserID)
+		feedback.SessionID = strings.TrimSpace(feedback.SessionID)
+		if err := fn(line, feedback, err); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read line %d: %w", line+1, err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package importer_test
+
+import (
+	"errors"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/importer"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/moderation"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	err      error
+	existing map[string]bool
+	batches  [][]model.Feedback
+}
+
+func (m *mockStore) Import(feedback []model.Feedback, upsert bool) ([]db.ImportStatus, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.batches = append(m.batches, append([]model.Feedback(nil), feedback...))
+	statuses := make([]db.ImportStatus, len(feedback))
+	for i, f := range feedback {
+		key := f.UserID + "/" + f.SessionID
+		if !m.existing[key] {
+			statuses[i] = db.ImportInserted
+		} else if upsert {
+			statuses[i] = db.ImportUpdated
+		} else {
+			statuses[i] = db.ImportSkipped
+		}
+	}
+	return statuses, nil
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		options          importer.Options
+		expectedSummary  string
+		expectedBatches  int
+		expectedRejected []int
+	}{
+		{
+			name: "CSV",
+			input: "id,userId,sessionId,comment,rating,date\n" +
+				"1,123,1,Good,5,2019-11-01T10:00:00.5Z\n" +
+				"2,123,2,\"Long, but fine\",4,2019-11-02T10:00:00Z\n" +
+				"3,456,1,Bad,9,2019-11-03T10:00:00Z\n" +
+				"4,,1,No user,3,2019-11-03T10:00:00Z\n" +
+				"5,456,2,No date,3,\n" +
+				"6,456,3,Bad rating,x,2019-11-03T10:00:00Z\n" +
+				"7,789,1,Exists,2,2019-11-04T10:00:00Z\n",
+			options:          importer.Options{Format: importer.FormatCSV, BatchSize: 2},
+			expectedSummary:  "2 inserted, 0 updated, 1 skipped, 4 rejected",
+			expectedBatches:  2,
+			expectedRejected: []int{4, 5, 6, 7},
+		},
+		{
+			name: "CSV Upsert",
+			input: "userId,sessionId,comment,rating,date\n" +
+				"789,1,Exists,2,2019-11-04T10:00:00Z\n",
+			options:         importer.Options{Format: importer.FormatCSV, Upsert: true},
+			expectedSummary: "0 inserted, 1 updated, 0 skipped, 0 rejected",
+			expectedBatches: 1,
+		},
+		{
+			name: "NDJSON",
+			input: `{"userId":"123","sessionId":"1","comment":"Good","rating":5,"date":"2019-11-01T10:00:00Z"}` + "\n" +
+				"\n" +
+				`{"userId":"123","sessionId":"2","rating":0,"date":"2019-11-01T10:00:00Z"}` + "\n" +
+				`{"userId":"123",` + "\n" +
+				`{"userId":"789","sessionId":"1","rating":1,"date":"2019-11-01T10:00:00Z"}` + "\n",
+			options:          importer.Options{Format: importer.FormatNDJSON},
+			expectedSummary:  "1 inserted, 0 updated, 1 skipped, 2 rejected",
+			expectedBatches:  1,
+			expectedRejected: []int{3, 4},
+		},
+		{
+			name:            "Empty",
+			input:           "",
+			options:         importer.Options{Format: importer.FormatCSV},
+			expectedSummary: "0 inserted, 0 updated, 0 skipped, 0 rejected",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &mockStore{existing: map[string]bool{"789/1": true}}
+			summary, err := importer.Import(strings.NewReader(test.input), store, test.options)
+			if err != nil {
+				t.Fatalf("unexpected error occurred: %v", err)
+			}
+			if summary.String() != test.expectedSummary {
+				t.Errorf("expected summary '%s' but got '%s'", test.expectedSummary, summary)
+			}
+			if len(store.batches) != test.expectedBatches {
+				t.Errorf("expected %d batches but got %d", test.expectedBatches, len(store.batches))
+			}
+			if len(summary.Rejected) != len(test.expectedRejected) {
+				t.Fatalf("expected rejected lines %v but got %v", test.expectedRejected, summary.Rejected)
+			}
+			for i, line := range test.expectedRejected {
+				if summary.Rejected[i].Line != line {
+					t.Errorf("expected rejected lines %v but got %v", test.expectedRejected, summary.Rejected)
+				}
+			}
+		})
+	}
+}
+
+func TestImport_PreservesDate(t *testing.T) {
+	store := &mockStore{}
+	input := "userId,sessionId,comment,rating,date\n123,1,Good,5,2019-11-01T10:00:00.123456Z\n"
+	if _, err := importer.Import(strings.NewReader(input), store, importer.Options{Format: importer.FormatCSV}); err != nil {
+		t.Fatalf("unexpected error occurred: %v", err)
+	}
+	expected := time.Date(2019, 11, 1, 10, 0, 0, 123456000, time.UTC)
+	if len(store.batches) != 1 || !store.batches[0][0].Date.Equal(expected) {
+		t.Errorf("expected date %s but got %v", expected, store.batches)
+	}
+}
+
+func TestImport_Moderates(t *testing.T) {
+	tests := []struct {
+		name             string
+		comment          string
+		action           moderation.Action
+		expectedStatus   model.ModerationStatus
+		expectedRejected int
+	}{
+		{
+			name:           "Approved",
+			comment:        "Good",
+			action:         moderation.Flag,
+			expectedStatus: model.ModerationApproved,
+		},
+		{
+			name:           "Flagged",
+			comment:        "spam",
+			action:         moderation.Flag,
+			expectedStatus: model.ModerationFlagged,
+		},
+		{
+			name:             "Rejected",
+			comment:          "spam",
+			action:           moderation.Reject,
+			expectedRejected: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &mockStore{}
+			input := `{"userId":"123","sessionId":"1","comment":"` + test.comment + `","rating":5,` +
+				`"date":"2019-11-01T10:00:00Z","moderationStatus":"hidden","moderationReason":"file"}` + "\n"
+			options := importer.Options{
+				Format:    importer.FormatNDJSON,
+				Moderator: moderation.NewWordlist([]string{"spam"}, test.action),
+			}
+			summary, err := importer.Import(strings.NewReader(input), store, options)
+			if err != nil {
+				t.Fatalf("unexpected error occurred: %v", err)
+			}
+			if len(summary.Rejected) != test.expectedRejected {
+				t.Fatalf("expected %d rejected but got %v", test.expectedRejected, summary.Rejected)
+			}
+			if test.expectedRejected > 0 {
+				return
+			}
+			if len(store.batches) != 1 || store.batches[0][0].ModerationStatus != test.expectedStatus {
+				t.Errorf("expected status %s but got %v", test.expectedStatus, store.batches)
+			}
+		})
+	}
+}
+
+func TestImport_WithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		options importer.Options
+		store   *mockStore
+	}{
+		{
+			name:    "Unknown Format",
+			input:   "",
+			options: importer.Options{Format: "xml"},
+			store:   &mockStore{},
+		},
+		{
+			name:    "Missing Column",
+			input:   "userId,sessionId,rating,date\n",
+			options: importer.Options{Format: importer.FormatCSV},
+			store:   &mockStore{},
+		},
+		{
+			name:    "Store Failure",
+			input:   `{"userId":"123","sessionId":"1","rating":5,"date":"2019-11-01T10:00:00Z"}`,
+			options: importer.Options{Format: importer.FormatNDJSON},
+			store:   &mockStore{err: errors.New("failed")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := importer.Import(strings.NewReader(test.input), test.store, test.options); err == nil {
+				t.Error("expected error to occur")
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+		err      bool
+	}{
+		{path: "feedback.csv", expected: importer.FormatCSV},
+		{path: "feedback.NDJSON", expected: importer.FormatNDJSON},
+		{path: "feedback.jsonl", expected: importer.FormatNDJSON},
+		{path: "feedback.xml", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			format, err := importer.FormatOf(test.path)
+			if test.err && err == nil {
+				t.Error("expected error to occur")
+			} else if !test.err && format != test.expected {
+				t.Errorf("expected format %s but got %s (%v)", test.expected, format, err)
+			}
+		})
+	}
+}
@@ -1,145 +1,264 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
 	"fmt"
+	"github.com/Piszmog/feedback-service/config"
 	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/events"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/Piszmog/feedback-service/retry"
 	"github.com/Piszmog/feedback-service/transport"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/Piszmog/feedback-service/webhook"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
-const (
-	defaultDatabase       = "ubisoft"
-	defaultDBHost         = "localhost"
-	defaultDBPort         = "3306"
-	defaultHost           = "localhost"
-	defaultPort           = "8080"
-	environmentHost       = "HOST"
-	environmentPort       = "PORT"
-	environmentDBDatabase = "DB_DATABASE"
-	environmentDBHost     = "DB_HOST"
-	environmentDBPassword = "DB_PASSWORD"
-	environmentDBPort     = "DB_PORT"
-	environmentDBUsername = "DB_USERNAME"
-)
+// idempotencyCleanupInterval is how often expired idempotency keys are deleted.
+const idempotencyCleanupInterval = time.Hour
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+	os.Exit(run())
+}
+
+// run runs the application until it is signaled to stop. The exit code is returned so deferred calls are not skipped.
+func run() int {
 	start := time.Now()
 	log.Println("Starting application...")
 	//
-	// Connect to the DB
+	// Load the configuration
 	//
-	mysql, err := createMySQLDB()
+	cfg, err := config.Load(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:])
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		return 1
 	}
-	defer mysql.Close()
+	if err := cfg.Validate(); err != nil {
+		log.Println(fmt.Errorf("invalid configuration: %w", err))
+		return 1
+	}
+	log.Printf("Effective configuration:\n%s", cfg)
 	//
-	// Create the table if does not exist
+	// Stop on SIGINT or SIGTERM. A second signal forces the application to exit
 	//
-	if err := mysql.CreateFeedbackTableIfNotExists(); err != nil {
-		log.Println(err)
-		return
-	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received signal %s, shutting down...\n", sig)
+		stop()
+		sig = <-signals
+		log.Printf("Received signal %s again, forcing exit\n", sig)
+		os.Exit(1)
+	}()
 	//
-	// Get the host and port
+	// Create the HTTP server and run it. Until the DB is available, the server reports it is starting
 	//
-	host := os.Getenv(environmentHost)
-	if len(host) == 0 {
-		log.Println("Defaulting to default HTTP host 'localhost'")
-		host = defaultHost
+	tlsOptions, err := cfg.Server.TLS.Options()
+	if err != nil {
+		log.Println(err)
+		return 1
 	}
-	port := os.Getenv(environmentPort)
-	if len(port) == 0 {
-		log.Println("Defaulting to default HTTP port '8080'")
-		port = defaultPort
+	legacySunset, err := cfg.Server.LegacySunsetTime()
+	if err != nil {
+		log.Println(err)
+		return 1
 	}
-	//
-	// Create the HTTP server and run it
-	//
+	moderator, err := cfg.Moderation.Moderator()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	broker := pubsub.NewBroker(cfg.Server.Stream.History, cfg.Server.Stream.Buffer)
+	health := &transport.Health{}
+	health.SetStatus(transport.StatusStarting)
 	srv := &transport.HTTPServer{
-		Host:         host,
-		Port:         port,
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		DB:           mysql,
+		Host:                 cfg.Server.Host,
+		Port:                 cfg.Server.Port,
+		GRPCPort:             cfg.Server.GRPCPort,
+		WriteTimeout:         cfg.Server.WriteTimeout,
+		ReadTimeout:          cfg.Server.ReadTimeout,
+		IdleTimeout:          cfg.Server.IdleTimeout,
+		Health:               health,
+		TLS:                  tlsOptions,
+		RedirectPort:         cfg.Server.TLS.RedirectPort,
+		CORS:                 cfg.Server.CORS.Options(),
+		LegacyRoutes:         cfg.Server.LegacyRoutes,
+		LegacySunset:         legacySunset,
+		TrustedTokens:        cfg.Server.TrustedTokens,
+		OccurredAtWindow:     cfg.Server.OccurredAtWindow,
+		IdempotencyTTL:       cfg.Server.IdempotencyTTL,
+		GraphQLMaxComplexity: cfg.Server.GraphQLMaxComplexity,
+		Moderator:            moderator,
+		OperatorTokens:       cfg.Server.OperatorTokens,
+		ReportThreshold:      cfg.Moderation.ReportThreshold,
+		Broker:               broker,
+		HeartbeatInterval:    cfg.Server.Stream.HeartbeatInterval,
+		MaxSubscriptions:     cfg.Server.Stream.MaxSubscriptions,
 	}
+	serverFailed := make(chan struct{})
 	go func() {
 		if err := srv.Start(); err != nil {
 			log.Println(err)
+			close(serverFailed)
+			stop()
 		}
 	}()
-	log.Printf("Application started in %f seconds\n", time.Since(start).Seconds())
-	log.Printf("Running on %s:%s with PID %d\n", host, port, os.Getpid())
+	bg := newWorkers()
 	//
-	// If any shutdown signals come, then try to gracefully shut the server down
+	// Connect to the DB
 	//
-	gracefulShutdown(srv)
-}
-
-func createMySQLDB() (*db.MySQL, error) {
+	mysql, err := createMySQLDB(ctx, cfg.DB, cfg.Startup.Backoff())
+	if err != nil {
+		log.Println(err)
+		shutdown(cfg.Server, health, srv, bg, nil)
+		return 1
+	}
 	//
-	// Get env variable for the DB
+	// Changes are only written to the outbox when there is a relay to publish them
 	//
-	username := os.Getenv(environmentDBUsername)
-	password := os.Getenv(environmentDBPassword)
-	host := os.Getenv(environmentDBHost)
-	if len(host) == 0 {
-		log.Println("Defaulting to default DB host name 'localhost'")
-		host = defaultDBHost
+	if len(cfg.Events.Publisher) > 0 {
+		publisher, err := cfg.Events.NewPublisher()
+		if err != nil {
+			log.Println(err)
+			shutdown(cfg.Server, health, srv, bg, mysql)
+			return 1
+		}
+		mysql.PublishEvents = true
+		relay := &events.Relay{
+			Store:        mysql,
+			Publisher:    publisher,
+			BatchSize:    cfg.Events.BatchSize,
+			PollInterval: cfg.Events.PollInterval,
+		}
+		bg.run("event relay", func(ctx context.Context) {
+			relay.Run(ctx)
+			if err := publisher.Close(); err != nil {
+				log.Println(fmt.Errorf("failed to close the events publisher: %w", err))
+			}
+		})
 	}
-	dbPort := os.Getenv(environmentDBPort)
-	if len(dbPort) == 0 {
-		log.Println("Defaulting to default DB port '3306'")
-		dbPort = defaultDBPort
+	srv.DB = mysql
+	if cfg.Server.IdempotencyTTL > 0 {
+		bg.run("idempotency key cleanup", func(ctx context.Context) {
+			deleteExpiredIdempotencyKeys(ctx, mysql)
+		})
 	}
-	database := os.Getenv(environmentDBDatabase)
-	if len(database) == 0 {
-		log.Println("Defaulting to default database name 'ubisoft'")
-		database = defaultDatabase
+	if cfg.Webhooks.PollInterval > 0 {
+		dispatcher := &webhook.Dispatcher{
+			Store:        mysql,
+			Client:       &http.Client{Timeout: cfg.Webhooks.Timeout},
+			Backoff:      cfg.Webhooks.Backoff(),
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			BatchSize:    cfg.Webhooks.BatchSize,
+			PollInterval: cfg.Webhooks.PollInterval,
+		}
+		bg.run("webhook delivery", dispatcher.Run)
 	}
-	options := db.Options{
-		Username:     username,
-		Password:     password,
-		Host:         host,
-		Port:         dbPort,
-		DatabaseName: database,
-		ParseTime:    true,
+	health.SetStatus(transport.StatusReady)
+	log.Printf("Application started in %f seconds\n", time.Since(start).Seconds())
+	log.Printf("Running on %s:%s with PID %d\n", cfg.Server.Host, cfg.Server.Port, os.Getpid())
+	if len(cfg.Server.GRPCPort) > 0 {
+		log.Printf("Serving gRPC on %s:%s\n", cfg.Server.Host, cfg.Server.GRPCPort)
 	}
 	//
-	// Validate the provided options
+	// Wait for a shutdown signal or the server to fail
 	//
-	if err := options.Validate(); err != nil {
-		return nil, err
+	<-ctx.Done()
+	if !shutdown(cfg.Server, health, srv, bg, mysql) {
+		return 1
+	}
+	select {
+	case <-serverFailed:
+		return 1
+	default:
+		return 0
 	}
+}
+
+func createMySQLDB(ctx context.Context, options db.Options, backoff retry.Backoff) (*db.MySQL, error) {
 	//
 	// Connect to the DB
 	//
-	dbConnection, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=%t",
-		options.Username, options.Password, options.Host, options.Port, options.DatabaseName, options.ParseTime))
+	mysql, err := db.NewMySQL(options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to the MySQL DB: %w", err)
+		return nil, err
 	}
 	//
-	// Ensure we can talk to the DB
+	// Ensure we can talk to the DB, it may still be starting up
+	//
+	if err := backoff.Do(ctx, "ping the DB", mysql.DB.Ping); err != nil {
+		mysql.Close()
+		return nil, err
+	}
+	log.Println("Successfully connected to the database")
 	//
-	if err := dbConnection.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping the DB: %w", err)
+	// Create the table if does not exist
+	//
+	if err := backoff.Do(ctx, "create the feedback table", mysql.CreateFeedbackTableIfNotExists); err != nil {
+		mysql.Close()
+		return nil, err
+	}
+	//
+	// Bring the schema up to date
+	//
+	if err := backoff.Do(ctx, "migrate the DB", mysql.Migrate); err != nil {
+		mysql.Close()
+		return nil, err
+	}
+	return mysql, nil
+}
+
+// deleteExpiredIdempotencyKeys periodically deletes the idempotency keys that expired until the context is done.
+func deleteExpiredIdempotencyKeys(ctx context.Context, mysql *db.MySQL) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := mysql.DeleteExpiredIdempotencyKeys(now)
+			if err != nil {
+				log.Println(err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d expired idempotency keys\n", deleted)
+			}
+		}
 	}
-	log.Printf("Successfully connected to %s database\n", database)
-	return &db.MySQL{DB: dbConnection}, nil
 }
 
-func gracefulShutdown(srv *transport.HTTPServer) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
-	srv.Shutdown(5 * time.Second)
-	log.Println("shutting down...")
-	os.Exit(0)
+// shutdown drains the application. The application stops reporting ready, waits for the pre-stop delay so load
+// balancers stop routing to it, shuts the server down, stops background workers and finally closes the DB. Returns
+// false if anything had to be forcibly stopped.
+func shutdown(cfg config.Server, health *transport.Health, srv *transport.HTTPServer, bg *workers, mysql *db.MySQL) bool {
+	graceful := true
+	health.SetStatus(transport.StatusDraining)
+	if cfg.PreStopDelay > 0 {
+		log.Printf("Waiting %s before stopping the server\n", cfg.PreStopDelay)
+		time.Sleep(cfg.PreStopDelay)
+	}
+	if err := srv.Shutdown(cfg.ShutdownTimeout); err != nil {
+		log.Println(err)
+		graceful = false
+	}
+	if err := bg.stop(cfg.ShutdownTimeout); err != nil {
+		log.Println(err)
+		graceful = false
+	}
+	if mysql != nil {
+		mysql.Close()
+	}
+	log.Println("Application stopped")
+	return graceful
 }
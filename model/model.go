@@ -1,6 +1,20 @@
 package model
 
-import "time"
+import (
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MinRating is the lowest rating a user can give.
+	MinRating = 1
+	// MaxRating is the highest rating a user can give.
+	MaxRating = 5
+	// MaxCommentLength is the maximum number of characters in a comment.
+	MaxCommentLength = 255
+	// DatePrecision is the precision feedback dates are stored with.
+	DatePrecision = time.Microsecond
+)
 
 // Feedback is the feedback a user can provide for a session.
 type Feedback struct {
@@ -10,4 +24,121 @@ type Feedback struct {
 	Comment   string    `json:"comment"`
 	Rating    int8      `json:"rating"`
 	Date      time.Time `json:"date"`
+	// Version is incremented each time the feedback changes.
+	Version int32 `json:"version"`
+	// ModerationStatus is whether the feedback is shown, awaiting review or rejected.
+	ModerationStatus ModerationStatus `json:"moderationStatus"`
+	// ModerationReason explains why the feedback was flagged or rejected.
+	ModerationReason string `json:"moderationReason,omitempty"`
+}
+
+// ModerationStatus is the outcome of moderating a feedback.
+type ModerationStatus string
+
+const (
+	// ModerationApproved is feedback that is shown to everyone
+	ModerationApproved ModerationStatus = "approved"
+	// ModerationFlagged is feedback awaiting review by an operator before it is shown
+	ModerationFlagged ModerationStatus = "flagged"
+	// ModerationRejected is feedback an operator rejected. It is only shown to the user that provided it
+	ModerationRejected ModerationStatus = "rejected"
+	// ModerationHidden is feedback an operator hid after it was shown. It is only shown to the user that provided it
+	ModerationHidden ModerationStatus = "hidden"
+)
+
+// Visible checks whether the feedback is shown to everyone.
+func (f Feedback) Visible() bool {
+	return f.ModerationStatus == ModerationApproved
+}
+
+// ValidRating checks whether the rating is within the allowed range.
+func ValidRating(rating int8) bool {
+	return rating >= MinRating && rating <= MaxRating
+}
+
+// ValidComment checks whether the comment fits in the allowed length.
+func ValidComment(comment string) bool {
+	return utf8.RuneCountInString(comment) <= MaxCommentLength
+}
+
+// NormalizeDate provides the date as it is stored, in UTC and truncated to the stored precision.
+func NormalizeDate(date time.Time) time.Time {
+	return date.UTC().Truncate(DatePrecision)
+}
+
+// ReportReason is why a user reported the feedback of another user.
+type ReportReason string
+
+const (
+	// ReportSpam is feedback advertising or repeating unrelated content
+	ReportSpam ReportReason = "spam"
+	// ReportHarassment is feedback targeting a person
+	ReportHarassment ReportReason = "harassment"
+	// ReportHate is feedback attacking a group
+	ReportHate ReportReason = "hate"
+	// ReportOffensive is feedback with offensive language
+	ReportOffensive ReportReason = "offensive"
+	// ReportOther is feedback reported for any other reason
+	ReportOther ReportReason = "other"
+)
+
+// ReportReasons are the reasons feedback can be reported for.
+var ReportReasons = []ReportReason{ReportSpam, ReportHarassment, ReportHate, ReportOffensive, ReportOther}
+
+// ValidReportReason checks whether the reason is one of the report reasons.
+func ValidReportReason(reason ReportReason) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is a user reporting the feedback of another user.
+type Report struct {
+	FeedbackID int32        `json:"feedbackId"`
+	SessionID  string       `json:"sessionId"`
+	ReporterID string       `json:"-"`
+	Reason     ReportReason `json:"reason"`
+	Date       time.Time    `json:"date"`
+}
+
+// WebhookEvent is a kind of change to feedback that webhooks are notified of.
+type WebhookEvent string
+
+const (
+	// EventCreated is feedback that was created
+	EventCreated WebhookEvent = "feedback.created"
+	// EventUpdated is feedback that was changed by its user or an import
+	EventUpdated WebhookEvent = "feedback.updated"
+	// EventDeleted is feedback that was deleted
+	EventDeleted WebhookEvent = "feedback.deleted"
+	// EventModerated is feedback whose moderation status changed
+	EventModerated WebhookEvent = "feedback.moderated"
+)
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []WebhookEvent{EventCreated, EventUpdated, EventDeleted, EventModerated}
+
+// ValidWebhookEvent checks whether the event is one of the webhook events.
+func ValidWebhookEvent(event WebhookEvent) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is an endpoint notified of the events of the feedback with a rating within its range. The secret signs the
+// deliveries and is only provided when the webhook is created.
+type Webhook struct {
+	ID        int64          `json:"id"`
+	URL       string         `json:"url"`
+	Events    []WebhookEvent `json:"events"`
+	MinRating int8           `json:"minRating"`
+	MaxRating int8           `json:"maxRating"`
+	Secret    string         `json:"secret,omitempty"`
+	Date      time.Time      `json:"date"`
 }
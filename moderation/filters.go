@@ -0,0 +1,173 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// leetspeak maps the characters commonly substituted for letters back to the letters.
+var leetspeak = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+}
+
+// Wordlist objects to comments with any of the listed words. Words are matched whole, ignoring case and leetspeak,
+// e.g. 'n00b' matches 'noob'.
+type Wordlist struct {
+	words  map[string]bool
+	action Action
+}
+
+// NewWordlist creates a moderator that applies the action to comments with any of the words.
+func NewWordlist(words []string, action Action) *Wordlist {
+	w := &Wordlist{words: make(map[string]bool, len(words)), action: action}
+	for _, word := range words {
+		if word = normalize(strings.TrimSpace(word)); len(word) > 0 {
+			w.words[word] = true
+		}
+	}
+	return w
+}
+
+// LoadWordlist reads the words of a file, one per line. Blank lines and lines starting with '#' are ignored.
+func LoadWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wordlist %s: %w", path, err)
+	}
+	defer file.Close()
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read wordlist %s: %w", path, err)
+	}
+	return words, nil
+}
+
+// Moderate checks each word of the comment against the list.
+func (w *Wordlist) Moderate(comment string) Verdict {
+	runes := []rune(comment)
+	found := 0
+	for start := 0; start < len(runes); {
+		if !wordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && wordRune(runes[end]) {
+			end++
+		}
+		//
+		// Trailing punctuation is not part of the word, e.g. 'noob!'
+		//
+		wordEnd := end
+		for wordEnd > start && (runes[wordEnd-1] == '!' || runes[wordEnd-1] == '|') {
+			wordEnd--
+		}
+		if w.words[normalize(string(runes[start:wordEnd]))] {
+			found++
+			for i := start; i < wordEnd; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	if found == 0 {
+		return Verdict{Action: Allow, Comment: comment}
+	}
+	return verdict(w.action, comment, string(runes), fmt.Sprintf("comment has %d blocked words", found))
+}
+
+func wordRune(r rune) bool {
+	_, leet := leetspeak[r]
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || leet
+}
+
+// normalize lowers the word and replaces leetspeak with the letters it stands for.
+func normalize(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(word) {
+		if letter, ok := leetspeak[r]; ok {
+			r = letter
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// linkPattern matches URLs and bare domains, e.g. 'https://example.com/x', 'www.example.com' or 'example.gg'.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|gg|co|me|ly|ru|xyz|info|biz|tv)\b(?:/\S*)?`)
+
+// Links objects to comments with more than the maximum number of links, a common sign of spam.
+type Links struct {
+	Max    int
+	Action Action
+}
+
+// Moderate counts the links of the comment.
+func (l Links) Moderate(comment string) Verdict {
+	links := linkPattern.FindAllStringIndex(comment, -1)
+	if len(links) <= l.Max {
+		return Verdict{Action: Allow, Comment: comment}
+	}
+	masked := linkPattern.ReplaceAllStringFunc(comment, func(link string) string {
+		return strings.Repeat("*", len([]rune(link)))
+	})
+	return verdict(l.Action, comment, masked, fmt.Sprintf("comment has %d links, at most %d are allowed", len(links),
+		l.Max))
+}
+
+// RepeatedCharacters objects to comments that repeat a character more than the maximum times in a row, e.g.
+// 'sooooooo' or '!!!!!!!!'. Masking shortens the repetitions to the maximum.
+type RepeatedCharacters struct {
+	Max    int
+	Action Action
+}
+
+// Moderate looks for characters repeated in a row.
+func (c RepeatedCharacters) Moderate(comment string) Verdict {
+	if c.Max <= 0 {
+		return Verdict{Action: Allow, Comment: comment}
+	}
+	var masked strings.Builder
+	var previous rune
+	repeated := 0
+	found := false
+	for i, r := range comment {
+		if i > 0 && r == previous {
+			repeated++
+		} else {
+			repeated = 1
+		}
+		previous = r
+		if repeated > c.Max {
+			found = true
+			continue
+		}
+		masked.WriteRune(r)
+	}
+	if !found {
+		return Verdict{Action: Allow, Comment: comment}
+	}
+	return verdict(c.Action, comment, masked.String(),
+		fmt.Sprintf("comment repeats a character more than %d times in a row", c.Max))
+}
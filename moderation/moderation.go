@@ -0,0 +1,80 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what is done with a comment that a moderator objects to.
+type Action string
+
+const (
+	// Allow leaves the comment as is
+	Allow Action = "allow"
+	// Mask hides the objectionable parts of the comment
+	Mask Action = "mask"
+	// Flag keeps the comment for an operator to review before it is shown
+	Flag Action = "flag"
+	// Reject refuses the comment
+	Reject Action = "reject"
+)
+
+// severity orders the actions so the most severe one of a chain wins.
+var severity = map[Action]int{Allow: 0, Mask: 1, Flag: 2, Reject: 3}
+
+// ParseAction parses one of 'allow', 'mask', 'flag' or 'reject'.
+func ParseAction(action string) (Action, error) {
+	a := Action(strings.ToLower(strings.TrimSpace(action)))
+	if _, ok := severity[a]; !ok {
+		return "", fmt.Errorf("moderation action '%s' is not one of '%s', '%s', '%s' or '%s'", action, Allow, Mask,
+			Flag, Reject)
+	}
+	return a, nil
+}
+
+// Verdict is the outcome of moderating a comment.
+type Verdict struct {
+	Action Action
+	// Comment is the comment with any objectionable parts masked.
+	Comment string
+	// Reasons explain why the comment was not allowed as is.
+	Reasons []string
+}
+
+// Moderator moderates comments.
+type Moderator interface {
+	Moderate(comment string) Verdict
+}
+
+// Chain runs each moderator in order. Masks are applied in turn and the most severe action wins. The chain stops at the
+// first rejection.
+type Chain []Moderator
+
+// Moderate runs the comment through each moderator of the chain.
+func (c Chain) Moderate(comment string) Verdict {
+	verdict := Verdict{Action: Allow, Comment: comment}
+	for _, moderator := range c {
+		v := moderator.Moderate(verdict.Comment)
+		verdict.Comment = v.Comment
+		verdict.Reasons = append(verdict.Reasons, v.Reasons...)
+		if severity[v.Action] > severity[verdict.Action] {
+			verdict.Action = v.Action
+		}
+		if verdict.Action == Reject {
+			break
+		}
+	}
+	return verdict
+}
+
+// verdict provides the verdict of a moderator that objects to a comment.
+func verdict(action Action, comment string, masked string, reason string) Verdict {
+	switch action {
+	case Allow:
+		return Verdict{Action: Allow, Comment: comment}
+	case Mask:
+		return Verdict{Action: Mask, Comment: masked, Reasons: []string{reason}}
+	default:
+		return Verdict{Action: action, Comment: comment, Reasons: []string{reason}}
+	}
+}
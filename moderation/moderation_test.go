@@ -0,0 +1,114 @@
+package moderation_test
+
+import (
+	"github.com/Piszmog/feedback-service/moderation"
+	"testing"
+)
+
+func TestChain_Moderate(t *testing.T) {
+	tests := []struct {
+		name            string
+		chain           moderation.Chain
+		comment         string
+		expectedAction  moderation.Action
+		expectedComment string
+	}{
+		{
+			name:            "Clean",
+			chain:           moderation.Chain{moderation.NewWordlist([]string{"noob"}, moderation.Mask)},
+			comment:         "Great session",
+			expectedAction:  moderation.Allow,
+			expectedComment: "Great session",
+		},
+		{
+			name:            "Masked Word",
+			chain:           moderation.Chain{moderation.NewWordlist([]string{"noob"}, moderation.Mask)},
+			comment:         "What a Noob!",
+			expectedAction:  moderation.Mask,
+			expectedComment: "What a ****!",
+		},
+		{
+			name:            "Leetspeak",
+			chain:           moderation.Chain{moderation.NewWordlist([]string{"noob"}, moderation.Mask)},
+			comment:         "n00b host",
+			expectedAction:  moderation.Mask,
+			expectedComment: "**** host",
+		},
+		{
+			name:            "Partial Word",
+			chain:           moderation.Chain{moderation.NewWordlist([]string{"noob"}, moderation.Reject)},
+			comment:         "noobish",
+			expectedAction:  moderation.Allow,
+			expectedComment: "noobish",
+		},
+		{
+			name:            "Flagged Link",
+			chain:           moderation.Chain{moderation.Links{Max: 0, Action: moderation.Flag}},
+			comment:         "Visit www.example.com",
+			expectedAction:  moderation.Flag,
+			expectedComment: "Visit www.example.com",
+		},
+		{
+			name:            "Masked Domain",
+			chain:           moderation.Chain{moderation.Links{Max: 0, Action: moderation.Mask}},
+			comment:         "cheap coins at coins.gg",
+			expectedAction:  moderation.Mask,
+			expectedComment: "cheap coins at ********",
+		},
+		{
+			name:            "Allowed Links",
+			chain:           moderation.Chain{moderation.Links{Max: 1, Action: moderation.Reject}},
+			comment:         "see https://example.com/help",
+			expectedAction:  moderation.Allow,
+			expectedComment: "see https://example.com/help",
+		},
+		{
+			name:            "Repeated Characters",
+			chain:           moderation.Chain{moderation.RepeatedCharacters{Max: 3, Action: moderation.Mask}},
+			comment:         "sooooo good!!!!!",
+			expectedAction:  moderation.Mask,
+			expectedComment: "sooo good!!!",
+		},
+		{
+			name: "Most Severe Wins",
+			chain: moderation.Chain{
+				moderation.NewWordlist([]string{"noob"}, moderation.Mask),
+				moderation.Links{Max: 0, Action: moderation.Flag},
+			},
+			comment:         "noob go to example.com",
+			expectedAction:  moderation.Flag,
+			expectedComment: "**** go to example.com",
+		},
+		{
+			name: "Reject Stops",
+			chain: moderation.Chain{
+				moderation.NewWordlist([]string{"scam"}, moderation.Reject),
+				moderation.RepeatedCharacters{Max: 1, Action: moderation.Mask},
+			},
+			comment:         "scam!!!",
+			expectedAction:  moderation.Reject,
+			expectedComment: "scam!!!",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict := test.chain.Moderate(test.comment)
+			if verdict.Action != test.expectedAction {
+				t.Errorf("expected action %s but got %s", test.expectedAction, verdict.Action)
+			} else if verdict.Comment != test.expectedComment {
+				t.Errorf("expected comment '%s' but got '%s'", test.expectedComment, verdict.Comment)
+			} else if verdict.Action != moderation.Allow && len(verdict.Reasons) == 0 {
+				t.Error("expected a reason")
+			}
+		})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	if action, err := moderation.ParseAction(" Flag "); err != nil || action != moderation.Flag {
+		t.Errorf("expected flag but got %s: %v", action, err)
+	}
+	if _, err := moderation.ParseAction("ban"); err == nil {
+		t.Error("expected an unknown action to fail")
+	}
+}
@@ -0,0 +1,179 @@
+package pubsub
+
+import (
+	"github.com/Piszmog/feedback-service/model"
+	"sync"
+)
+
+// Broker fans the feedback published to it out to the subscribers of its session. The most recent feedback is kept so
+// subscribers that reconnect can catch up on what they missed.
+type Broker struct {
+	mu sync.Mutex
+	// history is how many of the most recent feedback, of any session, are kept.
+	history int
+	recent  []model.Feedback
+	// buffer is how many feedback a subscriber can fall behind before it is dropped.
+	buffer   int
+	sessions map[string]map[*Subscription]struct{}
+	closed   bool
+}
+
+// Subscription receives the feedback published to the sessions it follows until it is unsubscribed, falls too far
+// behind or the broker is closed, at which point its channel is closed.
+type Subscription struct {
+	sessions map[string]struct{}
+	feedback chan model.Feedback
+	closed   bool
+}
+
+// Feedback is the channel the published feedback is received on. It is closed when the subscription ends.
+func (s *Subscription) Feedback() <-chan model.Feedback {
+	return s.feedback
+}
+
+// NewBroker creates a broker that keeps the history most recent feedback and drops subscribers that fall more than
+// buffer feedback behind.
+func NewBroker(history int, buffer int) *Broker {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Broker{history: history, buffer: buffer, sessions: make(map[string]map[*Subscription]struct{})}
+}
+
+// Publish sends the feedback to the subscribers of its session. Publishing never blocks, a subscriber that is too far
+// behind is dropped instead so it can resume from the history.
+func (b *Broker) Publish(feedback model.Feedback) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if b.history > 0 {
+		if len(b.recent) == b.history {
+			b.recent = append(b.recent[:0], b.recent[1:]...)
+		}
+		b.recent = append(b.recent, feedback)
+	}
+	for subscription := range b.sessions[feedback.SessionID] {
+		select {
+		case subscription.feedback <- feedback:
+		default:
+			b.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe subscribes to the feedback published to the session. The feedback of the history published after the
+// feedback with the ID is returned so a subscriber can resume where it left off, none is returned when the ID is 0.
+func (b *Broker) Subscribe(sessionID string, afterID int32) (*Subscription, []model.Feedback) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subscription := b.open()
+	if !b.follow(subscription, sessionID) || afterID == 0 {
+		return subscription, nil
+	}
+	//
+	// Feedback is published in the order it is inserted, so everything after the last feedback received was missed.
+	// When it is no longer in the history, the feedback with a greater ID is replayed
+	//
+	start := 0
+	for i, feedback := range b.recent {
+		if feedback.ID == afterID {
+			start = i + 1
+			break
+		}
+	}
+	var missed []model.Feedback
+	for _, feedback := range b.recent[start:] {
+		if feedback.SessionID == sessionID && (start > 0 || feedback.ID > afterID) {
+			missed = append(missed, feedback)
+		}
+	}
+	return subscription, missed
+}
+
+// Open opens a subscription that does not follow any session yet.
+func (b *Broker) Open() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open()
+}
+
+func (b *Broker) open() *Subscription {
+	subscription := &Subscription{sessions: make(map[string]struct{}), feedback: make(chan model.Feedback, b.buffer)}
+	if b.closed {
+		subscription.closed = true
+		close(subscription.feedback)
+	}
+	return subscription
+}
+
+// Follow adds the session to the sessions the subscription receives the feedback of. False is returned if the
+// subscription has ended.
+func (b *Broker) Follow(subscription *Subscription, sessionID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.follow(subscription, sessionID)
+}
+
+func (b *Broker) follow(subscription *Subscription, sessionID string) bool {
+	if subscription.closed {
+		return false
+	}
+	subscribers, ok := b.sessions[sessionID]
+	if !ok {
+		subscribers = make(map[*Subscription]struct{})
+		b.sessions[sessionID] = subscribers
+	}
+	subscribers[subscription] = struct{}{}
+	subscription.sessions[sessionID] = struct{}{}
+	return true
+}
+
+// Unfollow removes the session from the sessions the subscription receives the feedback of. Feedback of the session
+// already sent to the subscription is still received.
+func (b *Broker) Unfollow(subscription *Subscription, sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unfollow(subscription, sessionID)
+}
+
+func (b *Broker) unfollow(subscription *Subscription, sessionID string) {
+	delete(subscription.sessions, sessionID)
+	subscribers := b.sessions[sessionID]
+	delete(subscribers, subscription)
+	if len(subscribers) == 0 {
+		delete(b.sessions, sessionID)
+	}
+}
+
+// Unsubscribe ends the subscription. Unsubscribing an ended subscription does nothing.
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unsubscribe(subscription)
+}
+
+func (b *Broker) unsubscribe(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	close(subscription.feedback)
+	for sessionID := range subscription.sessions {
+		b.unfollow(subscription, sessionID)
+	}
+}
+
+// Close ends every subscription. Feedback published afterwards is discarded.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subscribers := range b.sessions {
+		for subscription := range subscribers {
+			b.unsubscribe(subscription)
+		}
+	}
+	b.recent = nil
+}
@@ -0,0 +1,112 @@
+package pubsub_test
+
+import (
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"testing"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	subscription, missed := broker.Subscribe("987", 0)
+	other, _ := broker.Subscribe("654", 0)
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987"})
+	broker.Publish(model.Feedback{ID: 2, SessionID: "654"})
+	if len(missed) != 0 {
+		t.Errorf("expected no missed feedback but got %+v", missed)
+	}
+	if feedback := <-subscription.Feedback(); feedback.ID != 1 {
+		t.Errorf("expected feedback 1 but got %+v", feedback)
+	}
+	if feedback := <-other.Feedback(); feedback.ID != 2 {
+		t.Errorf("expected feedback 2 but got %+v", feedback)
+	}
+	broker.Unsubscribe(subscription)
+	broker.Unsubscribe(subscription)
+	if _, ok := <-subscription.Feedback(); ok {
+		t.Error("expected the subscription to end")
+	}
+}
+
+func TestBroker_Subscribe_Resume(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     int
+		afterID     int32
+		expectedIDs []int32
+	}{
+		{name: "In History", history: 10, afterID: 3, expectedIDs: []int32{5}},
+		{name: "Last", history: 10, afterID: 5, expectedIDs: nil},
+		{name: "Out of History", history: 2, afterID: 1, expectedIDs: []int32{5}},
+		{name: "No History", history: 0, afterID: 1, expectedIDs: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := pubsub.NewBroker(test.history, 10)
+			for _, feedback := range []model.Feedback{{ID: 1, SessionID: "987"}, {ID: 3, SessionID: "987"},
+				{ID: 4, SessionID: "654"}, {ID: 5, SessionID: "987"}} {
+				broker.Publish(feedback)
+			}
+			_, missed := broker.Subscribe("987", test.afterID)
+			if len(missed) != len(test.expectedIDs) {
+				t.Fatalf("expected feedback %v but got %+v", test.expectedIDs, missed)
+			}
+			for i, feedback := range missed {
+				if feedback.ID != test.expectedIDs[i] {
+					t.Errorf("expected feedback %v but got %+v", test.expectedIDs, missed)
+				}
+			}
+		})
+	}
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	broker := pubsub.NewBroker(10, 1)
+	subscription, _ := broker.Subscribe("987", 0)
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987"})
+	broker.Publish(model.Feedback{ID: 2, SessionID: "987"})
+	if feedback := <-subscription.Feedback(); feedback.ID != 1 {
+		t.Errorf("expected feedback 1 but got %+v", feedback)
+	}
+	if _, ok := <-subscription.Feedback(); ok {
+		t.Error("expected the slow subscription to end")
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	subscription, _ := broker.Subscribe("987", 0)
+	broker.Close()
+	if _, ok := <-subscription.Feedback(); ok {
+		t.Error("expected the subscription to end")
+	}
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987"})
+	late, _ := broker.Subscribe("987", 0)
+	if _, ok := <-late.Feedback(); ok {
+		t.Error("expected a subscription to a closed broker to end")
+	}
+}
+
+func TestBroker_Follow(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	subscription := broker.Open()
+	if !broker.Follow(subscription, "987") || !broker.Follow(subscription, "654") {
+		t.Fatal("expected to follow the sessions")
+	}
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987"})
+	broker.Publish(model.Feedback{ID: 2, SessionID: "654"})
+	broker.Unfollow(subscription, "987")
+	broker.Publish(model.Feedback{ID: 3, SessionID: "987"})
+	broker.Publish(model.Feedback{ID: 4, SessionID: "321"})
+	broker.Unsubscribe(subscription)
+	var ids []int32
+	for feedback := range subscription.Feedback() {
+		ids = append(ids, feedback.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("expected feedback 1 and 2 but got %v", ids)
+	}
+	if broker.Follow(subscription, "987") {
+		t.Error("expected an ended subscription to not follow sessions")
+	}
+}
@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Backoff retries an operation with an exponentially increasing interval between attempts.
+type Backoff struct {
+	// InitialInterval is the interval before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the interval between retries.
+	MaxInterval time.Duration
+	// Multiplier is the factor the interval grows by after each retry.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each interval that is randomized to spread out retries.
+	Jitter float64
+	// MaxWait is the maximum time to keep retrying. Zero retries until the context is done.
+	MaxWait time.Duration
+}
+
+// Interval provides the interval to wait before the provided retry, starting from 0.
+func (b Backoff) Interval(retry int) time.Duration {
+	interval := float64(b.InitialInterval)
+	for i := 0; i < retry && interval < float64(b.MaxInterval); i++ {
+		interval *= b.Multiplier
+	}
+	if b.MaxInterval > 0 && interval > float64(b.MaxInterval) {
+		interval = float64(b.MaxInterval)
+	}
+	//
+	// Randomly shave off up to the jitter fraction of the interval
+	//
+	interval -= interval * b.Jitter * rand.Float64()
+	return time.Duration(interval)
+}
+
+// Do calls the provided function until it succeeds. An error is returned if the context is done or if the next retry
+// would exceed the max wait.
+func (b Backoff) Do(ctx context.Context, operation string, fn func() error) error {
+	start := time.Now()
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		wait := b.Interval(retry)
+		if b.MaxWait > 0 && time.Since(start)+wait > b.MaxWait {
+			return fmt.Errorf("gave up on %s after %s: %w", operation, time.Since(start).Round(time.Millisecond), err)
+		}
+		log.Printf("Failed to %s, retrying in %s: %v\n", operation, wait.Round(time.Millisecond), err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("stopped retrying %s: %w", operation, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Piszmog/feedback-service/retry"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Interval(t *testing.T) {
+	backoff := retry.Backoff{InitialInterval: time.Second, MaxInterval: 10 * time.Second, Multiplier: 2}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if got := backoff.Interval(i); got != want {
+			t.Errorf("retry %d: expected interval %s but got %s", i, want, got)
+		}
+	}
+}
+
+func TestBackoff_Interval_Jitter(t *testing.T) {
+	backoff := retry.Backoff{InitialInterval: time.Second, MaxInterval: time.Second, Multiplier: 2, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := backoff.Interval(i); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("expected interval to be within the jitter range but got %s", got)
+		}
+	}
+}
+
+func TestBackoff_Do(t *testing.T) {
+	backoff := retry.Backoff{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 2}
+	calls := 0
+	err := backoff.Do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error occurred: %v", err)
+	} else if calls != 3 {
+		t.Errorf("expected 3 calls but got %d", calls)
+	}
+}
+
+func TestBackoff_Do_MaxWait(t *testing.T) {
+	backoff := retry.Backoff{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond, Multiplier: 2,
+		MaxWait: 25 * time.Millisecond}
+	failure := errors.New("failed")
+	calls := 0
+	err := backoff.Do(context.Background(), "test", func() error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("expected the last error to be returned but got %v", err)
+	} else if calls != 3 {
+		t.Errorf("expected 3 calls but got %d", calls)
+	}
+}
+
+func TestBackoff_Do_ContextDone(t *testing.T) {
+	backoff := retry.Backoff{InitialInterval: time.Hour, MaxInterval: time.Hour, Multiplier: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := backoff.Do(ctx, "test", func() error {
+		return errors.New("failed")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context error but got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	auditLimit      = 100
+	maxAuditLimit   = 1000
+	queryAction     = "action"
+	queryActor      = "actor"
+	queryAfter      = "after"
+	queryFeedbackID = "feedbackId"
+)
+
+// auditActions are the actions the audit can be filtered by.
+var auditActions = map[db.AuditAction]bool{
+	db.AuditCreate:   true,
+	db.AuditUpdate:   true,
+	db.AuditDelete:   true,
+	db.AuditModerate: true,
+}
+
+// AuditResponse is a page of the audit. Next is the 'after' query param of the next page, omitted on the last page.
+type AuditResponse struct {
+	Entries []db.AuditEntry `json:"entries"`
+	Next    int64           `json:"next,omitempty"`
+}
+
+// RetrieveAudit retrieves the changes made to feedback, oldest first. The changes can be filtered by the feedback, the
+// actor, the action and a date range. Pages are retrieved by passing the 'next' of a page as the 'after' query param.
+func (s *HTTPServer) RetrieveAudit() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		query := r.URL.Query()
+		limit, ok := queryInt(r, queryLimit, auditLimit, maxAuditLimit, w)
+		if !ok {
+			return
+		}
+		dates, err := exportFilter("", query.Get(queryFrom), query.Get(queryTo))
+		if err != nil {
+			writeHTTPError(http.StatusBadRequest, "Invalid dates", err, w)
+			return
+		}
+		filter := db.AuditFilter{
+			Actor:  query.Get(queryActor),
+			Action: db.AuditAction(query.Get(queryAction)),
+			From:   dates.From,
+			To:     dates.To,
+		}
+		if len(filter.Action) > 0 && !auditActions[filter.Action] {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Query param '%s' must be one of '%s', '%s', '%s' or '%s'",
+				queryAction, db.AuditCreate, db.AuditUpdate, db.AuditDelete, db.AuditModerate), nil, w)
+			return
+		}
+		if value := query.Get(queryFeedbackID); len(value) > 0 {
+			id, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || id <= 0 {
+				writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Query param '%s' must be a feedback ID", queryFeedbackID),
+					nil, w)
+				return
+			}
+			filter.FeedbackID = int32(id)
+		}
+		if filter.AfterID, ok = queryAfterID(r, w); !ok {
+			return
+		}
+		entries, err := s.DB.FindAudit(filter, limit)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError, "Failed to retrieve the audit", err, w)
+			return
+		}
+		response := AuditResponse{Entries: entries}
+		if response.Entries == nil {
+			response.Entries = []db.AuditEntry{}
+		} else if len(entries) == limit {
+			response.Next = entries[len(entries)-1].ID
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Println(fmt.Errorf("failed to write the audit: %w", err))
+		}
+	}
+}
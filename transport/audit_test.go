@@ -0,0 +1,73 @@
+package transport_test
+
+import (
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPServer_RetrieveAudit(t *testing.T) {
+	after := model.Feedback{ID: 1, ModerationStatus: model.ModerationHidden, ModerationReason: "abusive"}
+	audit := []db.AuditEntry{
+		{ID: 1, FeedbackID: 1, Action: db.AuditCreate, Actor: "user:123", Date: time.Now(), After: &after},
+		{ID: 2, FeedbackID: 1, Action: db.AuditModerate, Actor: "operator:alice", Date: time.Now(), After: &after},
+		{ID: 3, FeedbackID: 1, Action: db.AuditModerate, Actor: "operator:bob", Date: time.Now(), After: &after},
+	}
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		expectedCode  int
+		expectedIDs   []int64
+		expectedNext  int64
+	}{
+		{name: "All", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int64{1, 2, 3}},
+		{name: "Actor", query: "?actor=operator:alice", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int64{2}},
+		{name: "Action", query: "?action=moderate", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int64{2, 3}},
+		{name: "Page", query: "?limit=1&after=1", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int64{2}, expectedNext: 2},
+		{name: "Unknown Action", query: "?action=read", authorization: "Bearer secret", expectedCode: http.StatusBadRequest},
+		{name: "Bad Feedback ID", query: "?feedbackId=abc", authorization: "Bearer secret", expectedCode: http.StatusBadRequest},
+		{name: "Bad Date", query: "?from=yesterday", authorization: "Bearer secret", expectedCode: http.StatusBadRequest},
+		{name: "Missing Token", expectedCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{audit: audit}), transport.WithOperatorTokens("secret"))
+			request := httptest.NewRequest(http.MethodGet, "/v1/audit"+test.query, nil)
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusOK {
+				return
+			}
+			var response transport.AuditResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the audit: %v", err)
+			}
+			ids := make([]int64, len(response.Entries))
+			for i, entry := range response.Entries {
+				ids[i] = entry.ID
+			}
+			if len(ids) != len(test.expectedIDs) {
+				t.Fatalf("expected entries %v but got %v", test.expectedIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != test.expectedIDs[i] {
+					t.Fatalf("expected entries %v but got %v", test.expectedIDs, ids)
+				}
+			}
+			if response.Next != test.expectedNext {
+				t.Errorf("expected next %d but got %d", test.expectedNext, response.Next)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/model"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const batchLimit = 100
+
+// Statuses of each item of a batch.
+const (
+	batchCreated   = "created"
+	batchDuplicate = "duplicate"
+	batchInvalid   = "invalid"
+)
+
+// BatchResult is the outcome of a single item of a batch.
+type BatchResult struct {
+	Index     int    `json:"index"`
+	SessionID string `json:"sessionId"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// BatchResponse is the outcome of each item of a batch, in the order submitted.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// InsertFeedbackBatch inserts a user's feedback for several sessions at once. Valid items are inserted in a single
+// transaction and a 207 is returned with the outcome of each item.
+func (s *HTTPServer) InsertFeedbackBatch() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		userID := strings.TrimSpace(r.Header.Get(headerUserID))
+		//
+		// Validate the user ID header
+		//
+		if len(userID) == 0 {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing Header '%s'", headerUserID), nil, w)
+			return
+		}
+		//
+		// Deserialize the request payload
+		//
+		defer closeRequestBody(r.Body)
+		var batch []model.Feedback
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to decode user %s feedback batch", userID), err, w)
+			return
+		}
+		if len(batch) == 0 || len(batch) > batchLimit {
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("User %s submitted %d feedback, a batch must have between 1 and %d", userID, len(batch), batchLimit),
+				nil, w)
+			return
+		}
+		//
+		// Only the valid items are inserted, the outcome of each item is reported
+		//
+		outcomes, err := s.service().SubmitBatch(userID, batch)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to insert user %s feedback batch", userID),
+				err, w)
+			return
+		}
+		results := make([]BatchResult, len(batch))
+		for i, outcome := range outcomes {
+			results[i] = BatchResult{Index: i, SessionID: batch[i].SessionID, Status: batchCreated}
+			if errors.Is(outcome.Err, feedback.ErrDuplicate) {
+				results[i].Status = batchDuplicate
+				results[i].Reason = outcome.Err.Error()
+			} else if outcome.Err != nil {
+				results[i].Status = batchInvalid
+				results[i].Reason = outcome.Err.Error()
+			}
+		}
+		//
+		// Send the outcome of each item
+		//
+		w.WriteHeader(http.StatusMultiStatus)
+		if err := json.NewEncoder(w).Encode(BatchResponse{Results: results}); err != nil {
+			log.Println(fmt.Errorf("failed to write user %s feedback batch results: %w", userID, err))
+		}
+	}
+}
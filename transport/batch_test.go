@@ -0,0 +1,187 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/Piszmog/feedback-service/transport"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServer_InsertFeedbackBatch(t *testing.T) {
+	//
+	// Create server
+	//
+	server := transport.HTTPServer{DB: mockDB{duplicates: map[string]bool{"2": true}}}
+	//
+	// Create Request, recorder, and handler
+	//
+	body := `[
+		{"sessionId":"1", "comment":"A Test", "rating":4},
+		{"sessionId":"2", "comment":"A Test", "rating":5},
+		{"sessionId":"3", "comment":"A Test", "rating":9},
+		{"comment":"A Test", "rating":3}
+	]`
+	request, err := http.NewRequest(http.MethodPost, "/batch", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Ubi-UserId", "123")
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/batch", server.InsertFeedbackBatch())
+	//
+	// Serve
+	//
+	router.ServeHTTP(recorder, request)
+	//
+	// Perform checks
+	//
+	if status := recorder.Code; status != http.StatusMultiStatus {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusMultiStatus)
+	}
+	var response transport.BatchResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"created", "duplicate", "invalid", "invalid"}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(response.Results))
+	}
+	for i, status := range expected {
+		if response.Results[i].Index != i {
+			t.Errorf("expected result %d to have index %d but got %d", i, i, response.Results[i].Index)
+		} else if response.Results[i].Status != status {
+			t.Errorf("expected result %d to be %s but got %s", i, status, response.Results[i].Status)
+		}
+	}
+	if reason := response.Results[2].Reason; reason != "Rating 9 is not within the allowed range of 1-5" {
+		t.Errorf("unexpected reason for invalid rating: %s", reason)
+	}
+}
+
+func TestHTTPServer_InsertFeedbackBatch_TooLarge(t *testing.T) {
+	//
+	// Create server
+	//
+	server := transport.HTTPServer{DB: mockDB{}}
+	//
+	// Create Request, recorder, and handler
+	//
+	items := make([]string, 101)
+	for i := range items {
+		items[i] = `{"sessionId":"1", "rating":4}`
+	}
+	request, err := http.NewRequest(http.MethodPost, "/batch", strings.NewReader("["+strings.Join(items, ",")+"]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Ubi-UserId", "123")
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/batch", server.InsertFeedbackBatch())
+	//
+	// Serve
+	//
+	router.ServeHTTP(recorder, request)
+	//
+	// Perform checks
+	//
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	expected := `{"statusCode":400, "reason":"User 123 submitted 101 feedback, a batch must have between 1 and 100"}`
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
+
+func TestHTTPServer_InsertFeedbackBatch_InsertFailure(t *testing.T) {
+	//
+	// Create server
+	//
+	server := transport.HTTPServer{DB: mockDB{insertError: true}}
+	//
+	// Create Request, recorder, and handler
+	//
+	request, err := http.NewRequest(http.MethodPost, "/batch", bytes.NewReader([]byte(`[{"sessionId":"1", "rating":4}]`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Ubi-UserId", "123")
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/batch", server.InsertFeedbackBatch())
+	//
+	// Serve
+	//
+	router.ServeHTTP(recorder, request)
+	//
+	// Perform checks
+	//
+	if status := recorder.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	}
+	expected := `{"statusCode":500, "reason":"Failed to insert user 123 feedback batch"}`
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
+
+func TestHTTPServer_InsertFeedbackBatch_Publishes(t *testing.T) {
+	//
+	// Create server, only the created and approved feedback is streamed
+	//
+	broker := pubsub.NewBroker(10, 10)
+	subscription, _ := broker.Subscribe("1", 0)
+	defer broker.Unsubscribe(subscription)
+	server := transport.HTTPServer{
+		DB:        mockDB{duplicates: map[string]bool{"2": true}},
+		Broker:    broker,
+		Moderator: moderation.NewWordlist([]string{"spam"}, moderation.Flag),
+	}
+	//
+	// Create Request, recorder, and handler
+	//
+	body := `[
+		{"sessionId":"1", "comment":"A Test", "rating":4},
+		{"sessionId":"2", "comment":"A Test", "rating":5},
+		{"sessionId":"1", "comment":"spam", "rating":3}
+	]`
+	request, err := http.NewRequest(http.MethodPost, "/batch", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Ubi-UserId", "123")
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/batch", server.InsertFeedbackBatch())
+	//
+	// Serve
+	//
+	router.ServeHTTP(recorder, request)
+	//
+	// Perform checks
+	//
+	if status := recorder.Code; status != http.StatusMultiStatus {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusMultiStatus)
+	}
+	select {
+	case feedback := <-subscription.Feedback():
+		if feedback.ID != 1 || feedback.Comment != "A Test" {
+			t.Errorf("expected the first feedback to be streamed but got %+v", feedback)
+		}
+	default:
+		t.Fatal("expected the created feedback to be streamed")
+	}
+	select {
+	case feedback := <-subscription.Feedback():
+		t.Errorf("expected only the approved feedback to be streamed but got %+v", feedback)
+	default:
+	}
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAllowMethods     = "Access-Control-Allow-Methods"
+	headerAllowOrigin      = "Access-Control-Allow-Origin"
+	headerExposeHeaders    = "Access-Control-Expose-Headers"
+	headerMaxAge           = "Access-Control-Max-Age"
+	headerOrigin           = "Origin"
+	headerRequestMethod    = "Access-Control-Request-Method"
+	headerVary             = "Vary"
+)
+
+// CORSOptions are the options for allowing browsers to call the APIs from other origins.
+type CORSOptions struct {
+	// AllowedOrigins are the origins that can call the APIs. An origin can have a wildcard subdomain, e.g.
+	// 'https://*.example.com', or be '*' to allow any origin.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache the result of a preflight request.
+	MaxAge time.Duration
+}
+
+// allowed checks whether the origin is allowed to call the APIs.
+func (o CORSOptions) allowed(origin string) bool {
+	for _, allowedOrigin := range o.AllowedOrigins {
+		if allowedOrigin == "*" || strings.EqualFold(allowedOrigin, origin) {
+			return true
+		}
+		if matchesWildcard(allowedOrigin, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesWildcard(pattern string, origin string) bool {
+	index := strings.Index(pattern, "://*.")
+	if index < 0 {
+		return false
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil || len(originURL.Host) == 0 {
+		return false
+	}
+	scheme := pattern[:index]
+	suffix := pattern[index+len("://*"):]
+	//
+	// The wildcard must match at least one label, e.g. 'https://*.example.com' does not match 'https://example.com'
+	//
+	host := strings.ToLower(originURL.Host)
+	return strings.EqualFold(originURL.Scheme, scheme) &&
+		strings.HasSuffix(host, strings.ToLower(suffix)) && len(host) > len(suffix)
+}
+
+// corsMiddleware adds the CORS headers to requests from allowed origins and answers preflight requests. Routes must
+// also accept the OPTIONS method for preflight requests to reach the middleware.
+func (o CORSOptions) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(headerOrigin)
+		w.Header().Add(headerVary, headerOrigin)
+		preflight := r.Method == http.MethodOptions
+		if len(origin) == 0 || !o.allowed(origin) {
+			//
+			// Without the headers, the browser rejects the request
+			//
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if o.AllowCredentials || !o.allowsAny() {
+			w.Header().Set(headerAllowOrigin, origin)
+		} else {
+			w.Header().Set(headerAllowOrigin, "*")
+		}
+		if o.AllowCredentials {
+			w.Header().Set(headerAllowCredentials, "true")
+		}
+		if preflight {
+			w.Header().Add(headerVary, headerRequestMethod)
+			w.Header().Set(headerAllowMethods, strings.Join(o.AllowedMethods, ", "))
+			w.Header().Set(headerAllowHeaders, strings.Join(o.AllowedHeaders, ", "))
+			if o.MaxAge > 0 {
+				w.Header().Set(headerMaxAge, strconv.Itoa(int(o.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if len(o.ExposedHeaders) > 0 {
+			w.Header().Set(headerExposeHeaders, strings.Join(o.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (o CORSOptions) allowsAny() bool {
+	for _, allowedOrigin := range o.AllowedOrigins {
+		if allowedOrigin == "*" {
+			return true
+		}
+	}
+	return false
+}
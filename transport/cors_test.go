@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var corsOptions = CORSOptions{
+	AllowedOrigins:   []string{"https://launcher.example.com", "https://*.ubi.com"},
+	AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+	AllowedHeaders:   []string{"Content-Type", "Ubi-UserId", "Authorization"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+var originTable = []struct {
+	origin  string
+	allowed bool
+}{
+	{origin: "https://launcher.example.com", allowed: true},
+	{origin: "https://LAUNCHER.example.com", allowed: true},
+	{origin: "https://store.ubi.com", allowed: true},
+	{origin: "https://a.b.ubi.com", allowed: true},
+	{origin: "https://ubi.com", allowed: false},
+	{origin: "http://store.ubi.com", allowed: false},
+	{origin: "https://evilubi.com", allowed: false},
+	{origin: "https://example.com", allowed: false},
+}
+
+func TestCORSOptions_Allowed(t *testing.T) {
+	for _, entry := range originTable {
+		if allowed := corsOptions.allowed(entry.origin); allowed != entry.allowed {
+			t.Errorf("expected origin %s allowed to be %t", entry.origin, entry.allowed)
+		}
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	called := false
+	handler := corsOptions.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	request := httptest.NewRequest(http.MethodOptions, "/987", nil)
+	request.Header.Set("Origin", "https://store.ubi.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if called {
+		t.Error("expected preflight request to not reach the handler")
+	}
+	if status := recorder.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+	expectedHeaders := map[string]string{
+		"Access-Control-Allow-Origin":      "https://store.ubi.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Content-Type, Ubi-UserId, Authorization",
+		"Access-Control-Max-Age":           "600",
+	}
+	for header, expected := range expectedHeaders {
+		if actual := recorder.Header().Get(header); actual != expected {
+			t.Errorf("unexpected header %s: got %v want %v", header, actual, expected)
+		}
+	}
+}
+
+func TestCORSMiddleware_DisallowedOrigin(t *testing.T) {
+	called := false
+	handler := corsOptions.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	request := httptest.NewRequest(http.MethodPost, "/987", nil)
+	request.Header.Set("Origin", "https://example.com")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if !called {
+		t.Error("expected request to reach the handler")
+	}
+	if origin := recorder.Header().Get("Access-Control-Allow-Origin"); len(origin) > 0 {
+		t.Errorf("expected no allowed origin but got %s", origin)
+	}
+}
+
+func TestCORSMiddleware_AnyOrigin(t *testing.T) {
+	options := CORSOptions{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"Location"}}
+	handler := options.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := httptest.NewRequest(http.MethodGet, "/987", nil)
+	request.Header.Set("Origin", "https://example.com")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("expected any origin to be allowed but got %s", origin)
+	} else if exposed := recorder.Header().Get("Access-Control-Expose-Headers"); exposed != "Location" {
+		t.Errorf("expected exposed headers but got %s", exposed)
+	}
+}
@@ -1,17 +1,24 @@
 package transport_test
 
 import (
+	"context"
 	"errors"
 	"github.com/Piszmog/feedback-service/db"
 	"github.com/Piszmog/feedback-service/model"
+	"sort"
+	"strconv"
 )
 
 type mockDB struct {
 	existsError bool
 	exists      bool
 	insertError bool
+	duplicates  map[string]bool
 	findError   bool
 	feedbacks   []model.Feedback
+	audit       []db.AuditEntry
+	reports     map[int32]db.ReportCount
+	reporters   map[string]bool
 }
 
 func (m mockDB) Exists(userID string, sessionID string) (bool, error) {
@@ -21,11 +28,165 @@ func (m mockDB) Exists(userID string, sessionID string) (bool, error) {
 	return m.exists, nil
 }
 
-func (m mockDB) Insert(feedback model.Feedback) error {
+func (m mockDB) Insert(feedback model.Feedback) (model.Feedback, error) {
 	if m.insertError {
-		return errors.New("failed to insert")
+		return model.Feedback{}, errors.New("failed to insert")
 	}
-	return nil
+	feedback.ID = 1
+	feedback.Version = 1
+	return feedback, nil
+}
+
+func (m mockDB) InsertBatch(feedback []model.Feedback) ([]model.Feedback, error) {
+	if m.insertError {
+		return nil, errors.New("failed to insert")
+	}
+	inserted := make([]model.Feedback, len(feedback))
+	for i, f := range feedback {
+		if !m.duplicates[f.SessionID] {
+			f.ID = int32(i + 1)
+			f.Version = 1
+			inserted[i] = f
+		}
+	}
+	return inserted, nil
+}
+
+func (m mockDB) FindByID(sessionID string, id int32) (model.Feedback, error) {
+	if m.findError {
+		return model.Feedback{}, errors.New("failed to find feedback")
+	}
+	for _, feedback := range m.feedbacks {
+		if feedback.ID == id && feedback.SessionID == sessionID {
+			if len(feedback.ModerationStatus) == 0 {
+				feedback.ModerationStatus = model.ModerationApproved
+			}
+			return feedback, nil
+		}
+	}
+	return model.Feedback{}, db.ErrNotFound
+}
+
+func (m mockDB) Update(feedback model.Feedback, version int32) (model.Feedback, error) {
+	if m.insertError {
+		return model.Feedback{}, errors.New("failed to update")
+	}
+	for _, existing := range m.feedbacks {
+		if existing.ID == feedback.ID && existing.SessionID == feedback.SessionID {
+			if existing.Version != version {
+				return model.Feedback{}, db.ErrVersionMismatch
+			}
+			feedback.Version = version + 1
+			return feedback, nil
+		}
+	}
+	return model.Feedback{}, db.ErrNotFound
+}
+
+func (m mockDB) Delete(sessionID string, id int32, version int32) error {
+	_, err := m.Update(model.Feedback{ID: id, SessionID: sessionID}, version)
+	return err
+}
+
+func (m mockDB) FindByModerationStatus(status model.ModerationStatus, limit int) ([]model.Feedback, error) {
+	if m.findError {
+		return nil, errors.New("failed to find feedback")
+	}
+	var feedback []model.Feedback
+	for _, f := range m.feedbacks {
+		if f.ModerationStatus == status {
+			feedback = append(feedback, f)
+		}
+	}
+	return feedback, nil
+}
+
+func (m mockDB) SetModerationStatus(id int32, status model.ModerationStatus, reason string, actor string) (
+	db.ModerationChange, error) {
+	if m.insertError {
+		return db.ModerationChange{}, errors.New("failed to moderate")
+	}
+	for _, feedback := range m.feedbacks {
+		if feedback.ID == id {
+			after := feedback
+			after.ModerationStatus = status
+			after.ModerationReason = reason
+			after.Version++
+			return db.ModerationChange{Before: feedback, After: after}, nil
+		}
+	}
+	return db.ModerationChange{}, db.ErrNotFound
+}
+
+func (m mockDB) Report(report model.Report, threshold int) (db.ReportResult, error) {
+	if m.insertError {
+		return db.ReportResult{}, errors.New("failed to report")
+	} else if m.reporters[report.ReporterID] {
+		return db.ReportResult{}, db.ErrDuplicateReport
+	}
+	for _, feedback := range m.feedbacks {
+		if feedback.ID == report.FeedbackID && feedback.SessionID == report.SessionID {
+			reports := m.reports[feedback.ID].Total + 1
+			if threshold <= 0 || reports != threshold {
+				return db.ReportResult{Reports: reports}, nil
+			}
+			feedback.ModerationStatus = model.ModerationHidden
+			feedback.Version++
+			return db.ReportResult{Reports: reports, Hidden: true, Feedback: feedback}, nil
+		}
+	}
+	return db.ReportResult{}, db.ErrNotFound
+}
+
+func (m mockDB) ReportCounts(ids []int32) (map[int32]db.ReportCount, error) {
+	if m.findError {
+		return nil, errors.New("failed to count reports")
+	}
+	return m.reports, nil
+}
+
+func (m mockDB) FindReported(limit int) ([]model.Feedback, error) {
+	if m.findError {
+		return nil, errors.New("failed to find feedback")
+	}
+	var feedback []model.Feedback
+	for _, f := range m.feedbacks {
+		if _, ok := m.reports[f.ID]; ok && f.Visible() {
+			feedback = append(feedback, f)
+		}
+	}
+	return feedback, nil
+}
+
+func (m mockDB) FindAudit(filter db.AuditFilter, limit int) ([]db.AuditEntry, error) {
+	if m.findError {
+		return nil, errors.New("failed to find the audit")
+	}
+	var entries []db.AuditEntry
+	for _, entry := range m.audit {
+		if entry.ID > filter.AfterID && (len(filter.Actor) == 0 || entry.Actor == filter.Actor) &&
+			(len(filter.Action) == 0 || entry.Action == filter.Action) && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m mockDB) Summarize(sessionID string) (db.Summary, error) {
+	if m.findError {
+		return db.Summary{}, errors.New("failed to summarize feedback")
+	}
+	var summary db.Summary
+	for _, feedback := range m.feedbacks {
+		if feedback.SessionID == sessionID && feedback.Visible() {
+			summary.Count++
+			summary.RatingSum += int64(feedback.Rating)
+			if feedback.ID > summary.LastID {
+				summary.LastID = feedback.ID
+			}
+		}
+	}
+	return summary, nil
 }
 
 func (m mockDB) Find(sessionID string, sort db.Sort, limit int) ([]model.Feedback, error) {
@@ -42,4 +203,63 @@ func (m mockDB) FindWithFilter(sessionID string, filter db.Filter, sort db.Sort,
 	return m.feedbacks, nil
 }
 
+func (m mockDB) Export(ctx context.Context, filter db.ExportFilter, fn func(feedback model.Feedback) error) error {
+	if m.findError {
+		return errors.New("failed to export feedback")
+	}
+	for _, feedback := range m.feedbacks {
+		if len(feedback.ModerationStatus) == 0 {
+			feedback.ModerationStatus = model.ModerationApproved
+		}
+		if len(filter.ModerationStatus) > 0 && feedback.ModerationStatus != filter.ModerationStatus {
+			continue
+		}
+		if err := fn(feedback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m mockDB) Close() {}
+
+func (m mockDB) SummarizeSessions(sessionIDs []string) (map[string]db.Summary, error) {
+	summaries := make(map[string]db.Summary, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		summary, err := m.Summarize(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		summaries[sessionID] = summary
+	}
+	return summaries, nil
+}
+
+func (m mockDB) FindPages(pages []db.Page) ([][]model.Feedback, error) {
+	if m.findError {
+		return nil, errors.New("failed to find feedback")
+	}
+	//
+	// Pages are ordered by date, then ID, most recent first
+	//
+	feedbacks := append([]model.Feedback(nil), m.feedbacks...)
+	sort.SliceStable(feedbacks, func(i, j int) bool {
+		if !feedbacks[i].Date.Equal(feedbacks[j].Date) {
+			return feedbacks[i].Date.After(feedbacks[j].Date)
+		}
+		return feedbacks[i].ID > feedbacks[j].ID
+	})
+	found := make([][]model.Feedback, len(pages))
+	for i, page := range pages {
+		for _, f := range feedbacks {
+			before := page.BeforeID == 0 || f.Date.Before(page.BeforeDate) ||
+				(f.Date.Equal(page.BeforeDate) && f.ID < page.BeforeID)
+			if f.SessionID == page.SessionID && f.Visible() && before &&
+				(len(page.Filter.Rating) == 0 || strconv.Itoa(int(f.Rating)) == page.Filter.Rating) &&
+				len(found[i]) < page.Limit {
+				found[i] = append(found[i], f)
+			}
+		}
+	}
+	return found, nil
+}
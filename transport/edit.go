@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// feedbackChange is the change a user makes to their feedback. Fields that are not provided are left as is.
+type feedbackChange struct {
+	Comment *string `json:"comment"`
+	Rating  *int8   `json:"rating"`
+}
+
+// UpdateFeedback lets a user change the comment and rating of their feedback. The If-Match header must have the
+// current ETag of the feedback, otherwise a 412 is returned, so changes made by someone else are not lost. A changed
+// comment is moderated again.
+func (s *HTTPServer) UpdateFeedback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		change, ok := ownChange(w, r)
+		if !ok {
+			return
+		}
+		//
+		// Apply the change
+		//
+		defer closeRequestBody(r.Body)
+		var body feedbackChange
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to decode the change to feedback %d for session %s",
+				change.ID, change.SessionID), err, w)
+			return
+		}
+		change.Comment = body.Comment
+		change.Rating = body.Rating
+		updated, err := s.service().Update(change)
+		if err != nil {
+			writeChangeError(err, updated, fmt.Sprintf("Failed to update feedback %d for session %s", change.ID,
+				change.SessionID), w)
+			return
+		}
+		w.Header().Set(headerETag, feedbackETag(updated.Version))
+		if err := json.NewEncoder(w).Encode(updated); err != nil {
+			log.Println(fmt.Errorf("failed to write feedback %d from session %s: %w", updated.ID, updated.SessionID, err))
+		}
+	}
+}
+
+// DeleteFeedback lets a user delete their feedback. The If-Match header must have the current ETag of the feedback,
+// otherwise a 412 is returned.
+func (s *HTTPServer) DeleteFeedback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		change, ok := ownChange(w, r)
+		if !ok {
+			return
+		}
+		deleted, err := s.service().Delete(change.UserID, change.SessionID, change.ID, change.Matches)
+		if err != nil {
+			writeChangeError(err, deleted, fmt.Sprintf("Failed to delete feedback %d for session %s", change.ID,
+				change.SessionID), w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ownChange provides the change of the request a user makes to their feedback, matching the versions of the If-Match
+// header. The error is written and false is returned if the user or If-Match header is missing or the feedback ID is
+// not valid.
+func ownChange(w http.ResponseWriter, r *http.Request) (feedback.Change, bool) {
+	sessionID := mux.Vars(r)[pathSessionID]
+	userID := strings.TrimSpace(r.Header.Get(headerUserID))
+	if len(userID) == 0 {
+		writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing Header '%s'", headerUserID), nil, w)
+		return feedback.Change{}, false
+	}
+	ifMatch := r.Header.Get(headerIfMatch)
+	if len(ifMatch) == 0 {
+		writeHTTPError(http.StatusPreconditionRequired, fmt.Sprintf("Missing Header '%s'", headerIfMatch), nil, w)
+		return feedback.Change{}, false
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 32)
+	if err != nil {
+		writeHTTPError(http.StatusNotFound,
+			fmt.Sprintf("Feedback %s does not exist for session %s", mux.Vars(r)[pathID], sessionID), nil, w)
+		return feedback.Change{}, false
+	}
+	return feedback.Change{
+		UserID:    userID,
+		SessionID: sessionID,
+		ID:        int32(id),
+		Matches: func(version int32) bool {
+			return etagMatches(ifMatch, feedbackETag(version), false)
+		},
+	}, true
+}
+
+// writeChangeError writes the error of a failed change to a feedback. The current ETag of the feedback is provided
+// when it changed since the version the change is based on.
+func writeChangeError(err error, current model.Feedback, fallback string, w http.ResponseWriter) {
+	if errors.Is(err, feedback.ErrChanged) && current.Version > 0 {
+		w.Header().Set(headerETag, feedbackETag(current.Version))
+	}
+	writeServiceError(err, fallback, w)
+}
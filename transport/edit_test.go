@@ -0,0 +1,108 @@
+package transport_test
+
+import (
+	"bytes"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var editFeedback = []model.Feedback{
+	{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Date: time.Now(), Version: 2},
+}
+
+func TestHTTPServer_UpdateFeedback(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       string
+		ifMatch      string
+		body         string
+		expectedCode int
+		expectedETag string
+	}{
+		{name: "Updated", userID: "123", ifMatch: `"2"`, body: `{"rating":5}`, expectedCode: http.StatusOK, expectedETag: `"3"`},
+		{name: "Any Version", userID: "123", ifMatch: `*`, body: `{"comment":"Changed"}`, expectedCode: http.StatusOK, expectedETag: `"3"`},
+		{name: "Stale", userID: "123", ifMatch: `"1"`, body: `{"rating":5}`, expectedCode: http.StatusPreconditionFailed, expectedETag: `"2"`},
+		{name: "Weak", userID: "123", ifMatch: `W/"2"`, body: `{"rating":5}`, expectedCode: http.StatusPreconditionFailed, expectedETag: `"2"`},
+		{name: "Missing If-Match", userID: "123", body: `{"rating":5}`, expectedCode: http.StatusPreconditionRequired},
+		{name: "Other User", userID: "456", ifMatch: `"2"`, body: `{"rating":5}`, expectedCode: http.StatusForbidden},
+		{name: "Invalid Rating", userID: "123", ifMatch: `"2"`, body: `{"rating":9}`, expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: editFeedback}))
+			request := httptest.NewRequest(http.MethodPatch, "/v1/sessions/987/feedback/1",
+				bytes.NewReader([]byte(test.body)))
+			request.Header.Set("Ubi-UserId", test.userID)
+			if len(test.ifMatch) > 0 {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if etag := recorder.Header().Get("ETag"); etag != test.expectedETag {
+				t.Errorf("expected ETag %s but got %s", test.expectedETag, etag)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_DeleteFeedback(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		ifMatch      string
+		expectedCode int
+	}{
+		{name: "Deleted", path: "/v1/sessions/987/feedback/1", ifMatch: `"2"`, expectedCode: http.StatusNoContent},
+		{name: "Stale", path: "/v1/sessions/987/feedback/1", ifMatch: `"1", "3"`, expectedCode: http.StatusPreconditionFailed},
+		{name: "Missing", path: "/v1/sessions/987/feedback/2", ifMatch: `"2"`, expectedCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: editFeedback}))
+			request := httptest.NewRequest(http.MethodDelete, test.path, nil)
+			request.Header.Set("Ubi-UserId", "123")
+			request.Header.Set("If-Match", test.ifMatch)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			}
+		})
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: editFeedback}))
+	for _, path := range []string{"/v1/sessions/987/feedback", "/v1/sessions/987/feedback/1"} {
+		t.Run(path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+			etag := recorder.Header().Get("ETag")
+			if recorder.Code != http.StatusOK || len(etag) == 0 {
+				t.Fatalf("expected 200 with an ETag but got %v %s", recorder.Code, etag)
+			}
+			request := httptest.NewRequest(http.MethodGet, path, nil)
+			request.Header.Set("If-None-Match", "W/"+etag)
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusNotModified {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusNotModified)
+			} else if recorder.Body.Len() > 0 {
+				t.Errorf("expected no body but got %s", recorder.Body.String())
+			}
+			request = httptest.NewRequest(http.MethodGet, path, nil)
+			request.Header.Set("If-None-Match", `"stale"`)
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package transport
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/parquet-go/parquet-go"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFlushInterval      = 1000
+	exportRowGroupSize       = 10000
+	formatCSV                = "csv"
+	formatNDJSON             = "ndjson"
+	formatParquet            = "parquet"
+	headerAcceptEncoding     = "Accept-Encoding"
+	headerContentDisposition = "Content-Disposition"
+	headerContentEncoding    = "Content-Encoding"
+	queryFormat              = "format"
+	queryFrom                = "from"
+	querySessionID           = "sessionId"
+	queryTo                  = "to"
+)
+
+// exportStatuses are the moderation statuses of the feedback that can be exported.
+var exportStatuses = map[model.ModerationStatus]bool{
+	model.ModerationApproved: true,
+	model.ModerationFlagged:  true,
+	model.ModerationHidden:   true,
+	model.ModerationRejected: true,
+}
+
+var exportContentTypes = map[string]string{
+	formatCSV:     "text/csv",
+	formatNDJSON:  "application/x-ndjson",
+	formatParquet: "application/vnd.apache.parquet",
+}
+
+// ExportFeedback streams the feedback matching the query as CSV, NDJSON or Parquet. Only approved feedback is exported
+// unless the 'status' query param is another moderation status. The response is compressed with gzip when the client
+// accepts it.
+func (s *HTTPServer) ExportFeedback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get(queryFormat)
+		if len(format) == 0 {
+			format = formatCSV
+		}
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Format '%s' is not one of '%s', '%s' or '%s'", format, formatCSV, formatNDJSON, formatParquet),
+				nil, w)
+			return
+		}
+		filter, err := exportFilter(query.Get(querySessionID), query.Get(queryFrom), query.Get(queryTo))
+		if err != nil {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusBadRequest, "Invalid export query", err, w)
+			return
+		}
+		//
+		// Feedback that is not shown is only exported when asked for
+		//
+		filter.ModerationStatus = model.ModerationApproved
+		if status := query.Get(queryStatus); len(status) > 0 {
+			filter.ModerationStatus = model.ModerationStatus(status)
+			if !exportStatuses[filter.ModerationStatus] {
+				w.Header().Set(headerContentType, contentTypeJSON)
+				writeHTTPError(http.StatusBadRequest,
+					fmt.Sprintf("Query param '%s' must be one of '%s', '%s', '%s' or '%s'", queryStatus,
+						model.ModerationApproved, model.ModerationFlagged, model.ModerationHidden,
+						model.ModerationRejected), nil, w)
+				return
+			}
+		}
+		//
+		// An export can take longer than the server's write timeout
+		//
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Println(fmt.Errorf("failed to clear the write deadline of the export: %w", err))
+		}
+		w.Header().Set(headerContentType, contentType)
+		w.Header().Set(headerContentDisposition, fmt.Sprintf(`attachment; filename="feedback.%s"`, format))
+		w.Header().Add(headerVary, headerAcceptEncoding)
+		body := &exportWriter{ResponseWriter: w}
+		var out io.Writer = body
+		var gzipWriter *gzip.Writer
+		if acceptsGzip(r) {
+			w.Header().Set(headerContentEncoding, "gzip")
+			gzipWriter = gzip.NewWriter(body)
+			out = gzipWriter
+		}
+		//
+		// Stream each row. Once the body is started the status cannot change, so failures abort the response
+		//
+		exporter := newExporter(format, out)
+		rows := 0
+		err = s.DB.Export(r.Context(), filter, func(feedback model.Feedback) error {
+			if err := exporter.write(feedback); err != nil {
+				return err
+			}
+			rows++
+			if rows%exportFlushInterval == 0 {
+				return flushExport(exporter, gzipWriter, body)
+			}
+			return nil
+		})
+		if err == nil {
+			err = exporter.close()
+		}
+		if err == nil && gzipWriter != nil {
+			err = gzipWriter.Close()
+		}
+		if err != nil && !body.started {
+			w.Header().Del(headerContentDisposition)
+			w.Header().Del(headerContentEncoding)
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusInternalServerError, "Failed to export feedback", err, w)
+		} else if err != nil {
+			log.Println(fmt.Errorf("failed to export feedback after %d rows: %w", rows, err))
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// exportWriter writes the body of an export, keeping track of whether it has started.
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (e *exportWriter) Write(b []byte) (int, error) {
+	e.started = true
+	return e.ResponseWriter.Write(b)
+}
+
+// Flush sends what was written so far, which starts the body.
+func (e *exportWriter) Flush() {
+	e.started = true
+	if flusher, ok := e.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func exportFilter(sessionID string, from string, to string) (db.ExportFilter, error) {
+	filter := db.ExportFilter{SessionID: sessionID}
+	var err error
+	if len(from) > 0 {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fmt.Errorf("'%s' must be an RFC 3339 date: %w", queryFrom, err)
+		}
+	}
+	if len(to) > 0 {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fmt.Errorf("'%s' must be an RFC 3339 date: %w", queryTo, err)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		return filter, fmt.Errorf("'%s' must be after '%s'", queryTo, queryFrom)
+	}
+	return filter, nil
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get(headerAcceptEncoding), ",") {
+		if strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+func flushExport(exporter exporter, gzipWriter *gzip.Writer, w http.ResponseWriter) error {
+	if err := exporter.flush(); err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Flush(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// exporter writes feedback in an export format.
+type exporter interface {
+	write(feedback model.Feedback) error
+	// flush writes any buffered feedback.
+	flush() error
+	// close completes the export.
+	close() error
+}
+
+func newExporter(format string, w io.Writer) exporter {
+	switch format {
+	case formatNDJSON:
+		return ndjsonExporter{encoder: json.NewEncoder(w)}
+	case formatParquet:
+		return parquetExporter{writer: parquet.NewWriter(w, parquet.SchemaOf(parquetFeedback{}),
+			parquet.MaxRowsPerRowGroup(exportRowGroupSize))}
+	default:
+		return newCSVExporter(w)
+	}
+}
+
+type csvExporter struct {
+	writer *csv.Writer
+}
+
+var csvHeader = []string{"id", "userId", "sessionId", "comment", "rating", "date"}
+
+func newCSVExporter(w io.Writer) *csvExporter {
+	writer := csv.NewWriter(w)
+	//
+	// Any failure to write the header is reported when flushed
+	//
+	_ = writer.Write(csvHeader)
+	return &csvExporter{writer: writer}
+}
+
+func (e *csvExporter) write(feedback model.Feedback) error {
+	return e.writer.Write([]string{
+		strconv.Itoa(int(feedback.ID)),
+		feedback.UserID,
+		feedback.SessionID,
+		feedback.Comment,
+		strconv.Itoa(int(feedback.Rating)),
+		feedback.Date.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvExporter) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExporter) close() error {
+	return e.flush()
+}
+
+type ndjsonExporter struct {
+	encoder *json.Encoder
+}
+
+func (e ndjsonExporter) write(feedback model.Feedback) error {
+	return e.encoder.Encode(feedback)
+}
+
+func (e ndjsonExporter) flush() error {
+	return nil
+}
+
+func (e ndjsonExporter) close() error {
+	return nil
+}
+
+// parquetFeedback is the schema of the Parquet export.
+type parquetFeedback struct {
+	ID        int32     `parquet:"id"`
+	UserID    string    `parquet:"userId"`
+	SessionID string    `parquet:"sessionId"`
+	Comment   string    `parquet:"comment"`
+	Rating    int32     `parquet:"rating"`
+	Date      time.Time `parquet:"date,timestamp(microsecond)"`
+}
+
+type parquetExporter struct {
+	writer *parquet.Writer
+}
+
+func (e parquetExporter) write(feedback model.Feedback) error {
+	return e.writer.Write(parquetFeedback{
+		ID:        feedback.ID,
+		UserID:    feedback.UserID,
+		SessionID: feedback.SessionID,
+		Comment:   feedback.Comment,
+		Rating:    int32(feedback.Rating),
+		Date:      feedback.Date.UTC(),
+	})
+}
+
+// flush is a no-op since Parquet is written a row group at a time.
+func (e parquetExporter) flush() error {
+	return nil
+}
+
+func (e parquetExporter) close() error {
+	return e.writer.Close()
+}
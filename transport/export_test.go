@@ -0,0 +1,194 @@
+package transport_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"github.com/gorilla/mux"
+	"github.com/parquet-go/parquet-go"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var exportFeedback = []model.Feedback{
+	{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Date: time.Date(2019, 11, 12, 21, 0, 0, 0, time.UTC)},
+	{ID: 2, UserID: "456", SessionID: "987", Comment: "Another, \"quoted\"", Rating: 2, Date: time.Date(2019, 11, 13, 8, 30, 0, 0, time.UTC)},
+	{ID: 3, UserID: "789", SessionID: "987", Comment: "Flagged", Rating: 1, Date: time.Date(2019, 11, 14, 9, 0, 0, 0, time.UTC),
+		ModerationStatus: model.ModerationFlagged},
+}
+
+func TestHTTPServer_ExportFeedback_CSV(t *testing.T) {
+	recorder := serveExport(t, "/export?sessionId=987", "")
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	} else if contentType := recorder.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("handler returned wrong content type: got %v want text/csv", contentType)
+	}
+	expected := "id,userId,sessionId,comment,rating,date\n" +
+		"1,123,987,A Test,4,2019-11-12T21:00:00Z\n" +
+		"2,456,987,\"Another, \"\"quoted\"\"\",2,2019-11-13T08:30:00Z\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
+
+func TestHTTPServer_ExportFeedback_NDJSONGzip(t *testing.T) {
+	recorder := serveExport(t, "/export?format=ndjson&from=2019-11-01T00:00:00Z&to=2019-12-01T00:00:00Z", "gzip")
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	} else if encoding := recorder.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Errorf("handler returned wrong content encoding: got %v want gzip", encoding)
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got %d", len(lines))
+	}
+	var feedback model.Feedback
+	if err := json.Unmarshal([]byte(lines[1]), &feedback); err != nil {
+		t.Fatal(err)
+	} else if feedback.ID != 2 || feedback.Comment != exportFeedback[1].Comment {
+		t.Errorf("unexpected feedback %+v", feedback)
+	}
+}
+
+func TestHTTPServer_ExportFeedback_Parquet(t *testing.T) {
+	recorder := serveExport(t, "/export?format=parquet", "")
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	content := recorder.Body.Bytes()
+	file, err := parquet.OpenFile(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := file.NumRows(); rows != 2 {
+		t.Errorf("expected 2 rows but got %d", rows)
+	}
+	for _, column := range []string{"id", "userId", "sessionId", "comment", "rating", "date"} {
+		if _, ok := file.Schema().Lookup(column); !ok {
+			t.Errorf("expected column %s in the schema", column)
+		}
+	}
+}
+
+func TestHTTPServer_ExportFeedback_InvalidQuery(t *testing.T) {
+	recorder := serveExport(t, "/export?format=xml", "")
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	expected := `{"statusCode":400, "reason":"Format 'xml' is not one of 'csv', 'ndjson' or 'parquet'"}`
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+	recorder = serveExport(t, "/export?from=yesterday", "")
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestHTTPServer_ExportFeedback_ModerationStatus(t *testing.T) {
+	recorder := serveExport(t, "/export?status=flagged", "")
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	expected := "id,userId,sessionId,comment,rating,date\n" +
+		"3,789,987,Flagged,1,2019-11-14T09:00:00Z\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+	recorder = serveExport(t, "/export?status=pending", "")
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestHTTPServer_ExportFeedback_RequiresOperator(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{name: "Missing Token", expectedCode: http.StatusUnauthorized},
+		{name: "Wrong Token", authorization: "Bearer guess", expectedCode: http.StatusUnauthorized},
+		{name: "Operator", authorization: "Bearer secret", expectedCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: exportFeedback}),
+				transport.WithOperatorTokens("secret"))
+			request := httptest.NewRequest(http.MethodGet, "/v1/export", nil)
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			}
+		})
+	}
+}
+
+func serveExport(t *testing.T, path string, acceptEncoding string) *httptest.ResponseRecorder {
+	//
+	// Create server
+	//
+	server := transport.HTTPServer{DB: mockDB{feedbacks: exportFeedback}}
+	//
+	// Create Request, recorder, and handler
+	//
+	request, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acceptEncoding) > 0 {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/export", server.ExportFeedback())
+	//
+	// Serve
+	//
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHTTPServer_ExportFeedback_ExportError(t *testing.T) {
+	server := transport.HTTPServer{DB: mockDB{findError: true}}
+	request, err := http.NewRequest(http.MethodGet, "/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/export", server.ExportFeedback())
+	//
+	// Nothing was written yet, so the failure is reported rather than the response aborted
+	//
+	router.ServeHTTP(recorder, request)
+	if status := recorder.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	} else if recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("Content-Disposition") != "" {
+		t.Errorf("expected no export headers but got %v", recorder.Header())
+	}
+	expected := `{"statusCode":500, "reason":"Failed to export feedback"}`
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
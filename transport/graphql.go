@@ -0,0 +1,338 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pathGraphQL = "/graphql"
+	// defaultGraphQLComplexity is how complex a GraphQL query can be when no limit is configured.
+	defaultGraphQLComplexity = 1000
+	// maxGraphQLSessions is how many sessions a GraphQL query can request at once.
+	maxGraphQLSessions = 100
+	// maxGraphQLPage is how many feedback a page can have.
+	maxGraphQLPage = 100
+	// cursorPrefix is prefixed to the date and ID of a feedback before they are encoded into an opaque cursor.
+	cursorPrefix = "feedback:"
+)
+
+// graphQLLoaderKey is the context key of the loader of a GraphQL query.
+type graphQLLoaderKey struct{}
+
+// graphQLRequest is a GraphQL query as it is posted.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// feedbackConnection is a page of the feedback of a session.
+type feedbackConnection struct {
+	feedback    []model.Feedback
+	hasNextPage bool
+}
+
+// GraphQL executes the GraphQL queries posted by dashboards. Queries are validated and their complexity is checked
+// before they are executed, an invalid or too complex query is answered with a 400. The errors of a query that was
+// executed are returned along with its data.
+func (s *HTTPServer) GraphQL() func(w http.ResponseWriter, r *http.Request) {
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		panic(fmt.Errorf("failed to create the GraphQL schema: %w", err))
+	}
+	maxComplexity := s.GraphQLMaxComplexity
+	if maxComplexity <= 0 {
+		maxComplexity = defaultGraphQLComplexity
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		defer closeRequestBody(r.Body)
+		var request graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeHTTPError(http.StatusBadRequest, "Failed to decode the GraphQL query", err, w)
+			return
+		}
+		//
+		// Parse, validate and check the complexity of the query before any of it is resolved
+		//
+		document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+			Body: []byte(request.Query),
+			Name: "GraphQL request",
+		})})
+		if err != nil {
+			writeGraphQL(http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, w)
+			return
+		}
+		if validation := graphql.ValidateDocument(&schema, document, nil); !validation.IsValid {
+			writeGraphQL(http.StatusBadRequest, &graphql.Result{Errors: validation.Errors}, w)
+			return
+		}
+		complexity := queryComplexity(document, request.OperationName, request.Variables)
+		if complexity > maxComplexity {
+			writeGraphQL(http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf(
+				"query complexity %d is greater than the maximum of %d", complexity, maxComplexity))}, w)
+			return
+		}
+		//
+		// Every read of the query goes through its loader so sessions are read together
+		//
+		ctx := context.WithValue(r.Context(), graphQLLoaderKey{}, newGraphQLLoader(s.DB))
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           document,
+			OperationName: request.OperationName,
+			Args:          request.Variables,
+			Context:       ctx,
+		})
+		for _, resultError := range result.Errors {
+			log.Println(fmt.Errorf("failed to resolve GraphQL query: %s", resultError.Message))
+		}
+		writeGraphQL(http.StatusOK, result, w)
+	}
+}
+
+func writeGraphQL(statusCode int, result *graphql.Result, w http.ResponseWriter) {
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Println(fmt.Errorf("failed to write the GraphQL result: %w", err))
+	}
+}
+
+// newGraphQLSchema creates the schema of the sessions, their feedback and summaries.
+func newGraphQLSchema() (graphql.Schema, error) {
+	summaryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Summary",
+		Description: "The count and average rating of the approved feedback of a session.",
+		Fields: graphql.Fields{
+			"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source.(db.Summary).Count, nil
+			}},
+			"average": &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source.(db.Summary).Average(), nil
+			}},
+			"lastId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source.(db.Summary).LastID, nil
+			}},
+		},
+	})
+	feedbackType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Feedback",
+		Description: "The feedback a user provided for a session.",
+		Fields: graphql.Fields{
+			"id":        feedbackField(graphql.Int, func(f model.Feedback) interface{} { return f.ID }),
+			"userId":    feedbackField(graphql.ID, func(f model.Feedback) interface{} { return f.UserID }),
+			"sessionId": feedbackField(graphql.ID, func(f model.Feedback) interface{} { return f.SessionID }),
+			"comment":   feedbackField(graphql.String, func(f model.Feedback) interface{} { return f.Comment }),
+			"rating":    feedbackField(graphql.Int, func(f model.Feedback) interface{} { return f.Rating }),
+			"date":      feedbackField(graphql.DateTime, func(f model.Feedback) interface{} { return f.Date }),
+			"version":   feedbackField(graphql.Int, func(f model.Feedback) interface{} { return f.Version }),
+		},
+	})
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(
+				p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(feedbackConnection).hasNextPage, nil
+			}},
+			"endCursor": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{},
+				error) {
+				feedback := p.Source.(feedbackConnection).feedback
+				if len(feedback) == 0 {
+					return nil, nil
+				}
+				return encodeCursor(feedback[len(feedback)-1]), nil
+			}},
+		},
+	})
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "FeedbackEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return encodeCursor(p.Source.(model.Feedback)), nil
+			}},
+			"node": &graphql.Field{Type: graphql.NewNonNull(feedbackType), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source, nil
+			}},
+		},
+	})
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "FeedbackConnection",
+		Description: "A page of the approved feedback of a session, most recent date first.",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))),
+				Resolve: resolveConnectionFeedback},
+			"nodes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(feedbackType))),
+				Resolve: resolveConnectionFeedback},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source, nil
+			}},
+		},
+	})
+	sessionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Session",
+		Description: "A session users provide feedback for.",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return p.Source.(string), nil
+			}},
+			"summary": &graphql.Field{Type: graphql.NewNonNull(summaryType), Resolve: func(p graphql.ResolveParams) (
+				interface{}, error) {
+				return graphQLLoaderFrom(p.Context).summary(p.Source.(string)), nil
+			}},
+			"feedback": &graphql.Field{
+				Type: graphql.NewNonNull(connectionType),
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: feedback.ListLimit,
+						Description: fmt.Sprintf("How many feedback are returned, between 1 and %d.", maxGraphQLPage)},
+					"after": &graphql.ArgumentConfig{Type: graphql.String,
+						Description: "The endCursor of the previous page."},
+					"rating": &graphql.ArgumentConfig{Type: graphql.Int,
+						Description: "Only returns the feedback with the rating."},
+				},
+				Resolve: resolveSessionFeedback,
+			},
+		},
+	})
+	//
+	// The session of a feedback is added once the session type exists, since they refer to each other
+	//
+	feedbackType.AddFieldConfig("session", &graphql.Field{Type: graphql.NewNonNull(sessionType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(model.Feedback).SessionID, nil
+		}})
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"session": &graphql.Field{
+				Type: graphql.NewNonNull(sessionType),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Args["id"].(string), nil
+				},
+			},
+			"sessions": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sessionType))),
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(
+						graphql.ID))), Description: fmt.Sprintf("At most %d sessions.", maxGraphQLSessions)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ids := p.Args["ids"].([]interface{})
+					if len(ids) > maxGraphQLSessions {
+						return nil, fmt.Errorf("cannot request more than %d sessions", maxGraphQLSessions)
+					}
+					sessions := make([]interface{}, len(ids))
+					copy(sessions, ids)
+					return sessions, nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// feedbackField is a non null field of a feedback.
+func feedbackField(fieldType graphql.Output, value func(f model.Feedback) interface{}) *graphql.Field {
+	return &graphql.Field{Type: graphql.NewNonNull(fieldType), Resolve: func(p graphql.ResolveParams) (interface{},
+		error) {
+		return value(p.Source.(model.Feedback)), nil
+	}}
+}
+
+func resolveConnectionFeedback(p graphql.ResolveParams) (interface{}, error) {
+	feedback := p.Source.(feedbackConnection).feedback
+	nodes := make([]interface{}, len(feedback))
+	for i, f := range feedback {
+		nodes[i] = f
+	}
+	return nodes, nil
+}
+
+// resolveSessionFeedback queues the page of feedback of the session. One more feedback than requested is found to know
+// whether there is a next page.
+func resolveSessionFeedback(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxGraphQLPage {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxGraphQLPage)
+	}
+	page := db.Page{SessionID: p.Source.(string), Limit: first + 1}
+	if after, ok := p.Args["after"].(string); ok {
+		date, id, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		page.BeforeDate = date
+		page.BeforeID = id
+	}
+	if rating, ok := p.Args["rating"].(int); ok {
+		if rating < model.MinRating || rating > model.MaxRating {
+			return nil, fmt.Errorf("rating must be between %d and %d", model.MinRating, model.MaxRating)
+		}
+		page.Filter.Rating = strconv.Itoa(rating)
+	}
+	load := graphQLLoaderFrom(p.Context).page(page)
+	return func() (interface{}, error) {
+		feedback, err := load()
+		if err != nil {
+			return nil, err
+		}
+		connection := feedbackConnection{feedback: feedback}
+		if len(feedback) > first {
+			connection.feedback = feedback[:first]
+			connection.hasNextPage = true
+		}
+		return connection, nil
+	}, nil
+}
+
+func graphQLLoaderFrom(ctx context.Context) *graphQLLoader {
+	return ctx.Value(graphQLLoaderKey{}).(*graphQLLoader)
+}
+
+// encodeCursor provides the opaque cursor of the page after the feedback. Pages are ordered by date, then ID, like the
+// feedback listed by the REST API, so the cursor has both.
+func encodeCursor(feedback model.Feedback) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(feedback.Date.UnixMicro(), 10) +
+		":" + strconv.FormatInt(int64(feedback.ID), 10)))
+}
+
+// decodeCursor provides the date and ID of the feedback the cursor is after.
+func decodeCursor(cursor string) (time.Time, int32, error) {
+	value, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(value), cursorPrefix) {
+		return time.Time{}, 0, errors.New("after must be a cursor")
+	}
+	date, id, found := strings.Cut(strings.TrimPrefix(string(value), cursorPrefix), ":")
+	micros, dateErr := strconv.ParseInt(date, 10, 64)
+	parsedID, idErr := strconv.ParseInt(id, 10, 32)
+	if !found || dateErr != nil || idErr != nil || parsedID <= 0 {
+		return time.Time{}, 0, errors.New("after must be a cursor")
+	}
+	return time.UnixMicro(micros).UTC(), int32(parsedID), nil
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/graphql-go/graphql/language/ast"
+	"strconv"
+)
+
+// complexityCounter counts the complexity of a GraphQL query: every field costs 1 and the fields selected within a list
+// cost once per item the list can have. The size of a list is read from the argument bounding it, so 'first' for the
+// feedback of a session and 'ids' for sessions.
+type complexityCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// visiting are the fragments being counted, so a fragment spreading itself is not counted forever.
+	visiting map[string]bool
+}
+
+// queryComplexity provides the complexity of the operation of the document. The first operation is counted when no
+// operation name is provided.
+func queryComplexity(document *ast.Document, operationName string, variables map[string]interface{}) int {
+	counter := complexityCounter{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: make(map[string]interface{}),
+		visiting:  make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			counter.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operation == nil && (len(operationName) == 0 ||
+				(definition.Name != nil && definition.Name.Value == operationName)) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return 0
+	}
+	//
+	// Variables that are not provided take the default of their definition
+	//
+	for _, definition := range operation.VariableDefinitions {
+		name := definition.Variable.Name.Value
+		if value, ok := variables[name]; ok {
+			counter.variables[name] = value
+		} else if definition.DefaultValue != nil {
+			counter.variables[name] = definition.DefaultValue.GetValue()
+		}
+	}
+	return counter.selections(operation.SelectionSet)
+}
+
+func (c complexityCounter) selections(selectionSet *ast.SelectionSet) int {
+	if selectionSet == nil {
+		return 0
+	}
+	complexity := 0
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			complexity += 1 + c.listSize(selection)*c.selections(selection.SelectionSet)
+		case *ast.InlineFragment:
+			complexity += c.selections(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || c.visiting[name] {
+				continue
+			}
+			c.visiting[name] = true
+			complexity += c.selections(fragment.SelectionSet)
+			delete(c.visiting, name)
+		}
+	}
+	return complexity
+}
+
+// listSize provides how many items the list selected by the field can have, 1 when the field is not a list.
+func (c complexityCounter) listSize(field *ast.Field) int {
+	switch field.Name.Value {
+	case "sessions":
+		return c.argument(field, "ids", maxGraphQLSessions)
+	case "feedback":
+		return c.argument(field, "first", feedback.ListLimit)
+	}
+	return 1
+}
+
+// argument provides the size of the argument of the field: the value of an int or the length of a list. The default is
+// provided when the argument is not set.
+func (c complexityCounter) argument(field *ast.Field, name string, defaultSize int) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != name {
+			continue
+		}
+		value := argument.Value.GetValue()
+		if variable, ok := argument.Value.(*ast.Variable); ok {
+			var provided bool
+			if value, provided = c.variables[variable.Name.Value]; !provided {
+				return defaultSize
+			}
+		}
+		switch value := value.(type) {
+		case string:
+			if size, err := strconv.Atoi(value); err == nil && size > 0 {
+				return size
+			}
+		case float64:
+			if value > 0 {
+				return int(value)
+			}
+		case []interface{}:
+			return len(value)
+		case []ast.Value:
+			return len(value)
+		}
+		return defaultSize
+	}
+	return defaultSize
+}
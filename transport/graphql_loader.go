@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+)
+
+// graphQLLoader batches the reads of a GraphQL query. Resolvers request what they need and return a thunk, which the
+// executor calls once every field at the same depth is resolved, so the summaries, and pages of feedback, of every
+// session at that depth are read with a single query each rather than a query per session. Reads are cached for the
+// query. A loader serves a single query.
+type graphQLLoader struct {
+	db               db.DB
+	summaries        map[string]*summaryLoad
+	pendingSummaries []string
+	pages            map[db.Page]*pageLoad
+	pendingPages     []db.Page
+}
+
+type summaryLoad struct {
+	summary db.Summary
+	err     error
+}
+
+type pageLoad struct {
+	feedback []model.Feedback
+	err      error
+}
+
+func newGraphQLLoader(database db.DB) *graphQLLoader {
+	return &graphQLLoader{
+		db:        database,
+		summaries: make(map[string]*summaryLoad),
+		pages:     make(map[db.Page]*pageLoad),
+	}
+}
+
+// summary queues the session to be summarized. The thunk provides its summary.
+func (l *graphQLLoader) summary(sessionID string) func() (interface{}, error) {
+	if _, ok := l.summaries[sessionID]; !ok {
+		l.summaries[sessionID] = nil
+		l.pendingSummaries = append(l.pendingSummaries, sessionID)
+	}
+	return func() (interface{}, error) {
+		l.loadSummaries()
+		load := l.summaries[sessionID]
+		return load.summary, load.err
+	}
+}
+
+// loadSummaries summarizes every queued session at once.
+func (l *graphQLLoader) loadSummaries() {
+	if len(l.pendingSummaries) == 0 {
+		return
+	}
+	sessionIDs := l.pendingSummaries
+	l.pendingSummaries = nil
+	summaries, err := l.db.SummarizeSessions(sessionIDs)
+	for _, sessionID := range sessionIDs {
+		l.summaries[sessionID] = &summaryLoad{summary: summaries[sessionID], err: err}
+	}
+}
+
+// page queues the page of feedback to be found. The thunk provides its feedback.
+func (l *graphQLLoader) page(page db.Page) func() ([]model.Feedback, error) {
+	if _, ok := l.pages[page]; !ok {
+		l.pages[page] = nil
+		l.pendingPages = append(l.pendingPages, page)
+	}
+	return func() ([]model.Feedback, error) {
+		l.loadPages()
+		load := l.pages[page]
+		return load.feedback, load.err
+	}
+}
+
+// loadPages finds every queued page at once.
+func (l *graphQLLoader) loadPages() {
+	if len(l.pendingPages) == 0 {
+		return
+	}
+	pages := l.pendingPages
+	l.pendingPages = nil
+	found, err := l.db.FindPages(pages)
+	for i, page := range pages {
+		load := &pageLoad{err: err}
+		if err == nil {
+			load.feedback = found[i]
+		}
+		l.pages[page] = load
+	}
+}
@@ -0,0 +1,268 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchDB counts the batched reads of a GraphQL query.
+type batchDB struct {
+	mockDB
+	summarizeCalls *int
+	pageCalls      *int
+}
+
+func (b batchDB) SummarizeSessions(sessionIDs []string) (map[string]db.Summary, error) {
+	*b.summarizeCalls++
+	return b.mockDB.SummarizeSessions(sessionIDs)
+}
+
+func (b batchDB) FindPages(pages []db.Page) ([][]model.Feedback, error) {
+	*b.pageCalls++
+	return b.mockDB.FindPages(pages)
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, handler http.Handler, query string, variables map[string]interface{}) (int,
+	graphQLResponse) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	var response graphQLResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, response
+}
+
+var graphQLFeedback = []model.Feedback{
+	{ID: 4, UserID: "4", SessionID: "987", Rating: 5, Date: time.Date(2019, 11, 4, 10, 0, 0, 0, time.UTC),
+		ModerationStatus: model.ModerationApproved},
+	{ID: 3, UserID: "3", SessionID: "654", Rating: 2, Date: time.Date(2019, 11, 3, 10, 0, 0, 0, time.UTC),
+		ModerationStatus: model.ModerationApproved},
+	{ID: 2, UserID: "2", SessionID: "987", Rating: 3, Date: time.Date(2019, 11, 2, 10, 0, 0, 0, time.UTC),
+		ModerationStatus: model.ModerationApproved},
+	{ID: 1, UserID: "1", SessionID: "987", Rating: 4, Date: time.Date(2019, 11, 1, 10, 0, 0, 0, time.UTC),
+		ModerationStatus: model.ModerationFlagged},
+}
+
+func TestHTTPServer_GraphQL(t *testing.T) {
+	var summarizeCalls, pageCalls int
+	handler := transport.NewRouter(transport.WithDB(batchDB{mockDB: mockDB{feedbacks: graphQLFeedback},
+		summarizeCalls: &summarizeCalls, pageCalls: &pageCalls}))
+	status, response := postGraphQL(t, handler, `{
+		sessions(ids: ["987", "654", "321"]) {
+			id
+			summary { count average lastId }
+			feedback(first: 1) {
+				edges { cursor node { id rating session { id } } }
+				pageInfo { hasNextPage endCursor }
+			}
+		}
+	}`, nil)
+	if status != http.StatusOK || len(response.Errors) > 0 {
+		t.Fatalf("unexpected response %d %+v", status, response.Errors)
+	}
+	//
+	// Each read is made once for every session
+	//
+	if summarizeCalls != 1 || pageCalls != 1 {
+		t.Errorf("expected a single batch of each read but got %d summaries and %d pages", summarizeCalls, pageCalls)
+	}
+	var data struct {
+		Sessions []struct {
+			ID      string
+			Summary struct {
+				Count   int
+				Average float64
+				LastID  int `json:"lastId"`
+			}
+			Feedback struct {
+				Edges []struct {
+					Cursor string
+					Node   struct {
+						ID      int
+						Rating  int
+						Session struct{ ID string }
+					}
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   *string
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(response.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Sessions) != 3 {
+		t.Fatalf("expected 3 sessions but got %+v", data.Sessions)
+	}
+	first := data.Sessions[0]
+	if first.ID != "987" || first.Summary.Count != 2 || first.Summary.Average != 4 || first.Summary.LastID != 4 {
+		t.Errorf("unexpected session %+v", first)
+	} else if len(first.Feedback.Edges) != 1 || first.Feedback.Edges[0].Node.ID != 4 ||
+		first.Feedback.Edges[0].Node.Session.ID != "987" || !first.Feedback.PageInfo.HasNextPage ||
+		first.Feedback.PageInfo.EndCursor == nil ||
+		*first.Feedback.PageInfo.EndCursor != first.Feedback.Edges[0].Cursor {
+		t.Errorf("unexpected feedback %+v", first.Feedback)
+	}
+	if empty := data.Sessions[2]; empty.Summary.Count != 0 || len(empty.Feedback.Edges) != 0 ||
+		empty.Feedback.PageInfo.HasNextPage || empty.Feedback.PageInfo.EndCursor != nil {
+		t.Errorf("expected the session without feedback to be empty but got %+v", empty)
+	}
+}
+
+func TestHTTPServer_GraphQL_Pagination(t *testing.T) {
+	//
+	// Feedback 5 was imported with an older date than the feedback already submitted
+	//
+	feedbacks := append([]model.Feedback{{ID: 5, UserID: "5", SessionID: "987", Rating: 1,
+		Date: time.Date(2019, 10, 31, 10, 0, 0, 0, time.UTC), ModerationStatus: model.ModerationApproved}},
+		graphQLFeedback...)
+	handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks}))
+	query := `query($after: String) {
+		session(id: "987") {
+			feedback(first: 1, after: $after) {
+				nodes { id }
+				pageInfo { hasNextPage endCursor }
+			}
+		}
+	}`
+	type page struct {
+		Session struct {
+			Feedback struct {
+				Nodes    []struct{ ID int }
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+		}
+	}
+	var ids []int
+	variables := map[string]interface{}{}
+	for i := 0; i < 4; i++ {
+		status, response := postGraphQL(t, handler, query, variables)
+		if status != http.StatusOK || len(response.Errors) > 0 {
+			t.Fatalf("unexpected response %d %+v", status, response.Errors)
+		}
+		var data page
+		if err := json.Unmarshal(response.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range data.Session.Feedback.Nodes {
+			ids = append(ids, node.ID)
+		}
+		if !data.Session.Feedback.PageInfo.HasNextPage {
+			break
+		}
+		variables["after"] = data.Session.Feedback.PageInfo.EndCursor
+	}
+	//
+	// Only the approved feedback of the session is paged through, most recent first
+	//
+	if len(ids) != 3 || ids[0] != 4 || ids[1] != 2 || ids[2] != 5 {
+		t.Errorf("expected feedback 4, 2 then 5 but got %v", ids)
+	}
+}
+
+func TestHTTPServer_GraphQL_Invalid(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		variables      map[string]interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Syntax Error",
+			query:          `{ session(id: "987") {`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Syntax Error",
+		},
+		{
+			name:           "Unknown Field",
+			query:          `{ session(id: "987") { name } }`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `Cannot query field "name"`,
+		},
+		{
+			name: "Too Complex",
+			query: `query($ids: [ID!]!) {
+				sessions(ids: $ids) { feedback(first: 100) { nodes { id comment } } }
+			}`,
+			variables:      map[string]interface{}{"ids": []string{"1", "2", "3", "4", "5"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "query complexity 1506 is greater than the maximum of 1000",
+		},
+		{
+			name: "Too Complex Through Fragments",
+			query: `{ session(id: "987") { feedback(first: 100) { ...page } } }
+			fragment page on FeedbackConnection { nodes { session { feedback(first: 100) { nodes { id } } } } }`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "is greater than the maximum of 1000",
+		},
+		{
+			name:           "Page Too Large",
+			query:          `{ session(id: "987") { feedback(first: 101) { nodes { id } } } }`,
+			expectedStatus: http.StatusOK,
+			expectedError:  "first must be between 1 and 100",
+		},
+		{
+			name:           "Unknown Cursor",
+			query:          `{ session(id: "987") { feedback(after: "abc") { nodes { id } } } }`,
+			expectedStatus: http.StatusOK,
+			expectedError:  "after must be a cursor",
+		},
+		{
+			name:           "Cursor Without Date",
+			query:          `{ session(id: "987") { feedback(after: "ZmVlZGJhY2s6NDI=") { nodes { id } } } }`,
+			expectedStatus: http.StatusOK,
+			expectedError:  "after must be a cursor",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: graphQLFeedback}))
+			status, response := postGraphQL(t, handler, test.query, test.variables)
+			if status != test.expectedStatus {
+				t.Errorf("expected status %d but got %d", test.expectedStatus, status)
+			}
+			if len(response.Errors) == 0 || !strings.Contains(response.Errors[0].Message, test.expectedError) {
+				t.Errorf("expected error %q but got %+v", test.expectedError, response.Errors)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_GraphQL_MaxComplexity(t *testing.T) {
+	handler := transport.NewRouter(transport.WithDB(mockDB{}), transport.WithGraphQLMaxComplexity(3))
+	status, _ := postGraphQL(t, handler, `{ session(id: "987") { id summary { count } } }`, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status %d but got %d", http.StatusBadRequest, status)
+	}
+	status, response := postGraphQL(t, handler, `{ session(id: "987") { id } }`, nil)
+	if status != http.StatusOK || len(response.Errors) > 0 {
+		t.Errorf("unexpected response %d %+v", status, response.Errors)
+	}
+}
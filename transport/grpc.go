@@ -0,0 +1,253 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/feedback"
+	"github.com/Piszmog/feedback-service/feedbackpb"
+	"github.com/Piszmog/feedback-service/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// grpcService is the gRPC API of the server. It shares the DB, moderation and streams of the REST API.
+type grpcService struct {
+	feedbackpb.UnimplementedFeedbackServiceServer
+	server *HTTPServer
+}
+
+// GRPCServer provides the gRPC server serving the gRPC API. It is started on the gRPC port by Start.
+func (s *HTTPServer) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.unaryReadinessInterceptor),
+		grpc.ChainStreamInterceptor(s.streamReadinessInterceptor))
+	srv := grpc.NewServer(opts...)
+	feedbackpb.RegisterFeedbackServiceServer(srv, &grpcService{server: s})
+	return srv
+}
+
+// startGRPC serves the gRPC API on the gRPC port, with the TLS configuration of the HTTP server when provided.
+func (s *HTTPServer) startGRPC(tlsConfig *tls.Config) error {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig.Clone())))
+	}
+	srv := s.GRPCServer(opts...)
+	listener, err := net.Listen("tcp", s.Host+":"+s.GRPCPort)
+	if err != nil {
+		return fmt.Errorf("failed to start the gRPC server on port %s: %w", s.GRPCPort, err)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		srv.Stop()
+		return nil
+	}
+	s.grpcSrv = srv
+	s.mu.Unlock()
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			log.Println(fmt.Errorf("failed to serve gRPC on port %s: %w", s.GRPCPort, err))
+		}
+	}()
+	return nil
+}
+
+// stopGRPC gracefully stops the gRPC server. If calls are still active after the context is done, they are forcibly
+// ended.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("failed to gracefully stop the gRPC server, forcibly ending its calls")
+		srv.Stop()
+	}
+}
+
+func (s *HTTPServer) unaryReadinessInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.grpcReady(); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *HTTPServer) streamReadinessInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := s.grpcReady(); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// grpcReady fails the calls made while the DB is not available yet.
+func (s *HTTPServer) grpcReady() error {
+	if s.Health == nil {
+		return nil
+	}
+	if health := s.Health.Status(); health == StatusStarting {
+		return grpcError(http.StatusServiceUnavailable, fmt.Sprintf("Service is %s", health), nil)
+	}
+	return nil
+}
+
+// SubmitFeedback submits the feedback of a user for a session. If a user has already submitted feedback, the call fails
+// with AlreadyExists.
+func (g *grpcService) SubmitFeedback(ctx context.Context, request *feedbackpb.SubmitFeedbackRequest) (
+	*feedbackpb.Feedback, error) {
+	userID := strings.TrimSpace(request.GetUserId())
+	sessionID := request.GetSessionId()
+	if len(userID) == 0 {
+		return nil, grpcError(http.StatusBadRequest, "Missing user ID", nil)
+	} else if len(sessionID) == 0 {
+		return nil, grpcError(http.StatusBadRequest, "Missing session ID", nil)
+	}
+	//
+	// A rating that does not fit is out of range rather than wrapped into it
+	//
+	rating := request.GetRating()
+	if rating < model.MinRating || rating > model.MaxRating {
+		return nil, grpcError(http.StatusBadRequest,
+			fmt.Sprintf("User %s submitted rating %d is not within the allowed range of %d-%d for session %s",
+				userID, rating, model.MinRating, model.MaxRating, sessionID), nil)
+	}
+	submitted, err := g.server.service().Submit(feedback.Submission{
+		UserID:    userID,
+		SessionID: sessionID,
+		Comment:   request.GetComment(),
+		Rating:    int8(rating),
+	})
+	if err != nil {
+		return nil, grpcError(serviceStatus(err,
+			fmt.Sprintf("Failed to submit user %s feedback for session %s", userID, sessionID)))
+	}
+	return feedbackMessage(submitted), nil
+}
+
+// ListFeedback lists the last 15 feedbacks of a session, only those with the rating when it is provided.
+func (g *grpcService) ListFeedback(ctx context.Context, request *feedbackpb.ListFeedbackRequest) (
+	*feedbackpb.ListFeedbackResponse, error) {
+	sessionID := request.GetSessionId()
+	var filter db.Filter
+	if rating := request.GetRating(); rating != 0 {
+		filter.Rating = strconv.Itoa(int(rating))
+	}
+	found, err := g.server.service().List(sessionID, filter)
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to retrieve feedback for session %s", sessionID), err)
+	}
+	response := &feedbackpb.ListFeedbackResponse{Feedback: make([]*feedbackpb.Feedback, len(found))}
+	for i, f := range found {
+		response.Feedback[i] = feedbackMessage(f)
+	}
+	return response, nil
+}
+
+// GetSummary summarizes the approved feedback of a session.
+func (g *grpcService) GetSummary(ctx context.Context, request *feedbackpb.GetSummaryRequest) (*feedbackpb.Summary,
+	error) {
+	sessionID := request.GetSessionId()
+	summary, err := g.server.service().Summarize(sessionID)
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError,
+			fmt.Sprintf("Failed to summarize the feedback of session %s", sessionID), err)
+	}
+	return &feedbackpb.Summary{SessionId: sessionID, Count: summary.Count, Average: summary.Average(),
+		LastId: summary.LastID}, nil
+}
+
+// WatchFeedback streams the feedback shown for a session, starting with the feedback of the history inserted after the
+// requested ID. Feedback that is no longer shown is not sent. The stream ends when the client cancels it, falls too far
+// behind or the server shuts down.
+func (g *grpcService) WatchFeedback(request *feedbackpb.WatchFeedbackRequest,
+	stream feedbackpb.FeedbackService_WatchFeedbackServer) error {
+	broker := g.server.Broker
+	if broker == nil {
+		return status.Error(codes.Unimplemented, "Streaming feedback is disabled")
+	}
+	sessionID := request.GetSessionId()
+	if request.GetAfterId() < 0 {
+		return grpcError(http.StatusBadRequest, "After ID must be the ID of a feedback", nil)
+	}
+	subscription, missed := broker.Subscribe(sessionID, request.GetAfterId())
+	defer broker.Unsubscribe(subscription)
+	for _, feedback := range missed {
+		if !feedback.Visible() {
+			continue
+		}
+		if err := stream.Send(feedbackMessage(feedback)); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case feedback, ok := <-subscription.Feedback():
+			if !ok {
+				return nil
+			} else if !feedback.Visible() {
+				continue
+			}
+			if err := stream.Send(feedbackMessage(feedback)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// feedbackMessage provides the feedback as it is sent over gRPC.
+func feedbackMessage(feedback model.Feedback) *feedbackpb.Feedback {
+	return &feedbackpb.Feedback{
+		Id:               feedback.ID,
+		UserId:           feedback.UserID,
+		SessionId:        feedback.SessionID,
+		Comment:          feedback.Comment,
+		Rating:           int32(feedback.Rating),
+		Date:             timestamppb.New(feedback.Date),
+		Version:          feedback.Version,
+		ModerationStatus: string(feedback.ModerationStatus),
+		ModerationReason: feedback.ModerationReason,
+	}
+}
+
+// grpcCodes are the gRPC codes of the HTTP statuses the APIs fail with.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcError logs the error, like writeHTTPError, and provides the gRPC status of the HTTP status. The cause is only
+// logged, the client is sent the reason.
+func grpcError(statusCode int, reason string, err error) error {
+	httpError := HTTPError{
+		Code:   statusCode,
+		Reason: reason,
+		Err:    err,
+	}
+	log.Println(httpError.Error())
+	code, ok := grpcCodes[statusCode]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, reason)
+}
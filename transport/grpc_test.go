@@ -0,0 +1,203 @@
+package transport_test
+
+import (
+	"context"
+	"github.com/Piszmog/feedback-service/feedbackpb"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/Piszmog/feedback-service/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// newGRPCClient serves the gRPC API of the server in memory and provides a client calling it.
+func newGRPCClient(t *testing.T, server *transport.HTTPServer) feedbackpb.FeedbackServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	srv := server.GRPCServer()
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return feedbackpb.NewFeedbackServiceClient(conn)
+}
+
+func TestGRPC_SubmitFeedback(t *testing.T) {
+	tests := []struct {
+		name         string
+		db           mockDB
+		request      *feedbackpb.SubmitFeedbackRequest
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Submitted",
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123", Comment: "A Test", Rating: 4},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Missing User",
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", Comment: "A Test", Rating: 4},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Rating Too High",
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123", Rating: 6},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Rating Out Of Range Of Int8",
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123", Rating: 260},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Already Exists",
+			db:           mockDB{exists: true},
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123", Rating: 4},
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			name:         "Insert Failure",
+			db:           mockDB{insertError: true},
+			request:      &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123", Rating: 4},
+			expectedCode: codes.Internal,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newGRPCClient(t, &transport.HTTPServer{DB: test.db})
+			feedback, err := client.SubmitFeedback(context.Background(), test.request)
+			if code := status.Code(err); code != test.expectedCode {
+				t.Fatalf("expected code %s but got %s", test.expectedCode, code)
+			}
+			if err == nil && (feedback.GetId() != 1 || feedback.GetUserId() != "123" ||
+				feedback.GetSessionId() != "987" || feedback.GetModerationStatus() != string(model.ModerationApproved)) {
+				t.Errorf("unexpected feedback %+v", feedback)
+			}
+		})
+	}
+}
+
+func TestGRPC_Starting(t *testing.T) {
+	health := &transport.Health{}
+	health.SetStatus(transport.StatusStarting)
+	client := newGRPCClient(t, &transport.HTTPServer{DB: mockDB{}, Health: health})
+	_, err := client.GetSummary(context.Background(), &feedbackpb.GetSummaryRequest{SessionId: "987"})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Errorf("expected code %s but got %s", codes.Unavailable, code)
+	}
+}
+
+func TestGRPC_ListFeedback(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 2, UserID: "456", SessionID: "987", Rating: 5, ModerationStatus: model.ModerationApproved},
+		{ID: 1, UserID: "123", SessionID: "987", Rating: 3, ModerationStatus: model.ModerationApproved},
+	}
+	client := newGRPCClient(t, &transport.HTTPServer{DB: mockDB{feedbacks: feedbacks}})
+	response, err := client.ListFeedback(context.Background(), &feedbackpb.ListFeedbackRequest{SessionId: "987"})
+	if err != nil {
+		t.Fatalf("unexpected error occurred: %v", err)
+	} else if len(response.GetFeedback()) != 2 || response.GetFeedback()[0].GetId() != 2 ||
+		response.GetFeedback()[1].GetRating() != 3 {
+		t.Errorf("unexpected feedback %+v", response.GetFeedback())
+	}
+}
+
+func TestGRPC_ListFeedback_FindError(t *testing.T) {
+	client := newGRPCClient(t, &transport.HTTPServer{DB: mockDB{findError: true}})
+	_, err := client.ListFeedback(context.Background(), &feedbackpb.ListFeedbackRequest{SessionId: "987", Rating: 4})
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("expected code %s but got %s", codes.Internal, code)
+	}
+}
+
+func TestGRPC_GetSummary(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, SessionID: "987", Rating: 5, ModerationStatus: model.ModerationApproved},
+		{ID: 2, SessionID: "987", Rating: 2, ModerationStatus: model.ModerationApproved},
+		{ID: 3, SessionID: "987", Rating: 1, ModerationStatus: model.ModerationFlagged},
+	}
+	client := newGRPCClient(t, &transport.HTTPServer{DB: mockDB{feedbacks: feedbacks}})
+	summary, err := client.GetSummary(context.Background(), &feedbackpb.GetSummaryRequest{SessionId: "987"})
+	if err != nil {
+		t.Fatalf("unexpected error occurred: %v", err)
+	} else if summary.GetCount() != 2 || summary.GetAverage() != 3.5 || summary.GetLastId() != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestGRPC_WatchFeedback(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987", Rating: 4, ModerationStatus: model.ModerationApproved})
+	broker.Publish(model.Feedback{ID: 2, SessionID: "987", Rating: 5, ModerationStatus: model.ModerationApproved})
+	server := &transport.HTTPServer{DB: mockDB{}, Broker: broker}
+	client := newGRPCClient(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	//
+	// The feedback missed since the ID is sent first, then the feedback submitted while watching
+	//
+	stream, err := client.WatchFeedback(ctx, &feedbackpb.WatchFeedbackRequest{SessionId: "987", AfterId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missed, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	} else if missed.GetId() != 2 {
+		t.Errorf("expected the missed feedback 2 but got %d", missed.GetId())
+	}
+	submitted := make(chan error, 1)
+	go func() {
+		//
+		// Keep submitting until the stream is subscribed to, the feedback submitted before is not in its history
+		//
+		for ctx.Err() == nil {
+			_, err := client.SubmitFeedback(ctx, &feedbackpb.SubmitFeedbackRequest{SessionId: "987", UserId: "123",
+				Rating: 3})
+			if err != nil {
+				submitted <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	received, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	} else if received.GetUserId() != "123" || received.GetRating() != 3 {
+		t.Errorf("unexpected feedback %+v", received)
+	}
+	select {
+	case err := <-submitted:
+		t.Errorf("unexpected error occurred: %v", err)
+	default:
+	}
+	cancel()
+}
+
+func TestGRPC_WatchFeedback_Disabled(t *testing.T) {
+	client := newGRPCClient(t, &transport.HTTPServer{DB: mockDB{}})
+	stream, err := client.WatchFeedback(context.Background(), &feedbackpb.WatchFeedbackRequest{SessionId: "987"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected code %s but got %v", codes.Unimplemented, err)
+	}
+}
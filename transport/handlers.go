@@ -4,20 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/feedback"
 	"github.com/Piszmog/feedback-service/model"
 	"github.com/gorilla/mux"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const (
 	contentTypeJSON   = "application/json"
-	findLimit         = 15
 	headerContentType = "Content-Type"
+	headerLocation    = "Location"
 	headerUserID      = "Ubi-UserId"
+	pathID            = "id"
 	pathSessionID     = "sessionID"
 	queryRating       = "rating"
 )
@@ -36,88 +40,136 @@ func (s *HTTPServer) InsertFeedback() func(w http.ResponseWriter, r *http.Reques
 			return
 		}
 		//
-		// Check if user has already submitted feedback for the session
-		//
-		exists, err := s.DB.Exists(userID, sessionID)
-		if err != nil {
-			writeHTTPError(http.StatusInternalServerError,
-				fmt.Sprintf("Failed to check if user %s has previously submitted feedback for session %s", userID, sessionID),
-				err, w)
-			return
-		}
-		if exists {
-			writeHTTPError(http.StatusConflict,
-				fmt.Sprintf("User %s has already submitted feedback for session %s", userID, sessionID), nil, w)
-			return
-		}
-		//
 		// Deserialize the request payload
 		//
 		defer closeRequestBody(r.Body)
-		var feedback model.Feedback
-		if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil {
+		var request feedbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			writeHTTPError(http.StatusBadRequest,
 				fmt.Sprintf("Failed to decode user %s feedback for session %s", userID, sessionID), err, w)
 			return
 		}
-		if feedback.Rating > 5 || feedback.Rating < 1 {
-			writeHTTPError(http.StatusBadRequest,
-				fmt.Sprintf("User %s submitted rating %d is not within the allowed range of 1-5 for session %s", userID, feedback.Rating, sessionID), nil, w)
+		//
+		// Only trusted callers can say when the feedback occurred
+		//
+		if request.OccurredAt != nil && !s.trusted(r) {
+			writeHTTPError(http.StatusForbidden,
+				fmt.Sprintf("User %s is not allowed to provide when feedback occurred for session %s", userID, sessionID),
+				nil, w)
+			return
+		}
+		submission := feedback.Submission{
+			UserID:     userID,
+			SessionID:  sessionID,
+			Comment:    request.Comment,
+			Rating:     request.Rating,
+			OccurredAt: request.OccurredAt,
+		}
+		feedback, err := s.service().Submit(submission)
+		if err != nil {
+			writeServiceError(err, fmt.Sprintf("Failed to submit user %s feedback for session %s", userID, sessionID),
+				w)
 			return
 		}
 		//
-		// If user has not submitted feedback yet, insert their feedback
+		// Send the feedback as it was stored along with where it can be retrieved from
 		//
-		feedback.UserID = userID
-		feedback.SessionID = sessionID
-		feedback.Date = time.Now()
-		if err := s.DB.Insert(feedback); err != nil {
-			writeHTTPError(http.StatusInternalServerError,
-				fmt.Sprintf("Failed to insert user %s feedback for session %s", userID, sessionID), err, w)
-			return
+		w.Header().Set(headerLocation, s.feedbackLocation(sessionID, feedback.ID))
+		w.Header().Set(headerETag, feedbackETag(feedback.Version))
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(feedback); err != nil {
+			log.Println(fmt.Errorf("failed to write user %s feedback for session %s: %w", userID, sessionID, err))
 		}
 	}
 }
 
+// feedbackRequest is the feedback a user submits. Trusted callers can also provide when the feedback occurred.
+type feedbackRequest struct {
+	model.Feedback
+	OccurredAt *time.Time `json:"occurredAt"`
+}
+
 func closeRequestBody(body io.ReadCloser) {
 	if err := body.Close(); err != nil {
 		log.Println(fmt.Errorf("failed to close the requeest body: %w", err))
 	}
 }
 
-// RetrieveFeedback retrieves the last 15 feedbacks for a specified session.
+// RetrieveFeedback retrieves the last 15 feedbacks for a specified session. If the feedbacks have not changed since the
+// ETag in the If-None-Match header, a 304 is returned.
 func (s *HTTPServer) RetrieveFeedback() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(headerContentType, contentTypeJSON)
 		sessionID := mux.Vars(r)[pathSessionID]
-		ratingFilter := r.URL.Query().Get(queryRating)
-		var err error
-		var feedback []model.Feedback
 		//
 		// If rating is provided in the query params, use it to find matching feedback.
 		// Find the last 15 most recent feedback provided for the session.
 		//
-		if len(ratingFilter) > 0 {
-			feedback, err = s.DB.FindWithFilter(sessionID, db.Filter{Rating: ratingFilter}, db.Descending, findLimit)
-		} else {
-			feedback, err = s.DB.Find(sessionID, db.Descending, findLimit)
-		}
+		feedback, err := s.service().List(sessionID, db.Filter{Rating: r.URL.Query().Get(queryRating)})
 		if err != nil {
 			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve feedback for session %s", sessionID),
 				err, w)
 			return
 		}
 		//
-		// Send data
+		// Send data, unless the client already has it
 		//
-		if err := json.NewEncoder(w).Encode(feedback); err != nil {
+		body, err := json.Marshal(feedback)
+		if err != nil {
 			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to write feedback from session %s", sessionID),
 				err, w)
 			return
 		}
+		etag := contentETag(body)
+		w.Header().Set(headerETag, etag)
+		if etagMatches(r.Header.Get(headerIfNoneMatch), etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if _, err := w.Write(append(body, '\n')); err != nil {
+			log.Println(fmt.Errorf("failed to write feedback from session %s: %w", sessionID, err))
+		}
 	}
 }
 
+// RetrieveFeedbackByID retrieves a single feedback of a session along with its ETag. If the feedback does not exist, or
+// is not approved and was provided by another user, a 404 is returned.
+func (s *HTTPServer) RetrieveFeedbackByID() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		sessionID := mux.Vars(r)[pathSessionID]
+		id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 32)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound,
+				fmt.Sprintf("Feedback %s does not exist for session %s", mux.Vars(r)[pathID], sessionID), nil, w)
+			return
+		}
+		//
+		// Feedback that is not approved is only shown to the user that provided it
+		//
+		userID := strings.TrimSpace(r.Header.Get(headerUserID))
+		feedback, err := s.service().Get(sessionID, int32(id), userID)
+		if err != nil {
+			writeServiceError(err, fmt.Sprintf("Failed to retrieve feedback %d for session %s", id, sessionID), w)
+			return
+		}
+		etag := feedbackETag(feedback.Version)
+		w.Header().Set(headerETag, etag)
+		if etagMatches(r.Header.Get(headerIfNoneMatch), etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(feedback); err != nil {
+			log.Println(fmt.Errorf("failed to write feedback %d from session %s: %w", id, sessionID, err))
+		}
+	}
+}
+
+// feedbackLocation provides the path a single feedback can be retrieved from.
+func (s *HTTPServer) feedbackLocation(sessionID string, id int32) string {
+	return fmt.Sprintf("%s%s/sessions/%s/feedback/%d", s.Prefix, pathV1, url.PathEscape(sessionID), id)
+}
+
 func writeHTTPError(statusCode int, reason string, err error, w http.ResponseWriter) {
 	httpError := HTTPError{
 		Code:   statusCode,
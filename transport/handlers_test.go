@@ -35,40 +35,124 @@ func TestHTTPServer_InsertFeedback(t *testing.T) {
 	//
 	// Perform checks
 	//
-	if status := recorder.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	} else if location := recorder.Header().Get("Location"); location != "/v1/sessions/987/feedback/1" {
+		t.Errorf("handler returned unexpected location %s", location)
 	}
 }
 
-func TestHTTPServer_InsertFeedback_TooHighRating(t *testing.T) {
-	//
-	// Create server
-	//
-	server := transport.HTTPServer{DB: mockDB{exists: false}}
-	//
-	// Create Request, recorder, and handler
-	//
-	request, err := http.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(`{"comment":"A Test", "rating":6}`)))
-	if err != nil {
-		t.Fatal(err)
+func TestHTTPServer_InsertFeedback_OccurredAt(t *testing.T) {
+	occurredAt := time.Now().Add(-48 * time.Hour).Truncate(time.Microsecond).UTC()
+	tests := []struct {
+		name          string
+		authorization string
+		occurredAt    time.Time
+		expectedCode  int
+	}{
+		{
+			name:          "Trusted",
+			authorization: "Bearer letmein",
+			occurredAt:    occurredAt,
+			expectedCode:  http.StatusCreated,
+		},
+		{
+			name:         "Untrusted",
+			occurredAt:   occurredAt,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:          "Wrong Token",
+			authorization: "Bearer guess",
+			occurredAt:    occurredAt,
+			expectedCode:  http.StatusForbidden,
+		},
+		{
+			name:          "Too Old",
+			authorization: "Bearer letmein",
+			occurredAt:    time.Now().Add(-14 * 24 * time.Hour),
+			expectedCode:  http.StatusBadRequest,
+		},
 	}
-	request.Header.Set("Ubi-UserId", "123")
-	recorder := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/{sessionID}", server.InsertFeedback())
-	//
-	// Serve
-	//
-	router.ServeHTTP(recorder, request)
-	//
-	// Perform checks
-	//
-	if status := recorder.Code; status != http.StatusBadRequest {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := transport.HTTPServer{
+				DB:               mockDB{exists: false},
+				TrustedTokens:    []string{"letmein"},
+				OccurredAtWindow: 7 * 24 * time.Hour,
+			}
+			body := `{"comment":"A Test", "rating":4, "occurredAt":"` + test.occurredAt.Format(time.RFC3339Nano) + `"}`
+			request := httptest.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(body)))
+			request.Header.Set("Ubi-UserId", "123")
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/{sessionID}", server.InsertFeedback())
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			}
+			if test.expectedCode != http.StatusCreated {
+				return
+			}
+			var feedback model.Feedback
+			if err := json.NewDecoder(recorder.Body).Decode(&feedback); err != nil {
+				t.Fatal(err)
+			}
+			if !feedback.Date.Equal(occurredAt) {
+				t.Errorf("expected date %s but got %s", occurredAt, feedback.Date)
+			}
+		})
 	}
-	expected := `{"statusCode":400, "reason":"User 123 submitted rating 6 is not within the allowed range of 1-5 for session 987"}`
-	if recorder.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+}
+
+func TestHTTPServer_InsertFeedback_ServiceErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		db           mockDB
+		body         string
+		expectedBody string
+	}{
+		{
+			name:         "Already Exists",
+			db:           mockDB{exists: true},
+			body:         `{"comment":"A Test", "rating":4}`,
+			expectedBody: `{"statusCode":409, "reason":"User 123 has already submitted feedback for session 987"}`,
+		},
+		{
+			name: "Too High Rating",
+			body: `{"comment":"A Test", "rating":6}`,
+			expectedBody: `{"statusCode":400, "reason":"User 123 submitted rating 6 is not within the allowed range ` +
+				`of 1-5 for session 987"}`,
+		},
+		{
+			name:         "Exists Error",
+			db:           mockDB{existsError: true},
+			body:         `{"comment":"A Test", "rating":4}`,
+			expectedBody: `{"statusCode":500, "reason":"Failed to submit user 123 feedback for session 987"}`,
+		},
+		{
+			name:         "Insert Failure",
+			db:           mockDB{insertError: true},
+			body:         `{"comment":"A Test", "rating":4}`,
+			expectedBody: `{"statusCode":500, "reason":"Failed to submit user 123 feedback for session 987"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := transport.HTTPServer{DB: test.db}
+			request := httptest.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(test.body)))
+			request.Header.Set("Ubi-UserId", "123")
+			recorder := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/{sessionID}", server.InsertFeedback())
+			router.ServeHTTP(recorder, request)
+			if recorder.Body.String() != test.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), test.expectedBody)
+			}
+		})
 	}
 }
 
@@ -104,70 +188,6 @@ func TestHTTPServer_InsertFeedback_MalformedRequest(t *testing.T) {
 	}
 }
 
-func TestHTTPServer_InsertFeedback_ExistsError(t *testing.T) {
-	//
-	// Create server
-	//
-	server := transport.HTTPServer{DB: mockDB{existsError: true}}
-	//
-	// Create Request, recorder, and handler
-	//
-	request, err := http.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	request.Header.Set("Ubi-UserId", "123")
-	recorder := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/{sessionID}", server.InsertFeedback())
-	//
-	// Serve
-	//
-	router.ServeHTTP(recorder, request)
-	//
-	// Perform checks
-	//
-	if status := recorder.Code; status != http.StatusInternalServerError {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
-	}
-	expected := `{"statusCode":500, "reason":"Failed to check if user 123 has previously submitted feedback for session 987"}`
-	if recorder.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
-	}
-}
-
-func TestHTTPServer_InsertFeedback_FeedbackAlreadyExists(t *testing.T) {
-	//
-	// Create server
-	//
-	server := transport.HTTPServer{DB: mockDB{exists: true}}
-	//
-	// Create Request, recorder, and handler
-	//
-	request, err := http.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	request.Header.Set("Ubi-UserId", "123")
-	recorder := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/{sessionID}", server.InsertFeedback())
-	//
-	// Serve
-	//
-	router.ServeHTTP(recorder, request)
-	//
-	// Perform checks
-	//
-	if status := recorder.Code; status != http.StatusConflict {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
-	}
-	expected := `{"statusCode":409, "reason":"User 123 has already submitted feedback for session 987"}`
-	if recorder.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
-	}
-}
-
 func TestHTTPServer_InsertFeedback_MissingHeader(t *testing.T) {
 	//
 	// Create server
@@ -199,38 +219,6 @@ func TestHTTPServer_InsertFeedback_MissingHeader(t *testing.T) {
 	}
 }
 
-func TestHTTPServer_InsertFeedback_InsertFailure(t *testing.T) {
-	//
-	// Create server
-	//
-	server := transport.HTTPServer{DB: mockDB{exists: false, insertError: true}}
-	//
-	// Create Request, recorder, and handler
-	//
-	request, err := http.NewRequest(http.MethodPost, "/987", bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	request.Header.Set("Ubi-UserId", "123")
-	recorder := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/{sessionID}", server.InsertFeedback())
-	//
-	// Serve
-	//
-	router.ServeHTTP(recorder, request)
-	//
-	// Perform checks
-	//
-	if status := recorder.Code; status != http.StatusInternalServerError {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
-	}
-	expected := `{"statusCode":500, "reason":"Failed to insert user 123 feedback for session 987"}`
-	if recorder.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
-	}
-}
-
 func TestHTTPServer_RetrieveFeedback(t *testing.T) {
 	//
 	// Create server
@@ -363,3 +351,40 @@ func TestHTTPServer_RetrieveFeedback_FindError(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
 	}
 }
+
+func TestHTTPServer_RetrieveFeedbackByID(t *testing.T) {
+	feedbacks := []model.Feedback{{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Date: time.Now()}}
+	tests := []struct {
+		name         string
+		path         string
+		db           mockDB
+		expectedCode int
+	}{
+		{name: "Found", path: "/987/1", db: mockDB{feedbacks: feedbacks}, expectedCode: http.StatusOK},
+		{name: "Other Session", path: "/654/1", db: mockDB{feedbacks: feedbacks}, expectedCode: http.StatusNotFound},
+		{name: "Missing", path: "/987/2", db: mockDB{feedbacks: feedbacks}, expectedCode: http.StatusNotFound},
+		{name: "Too Large", path: "/987/99999999999", db: mockDB{feedbacks: feedbacks}, expectedCode: http.StatusNotFound},
+		{name: "Find Error", path: "/987/1", db: mockDB{findError: true}, expectedCode: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := transport.HTTPServer{DB: test.db}
+			recorder := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/{sessionID}/{id}", server.RetrieveFeedbackByID())
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			}
+			if test.expectedCode != http.StatusOK {
+				return
+			}
+			var feedback model.Feedback
+			if err := json.NewDecoder(recorder.Body).Decode(&feedback); err != nil {
+				t.Fatal(err)
+			} else if feedback.ID != 1 || feedback.Comment != "A Test" {
+				t.Errorf("unexpected feedback %+v", feedback)
+			}
+		})
+	}
+}
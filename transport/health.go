@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// Status is the readiness status of the application.
+type Status int32
+
+const (
+	// StatusStarting is when the application is waiting on its dependencies.
+	StatusStarting Status = iota
+	// StatusReady is when the application is serving requests.
+	StatusReady
+	// StatusDraining is when the application is shutting down. Requests are still served but load balancers should stop
+	// sending new ones.
+	StatusDraining
+)
+
+// String provides the name of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusStarting:
+		return "starting"
+	case StatusReady:
+		return "ready"
+	case StatusDraining:
+		return "draining"
+	default:
+		return "unknown"
+	}
+}
+
+// Health tracks the readiness of the application. It is safe for concurrent use. A nil Health is always ready.
+type Health struct {
+	status int32
+}
+
+// SetStatus sets the readiness status.
+func (h *Health) SetStatus(status Status) {
+	atomic.StoreInt32(&h.status, int32(status))
+}
+
+// Status provides the current readiness status.
+func (h *Health) Status() Status {
+	if h == nil {
+		return StatusReady
+	}
+	return Status(atomic.LoadInt32(&h.status))
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// Liveness reports that the application is running.
+func (s *HTTPServer) Liveness() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(http.StatusOK, s.Health.Status(), w)
+	}
+}
+
+// Readiness reports whether the application is ready to serve requests. A 503 is returned when not ready.
+func (s *HTTPServer) Readiness() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := s.Health.Status()
+		statusCode := http.StatusOK
+		if status != StatusReady {
+			statusCode = http.StatusServiceUnavailable
+		}
+		writeHealth(statusCode, status, w)
+	}
+}
+
+func writeHealth(statusCode int, status Status, w http.ResponseWriter) {
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(healthResponse{Status: status.String()}); err != nil {
+		log.Println(fmt.Errorf("failed to write health: %w", err))
+	}
+}
+
+func (s *HTTPServer) readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := s.Health.Status(); status == StatusStarting {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("Service is %s", status), nil, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
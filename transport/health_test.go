@@ -0,0 +1,52 @@
+package transport_test
+
+import (
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServer_Readiness(t *testing.T) {
+	health := &transport.Health{}
+	server := transport.HTTPServer{Health: health}
+	//
+	// Starting is not ready
+	//
+	recorder := httptest.NewRecorder()
+	server.Readiness()(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if status := recorder.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	expected := "{\"status\":\"starting\"}\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+	//
+	// Ready once the status is set
+	//
+	health.SetStatus(transport.StatusReady)
+	recorder = httptest.NewRecorder()
+	server.Readiness()(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	//
+	// Draining is not ready
+	//
+	health.SetStatus(transport.StatusDraining)
+	recorder = httptest.NewRecorder()
+	server.Readiness()(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if status := recorder.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHTTPServer_Liveness(t *testing.T) {
+	server := transport.HTTPServer{Health: &transport.Health{}}
+	recorder := httptest.NewRecorder()
+	server.Liveness()(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
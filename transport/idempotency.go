@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+	// routeUnrecorded names the routes whose responses must not be recorded, e.g. because they contain secrets.
+	routeUnrecorded = "unrecorded"
+	// idempotencyLease is how long a request is reserved while it is processed. A key whose response was never
+	// recorded, e.g. because the server crashed, can be used again once the lease lapses.
+	idempotencyLease = time.Minute
+)
+
+// idempotentHeaders are the response headers replayed along with the recorded response.
+var idempotentHeaders = []string{headerContentType, headerLocation, headerETag}
+
+// idempotencyMiddleware makes POST requests with an Idempotency-Key header safe to retry. The response of the first
+// request with a key is recorded and replayed to retries of the same request, by the same user or operator, until the
+// key expires. Reusing a key with a different request is rejected. Responses are only recorded when the DB is an
+// IdempotencyStore and the request is made by a user or operator.
+func (s *HTTPServer) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(headerIdempotencyKey)
+		store, ok := s.DB.(db.IdempotencyStore)
+		scope, scoped := s.idempotencyScope(r)
+		if r.Method != http.MethodPost || len(key) == 0 || s.IdempotencyTTL <= 0 || !ok || !scoped || unrecorded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Header '%s' is longer than %d characters", headerIdempotencyKey, maxIdempotencyKeyLength),
+				nil, w)
+			return
+		}
+		//
+		// The request is identified by its method, path and body. The body is read up front so it can be hashed
+		//
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+		closeRequestBody(r.Body)
+		if err != nil {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusBadRequest, "Failed to read the request body", err, w)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		now := time.Now()
+		record := db.IdempotencyRecord{
+			UserID:      scope,
+			Key:         key,
+			RequestHash: hex.EncodeToString(hash.Sum(nil)),
+			LockedUntil: now.Add(idempotencyLease),
+			ExpiresAt:   now.Add(s.IdempotencyTTL),
+		}
+		existing, reserved, err := store.Reserve(record)
+		if err != nil {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to check idempotency key %s", key), err, w)
+			return
+		}
+		if !reserved {
+			replay(existing, record, w)
+			return
+		}
+		//
+		// Record the response as it is written. Unless it is recorded, e.g. the handler panicked, the key is released
+		// so the request can be retried
+		//
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := store.Release(record.UserID, record.Key); err != nil {
+				log.Println(err)
+			}
+		}()
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		//
+		// Server errors and authentication failures are not recorded
+		//
+		if recorder.statusCode >= http.StatusInternalServerError || recorder.statusCode == http.StatusUnauthorized ||
+			recorder.statusCode == http.StatusForbidden {
+			return
+		}
+		record.StatusCode = recorder.statusCode
+		record.Header = make(http.Header)
+		for _, name := range idempotentHeaders {
+			if value := w.Header().Get(name); len(value) > 0 {
+				record.Header.Set(name, value)
+			}
+		}
+		record.Body = recorder.body.Bytes()
+		if err := store.Complete(record); err != nil {
+			log.Println(err)
+			return
+		}
+		completed = true
+	})
+}
+
+// idempotencyScope provides who the idempotency key of the request belongs to, the operator when the request is made
+// with an operator token and the user otherwise. False is returned when the request is made by neither.
+func (s *HTTPServer) idempotencyScope(r *http.Request) (string, bool) {
+	if name, ok := s.operator(r); ok {
+		return db.OperatorActor(name), true
+	}
+	userID := strings.TrimSpace(r.Header.Get(headerUserID))
+	if len(userID) == 0 {
+		return "", false
+	}
+	return db.UserActor(userID), true
+}
+
+// unrecorded checks whether the request is routed to a route whose response must not be recorded.
+func unrecorded(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	return route != nil && route.GetName() == routeUnrecorded
+}
+
+// replay writes the recorded response of an earlier request made with the same key.
+func replay(existing db.IdempotencyRecord, record db.IdempotencyRecord, w http.ResponseWriter) {
+	if existing.RequestHash != record.RequestHash {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		writeHTTPError(http.StatusUnprocessableEntity,
+			fmt.Sprintf("Idempotency key %s was already used with a different request", record.Key), nil, w)
+		return
+	} else if !existing.Completed() {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		writeHTTPError(http.StatusConflict,
+			fmt.Sprintf("A request with idempotency key %s is still being processed", record.Key), nil, w)
+		return
+	}
+	for name, values := range existing.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(headerIdempotentReplayed, "true")
+	w.WriteHeader(existing.StatusCode)
+	if _, err := w.Write(existing.Body); err != nil {
+		log.Println(fmt.Errorf("failed to replay the response of idempotency key %s: %w", record.Key, err))
+	}
+}
+
+// responseRecorder writes the response while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap provides the underlying writer to http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,252 @@
+package transport_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// idempotentDB is a mockDB that records idempotency keys in memory.
+type idempotentDB struct {
+	mockDB
+	mu            sync.Mutex
+	records       map[string]db.IdempotencyRecord
+	completeError bool
+}
+
+func (m *idempotentDB) Reserve(record db.IdempotencyRecord) (db.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.records[record.UserID+"/"+record.Key]; ok {
+		return existing, false, nil
+	}
+	m.records[record.UserID+"/"+record.Key] = record
+	return record, true, nil
+}
+
+func (m *idempotentDB) Complete(record db.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.completeError {
+		return errors.New("failed to complete")
+	}
+	m.records[record.UserID+"/"+record.Key] = record
+	return nil
+}
+
+func (m *idempotentDB) Release(userID string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, userID+"/"+key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	store := &idempotentDB{records: make(map[string]db.IdempotencyRecord)}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithIdempotency(time.Hour))
+	post := func(key string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/sessions/987/feedback", bytes.NewReader([]byte(body)))
+		request.Header.Set("Ubi-UserId", "123")
+		request.Header.Set("Idempotency-Key", key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	//
+	// The first request is processed and its response is replayed to identical retries
+	//
+	first := post("abc", `{"comment":"A Test", "rating":4}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request returned wrong status code: got %v want %v", first.Code, http.StatusCreated)
+	}
+	retry := post("abc", `{"comment":"A Test", "rating":4}`)
+	if retry.Code != http.StatusCreated {
+		t.Errorf("retry returned wrong status code: got %v want %v", retry.Code, http.StatusCreated)
+	} else if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected the retry to be replayed")
+	} else if retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("expected location %s but got %s", first.Header().Get("Location"), retry.Header().Get("Location"))
+	} else if retry.Body.String() != first.Body.String() {
+		t.Errorf("expected body %s but got %s", first.Body.String(), retry.Body.String())
+	}
+	//
+	// Reusing the key for a different request is rejected
+	//
+	if reused := post("abc", `{"comment":"Changed", "rating":4}`); reused.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key returned wrong status code: got %v want %v", reused.Code, http.StatusUnprocessableEntity)
+	}
+	//
+	// A request still being processed cannot be replayed yet
+	//
+	hash := store.records["user:123/abc"].RequestHash
+	store.records["user:123/def"] = db.IdempotencyRecord{UserID: "user:123", Key: "def", RequestHash: hash}
+	if pending := post("def", `{"comment":"A Test", "rating":4}`); pending.Code != http.StatusConflict {
+		t.Errorf("pending key returned wrong status code: got %v want %v", pending.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	store := &idempotentDB{mockDB: mockDB{insertError: true}, records: make(map[string]db.IdempotencyRecord)}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithIdempotency(time.Hour))
+	request := httptest.NewRequest(http.MethodPost, "/v1/sessions/987/feedback",
+		bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
+	request.Header.Set("Ubi-UserId", "123")
+	request.Header.Set("Idempotency-Key", "abc")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusInternalServerError)
+	} else if len(store.records) != 0 {
+		t.Errorf("expected the key to be released but got %v", store.records)
+	}
+}
+
+// panicDB is an idempotentDB whose inserts panic.
+type panicDB struct {
+	*idempotentDB
+}
+
+func (m panicDB) Insert(feedback model.Feedback) (model.Feedback, error) {
+	panic("failed to insert")
+}
+
+func TestIdempotency_UnrecordedReleasesKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(records map[string]db.IdempotencyRecord) db.DB
+	}{
+		{
+			name: "Handler Panics",
+			store: func(records map[string]db.IdempotencyRecord) db.DB {
+				return panicDB{idempotentDB: &idempotentDB{records: records}}
+			},
+		},
+		{
+			name: "Complete Fails",
+			store: func(records map[string]db.IdempotencyRecord) db.DB {
+				return &idempotentDB{records: records, completeError: true}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := make(map[string]db.IdempotencyRecord)
+			handler := transport.NewRouter(transport.WithDB(test.store(records)), transport.WithIdempotency(time.Hour))
+			request := httptest.NewRequest(http.MethodPost, "/v1/sessions/987/feedback",
+				bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
+			request.Header.Set("Ubi-UserId", "123")
+			request.Header.Set("Idempotency-Key", "abc")
+			func() {
+				defer func() {
+					recover()
+				}()
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+			}()
+			if len(records) != 0 {
+				t.Errorf("expected the key to be released but got %v", records)
+			}
+		})
+	}
+}
+
+func TestIdempotency_Anonymous(t *testing.T) {
+	store := &idempotentDB{records: make(map[string]db.IdempotencyRecord)}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithIdempotency(time.Hour))
+	request := httptest.NewRequest(http.MethodPost, "/v1/sessions/987/feedback",
+		bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
+	request.Header.Set("Idempotency-Key", "abc")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	//
+	// Requests without a user do not share a key space, they are not recorded
+	//
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusBadRequest)
+	} else if len(store.records) != 0 {
+		t.Errorf("expected the key to not be recorded but got %v", store.records)
+	}
+}
+
+func TestIdempotency_Operator(t *testing.T) {
+	feedbacks := []model.Feedback{{ID: 2, UserID: "456", SessionID: "987", Version: 1,
+		ModerationStatus: model.ModerationFlagged}}
+	store := &idempotentDB{mockDB: mockDB{feedbacks: feedbacks}, records: make(map[string]db.IdempotencyRecord)}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithIdempotency(time.Hour),
+		transport.WithOperatorTokens("secret"))
+	approve := func(authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/moderation/feedback/2/approve", nil)
+		request.Header.Set("Authorization", authorization)
+		request.Header.Set("Idempotency-Key", "abc")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	//
+	// Authentication failures are not recorded so the request can be retried with a token
+	//
+	if unauthorized := approve("Bearer wrong"); unauthorized.Code != http.StatusUnauthorized {
+		t.Fatalf("request without a valid token returned wrong status code: got %v want %v", unauthorized.Code,
+			http.StatusUnauthorized)
+	} else if len(store.records) != 0 {
+		t.Fatalf("expected the key to be released but got %v", store.records)
+	}
+	//
+	// The key is scoped to the operator and the ETag is replayed
+	//
+	if first := approve("Bearer secret"); first.Code != http.StatusOK {
+		t.Fatalf("first request returned wrong status code: got %v want %v", first.Code, http.StatusOK)
+	} else if _, ok := store.records["operator:operator/abc"]; !ok {
+		t.Fatalf("expected the key to be scoped to the operator but got %v", store.records)
+	}
+	retry := approve("Bearer secret")
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected the retry to be replayed")
+	} else if retry.Header().Get("ETag") != `"2"` {
+		t.Errorf("expected ETag \"2\" but got %s", retry.Header().Get("ETag"))
+	}
+}
+
+// idempotentWebhookDB is a webhookDB that records idempotency keys in memory.
+type idempotentWebhookDB struct {
+	*webhookDB
+	idempotency *idempotentDB
+}
+
+func (m idempotentWebhookDB) Reserve(record db.IdempotencyRecord) (db.IdempotencyRecord, bool, error) {
+	return m.idempotency.Reserve(record)
+}
+
+func (m idempotentWebhookDB) Complete(record db.IdempotencyRecord) error {
+	return m.idempotency.Complete(record)
+}
+
+func (m idempotentWebhookDB) Release(userID string, key string) error {
+	return m.idempotency.Release(userID, key)
+}
+
+func TestIdempotency_WebhookSecretNotRecorded(t *testing.T) {
+	store := idempotentWebhookDB{
+		webhookDB:   &webhookDB{webhooks: make(map[int64]model.Webhook)},
+		idempotency: &idempotentDB{records: make(map[string]db.IdempotencyRecord)},
+	}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithIdempotency(time.Hour),
+		transport.WithOperatorTokens("secret"))
+	request := httptest.NewRequest(http.MethodPost, "/v1/webhooks",
+		bytes.NewReader([]byte(`{"url":"https://example.com/hook","events":["feedback.created"]}`)))
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("Idempotency-Key", "abc")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusCreated)
+	} else if len(store.idempotency.records) != 0 {
+		t.Errorf("expected the response to not be recorded but got %v", store.idempotency.records)
+	}
+}
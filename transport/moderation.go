@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerWWWAuthenticate = "WWW-Authenticate"
+	queryLimit            = "limit"
+	queryStatus           = "status"
+	queueLimit            = 50
+	maxQueueLimit         = 500
+	// queueReported lists the approved feedback users have reported rather than feedback with a moderation status.
+	queueReported = "reported"
+)
+
+// queueStatuses are the moderation statuses of the feedback operators can list.
+var queueStatuses = map[model.ModerationStatus]bool{
+	model.ModerationFlagged:  true,
+	model.ModerationHidden:   true,
+	model.ModerationRejected: true,
+}
+
+// QueuedFeedback is a feedback awaiting review along with how many users reported it.
+type QueuedFeedback struct {
+	model.Feedback
+	Reports db.ReportCount `json:"reports"`
+}
+
+// actorKey is the context key of the actor of a request.
+type actorKey struct{}
+
+// operatorMiddleware only lets operators authenticated with one of the operator tokens through. The operator is the
+// actor of the request.
+func (s *HTTPServer) operatorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := s.operator(r)
+		if !ok {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			w.Header().Set(headerWWWAuthenticate, "Bearer")
+			writeHTTPError(http.StatusUnauthorized, "Requires an operator token", nil, w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, db.OperatorActor(name))))
+	})
+}
+
+// actor provides the actor of the request set by the operator middleware.
+func actor(r *http.Request) string {
+	name, _ := r.Context().Value(actorKey{}).(string)
+	return name
+}
+
+// ModerationQueue retrieves the feedback with a moderation status, oldest first, along with its report counts. The
+// 'status' query param is one of 'flagged', the default, 'hidden', 'rejected' or 'reported', the approved feedback
+// users have reported, most reported first. The 'limit' query param specifies how many are returned.
+func (s *HTTPServer) ModerationQueue() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		limit, ok := queryInt(r, queryLimit, queueLimit, maxQueueLimit, w)
+		if !ok {
+			return
+		}
+		status := model.ModerationFlagged
+		if value := r.URL.Query().Get(queryStatus); len(value) > 0 {
+			status = model.ModerationStatus(value)
+			if !queueStatuses[status] && value != queueReported {
+				writeHTTPError(http.StatusBadRequest,
+					fmt.Sprintf("Query param '%s' must be one of '%s', '%s', '%s' or '%s'", queryStatus,
+						model.ModerationFlagged, model.ModerationHidden, model.ModerationRejected, queueReported), nil, w)
+				return
+			}
+		}
+		var feedback []model.Feedback
+		var err error
+		if status == queueReported {
+			feedback, err = s.DB.FindReported(limit)
+		} else {
+			feedback, err = s.DB.FindByModerationStatus(status, limit)
+		}
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve the %s feedback", status), err,
+				w)
+			return
+		}
+		ids := make([]int32, len(feedback))
+		for i, f := range feedback {
+			ids[i] = f.ID
+		}
+		counts, err := s.DB.ReportCounts(ids)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to count the reports of the %s feedback", status), err, w)
+			return
+		}
+		queue := make([]QueuedFeedback, len(feedback))
+		for i, f := range feedback {
+			queue[i] = QueuedFeedback{Feedback: f, Reports: counts[f.ID]}
+			if queue[i].Reports.Reasons == nil {
+				queue[i].Reports.Reasons = map[model.ReportReason]int{}
+			}
+		}
+		if err := json.NewEncoder(w).Encode(queue); err != nil {
+			log.Println(fmt.Errorf("failed to write the %s feedback: %w", status, err))
+		}
+	}
+}
+
+// queryInt provides the integer query param, between 1 and the max, or the default when it is not provided. The
+// error is written and false is returned if it is not valid.
+func queryInt(r *http.Request, name string, defaultValue int, max int, w http.ResponseWriter) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return defaultValue, true
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 || i > max {
+		writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Query param '%s' must be between 1 and %d", name, max), nil, w)
+		return 0, false
+	}
+	return i, true
+}
+
+// reviewRequest is the decision of an operator on a feedback. The reason is only required to hide feedback.
+type reviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReviewFeedback sets the moderation status of a feedback to the decision of an operator, e.g. approving a flagged
+// feedback so it is shown or hiding abusive feedback. The change is audited as made by the operator. If the feedback
+// does not exist, a 404 is returned.
+func (s *HTTPServer) ReviewFeedback(status model.ModerationStatus) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 32)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Feedback %s does not exist", mux.Vars(r)[pathID]), nil, w)
+			return
+		}
+		//
+		// The body is optional
+		//
+		defer closeRequestBody(r.Body)
+		var review reviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil && !errors.Is(err, io.EOF) {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to decode the review of feedback %d", id), err, w)
+			return
+		}
+		review.Reason = strings.TrimSpace(review.Reason)
+		if !model.ValidComment(review.Reason) {
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Reason is longer than %d characters", model.MaxCommentLength), nil, w)
+			return
+		} else if status == model.ModerationHidden && len(review.Reason) == 0 {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("A reason is required to hide feedback %d", id), nil, w)
+			return
+		}
+		feedback, err := s.service().Review(int32(id), status, review.Reason, actor(r))
+		if err != nil {
+			writeServiceError(err, fmt.Sprintf("Failed to review feedback %d", id), w)
+			return
+		}
+		w.Header().Set(headerETag, feedbackETag(feedback.Version))
+		if err := json.NewEncoder(w).Encode(feedback); err != nil {
+			log.Println(fmt.Errorf("failed to write feedback %d: %w", id, err))
+		}
+	}
+}
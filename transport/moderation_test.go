@@ -0,0 +1,168 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var moderator = moderation.Chain{
+	moderation.NewWordlist([]string{"noob"}, moderation.Mask),
+	moderation.NewWordlist([]string{"scam"}, moderation.Reject),
+	moderation.Links{Max: 0, Action: moderation.Flag},
+}
+
+func TestHTTPServer_InsertFeedback_Moderation(t *testing.T) {
+	tests := []struct {
+		name            string
+		comment         string
+		expectedCode    int
+		expectedComment string
+		expectedStatus  model.ModerationStatus
+	}{
+		{name: "Approved", comment: "A Test", expectedCode: http.StatusCreated, expectedComment: "A Test", expectedStatus: model.ModerationApproved},
+		{name: "Masked", comment: "n00b host", expectedCode: http.StatusCreated, expectedComment: "**** host", expectedStatus: model.ModerationApproved},
+		{name: "Flagged", comment: "see example.com", expectedCode: http.StatusCreated, expectedComment: "see example.com", expectedStatus: model.ModerationFlagged},
+		{name: "Rejected", comment: "Sc4m", expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{}), transport.WithModerator(moderator))
+			body, _ := json.Marshal(map[string]interface{}{"comment": test.comment, "rating": 4})
+			request := httptest.NewRequest(http.MethodPost, "/v1/sessions/987/feedback", bytes.NewReader(body))
+			request.Header.Set("Ubi-UserId", "123")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusCreated {
+				return
+			}
+			var feedback model.Feedback
+			if err := json.NewDecoder(recorder.Body).Decode(&feedback); err != nil {
+				t.Fatalf("failed to decode the feedback: %v", err)
+			} else if feedback.Comment != test.expectedComment {
+				t.Errorf("expected comment '%s' but got '%s'", test.expectedComment, feedback.Comment)
+			} else if feedback.ModerationStatus != test.expectedStatus {
+				t.Errorf("expected moderation status %s but got %s", test.expectedStatus, feedback.ModerationStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_RetrieveFeedbackByID_Flagged(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Comment: "see example.com", Rating: 4, Date: time.Now(), Version: 1,
+			ModerationStatus: model.ModerationFlagged},
+	}
+	handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks}))
+	for userID, expectedCode := range map[string]int{"123": http.StatusOK, "456": http.StatusNotFound} {
+		request := httptest.NewRequest(http.MethodGet, "/v1/sessions/987/feedback/1", nil)
+		request.Header.Set("Ubi-UserId", userID)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != expectedCode {
+			t.Errorf("handler returned wrong status code for user %s: got %v want %v", userID, recorder.Code,
+				expectedCode)
+		}
+	}
+}
+
+func TestHTTPServer_ModerationQueue(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Version: 1,
+			ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "456", SessionID: "987", Comment: "see example.com", Rating: 4, Version: 1,
+			ModerationStatus: model.ModerationFlagged},
+		{ID: 3, UserID: "789", SessionID: "987", Comment: "abuse", Rating: 1, Version: 2,
+			ModerationStatus: model.ModerationHidden, ModerationReason: "abusive"},
+	}
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		expectedCode  int
+		expectedIDs   []int32
+	}{
+		{name: "Operator", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int32{2}},
+		{name: "Named Operator", authorization: "Bearer alice-secret", expectedCode: http.StatusOK, expectedIDs: []int32{2}},
+		{name: "Hidden", query: "?status=hidden", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedIDs: []int32{3}},
+		{name: "Approved", query: "?status=approved", authorization: "Bearer secret", expectedCode: http.StatusBadRequest},
+		{name: "Wrong Token", authorization: "Bearer guess", expectedCode: http.StatusUnauthorized},
+		{name: "Missing Token", expectedCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks}),
+				transport.WithOperatorTokens("secret", "alice:alice-secret"))
+			request := httptest.NewRequest(http.MethodGet, "/v1/moderation/queue"+test.query, nil)
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusOK {
+				return
+			}
+			var queue []model.Feedback
+			if err := json.NewDecoder(recorder.Body).Decode(&queue); err != nil {
+				t.Fatalf("failed to decode the queue: %v", err)
+			} else if len(queue) != len(test.expectedIDs) || queue[0].ID != test.expectedIDs[0] {
+				t.Errorf("expected feedback %v but got %+v", test.expectedIDs, queue)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_ReviewFeedback(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 2, UserID: "456", SessionID: "987", Comment: "see example.com", Rating: 4, Version: 1,
+			ModerationStatus: model.ModerationFlagged},
+	}
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedCode   int
+		expectedStatus model.ModerationStatus
+	}{
+		{name: "Approve", path: "/v1/moderation/feedback/2/approve", expectedCode: http.StatusOK, expectedStatus: model.ModerationApproved},
+		{name: "Reject", path: "/v1/moderation/feedback/2/reject", body: `{"reason":"advertising"}`, expectedCode: http.StatusOK, expectedStatus: model.ModerationRejected},
+		{name: "Not Found", path: "/v1/moderation/feedback/3/approve", expectedCode: http.StatusNotFound},
+		{name: "Bad Body", path: "/v1/moderation/feedback/2/reject", body: `{`, expectedCode: http.StatusBadRequest},
+		{name: "Hide", path: "/v1/moderation/feedback/2/hide", body: `{"reason":" abusive "}`, expectedCode: http.StatusOK, expectedStatus: model.ModerationHidden},
+		{name: "Hide Without Reason", path: "/v1/moderation/feedback/2/hide", expectedCode: http.StatusBadRequest},
+		{name: "Unhide", path: "/v1/moderation/feedback/2/unhide", expectedCode: http.StatusOK, expectedStatus: model.ModerationApproved},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks}),
+				transport.WithOperatorTokens("secret"))
+			request := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader([]byte(test.body)))
+			request.Header.Set("Authorization", "Bearer secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusOK {
+				return
+			}
+			var feedback model.Feedback
+			if err := json.NewDecoder(recorder.Body).Decode(&feedback); err != nil {
+				t.Fatalf("failed to decode the feedback: %v", err)
+			} else if feedback.ModerationStatus != test.expectedStatus {
+				t.Errorf("expected moderation status %s but got %s", test.expectedStatus, feedback.ModerationStatus)
+			} else if recorder.Header().Get("ETag") != `"2"` {
+				t.Errorf("expected ETag \"2\" but got %s", recorder.Header().Get("ETag"))
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportRequest is why a user reports a feedback.
+type reportRequest struct {
+	Reason model.ReportReason `json:"reason"`
+}
+
+// ReportFeedback records a user reporting the feedback of another user. Once the report threshold of users have
+// reported a feedback, it is hidden until an operator reviews it. A user can only report a feedback once, a 409 is
+// returned otherwise.
+func (s *HTTPServer) ReportFeedback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		sessionID := mux.Vars(r)[pathSessionID]
+		userID := strings.TrimSpace(r.Header.Get(headerUserID))
+		if len(userID) == 0 {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Missing Header '%s'", headerUserID), nil, w)
+			return
+		}
+		id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 32)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound,
+				fmt.Sprintf("Feedback %s does not exist for session %s", mux.Vars(r)[pathID], sessionID), nil, w)
+			return
+		}
+		defer closeRequestBody(r.Body)
+		var request reportRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Failed to decode user %s report of feedback %d", userID, id), err, w)
+			return
+		}
+		if !model.ValidReportReason(request.Reason) {
+			reasons := make([]string, len(model.ReportReasons))
+			for i, reason := range model.ReportReasons {
+				reasons[i] = string(reason)
+			}
+			writeHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("Reason must be one of '%s'", strings.Join(reasons, "', '")), nil, w)
+			return
+		}
+		//
+		// Only feedback shown to the user can be reported, and not by the user that provided it
+		//
+		feedback, err := s.DB.FindByID(sessionID, int32(id))
+		if errors.Is(err, db.ErrNotFound) || (err == nil && !feedback.Visible()) {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Feedback %d does not exist for session %s", id, sessionID),
+				nil, w)
+			return
+		} else if err != nil {
+			writeHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to retrieve feedback %d for session %s", id, sessionID), err, w)
+			return
+		} else if feedback.UserID == userID {
+			writeHTTPError(http.StatusForbidden, fmt.Sprintf("User %s cannot report their own feedback", userID), nil, w)
+			return
+		}
+		report := model.Report{
+			FeedbackID: int32(id),
+			SessionID:  sessionID,
+			ReporterID: userID,
+			Reason:     request.Reason,
+			Date:       model.NormalizeDate(time.Now()),
+		}
+		result, err := s.service().Report(report, s.ReportThreshold)
+		if err != nil {
+			writeServiceError(err, fmt.Sprintf("Failed to record user %s report of feedback %d", userID, id), w)
+			return
+		}
+		if result.Hidden {
+			log.Printf("Hid feedback %d for session %s after %d reports\n", id, sessionID, result.Reports)
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Println(fmt.Errorf("failed to write user %s report of feedback %d: %w", userID, id, err))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServer_ReportFeedback(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Version: 1,
+			ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "123", SessionID: "987", Comment: "abuse", Rating: 1, Version: 2,
+			ModerationStatus: model.ModerationHidden},
+	}
+	tests := []struct {
+		name         string
+		path         string
+		userID       string
+		body         string
+		expectedCode int
+	}{
+		{name: "Reported", path: "/v1/sessions/987/feedback/1/reports", userID: "456", body: `{"reason":"spam"}`, expectedCode: http.StatusCreated},
+		{name: "Already Reported", path: "/v1/sessions/987/feedback/1/reports", userID: "789", body: `{"reason":"spam"}`, expectedCode: http.StatusConflict},
+		{name: "Own Feedback", path: "/v1/sessions/987/feedback/1/reports", userID: "123", body: `{"reason":"spam"}`, expectedCode: http.StatusForbidden},
+		{name: "Unknown Reason", path: "/v1/sessions/987/feedback/1/reports", userID: "456", body: `{"reason":"boring"}`, expectedCode: http.StatusBadRequest},
+		{name: "Bad Body", path: "/v1/sessions/987/feedback/1/reports", userID: "456", body: `{`, expectedCode: http.StatusBadRequest},
+		{name: "Missing Header", path: "/v1/sessions/987/feedback/1/reports", body: `{"reason":"spam"}`, expectedCode: http.StatusBadRequest},
+		{name: "Hidden", path: "/v1/sessions/987/feedback/2/reports", userID: "456", body: `{"reason":"hate"}`, expectedCode: http.StatusNotFound},
+		{name: "Not Found", path: "/v1/sessions/987/feedback/3/reports", userID: "456", body: `{"reason":"spam"}`, expectedCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks,
+				reporters: map[string]bool{"789": true}}), transport.WithReportThreshold(1))
+			request := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader([]byte(test.body)))
+			if len(test.userID) > 0 {
+				request.Header.Set("Ubi-UserId", test.userID)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusCreated {
+				return
+			}
+			var report model.Report
+			if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode the report: %v", err)
+			} else if report.FeedbackID != 1 || report.Reason != model.ReportSpam || len(report.ReporterID) > 0 {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_ModerationQueue_Reported(t *testing.T) {
+	feedbacks := []model.Feedback{
+		{ID: 1, UserID: "123", SessionID: "987", Comment: "A Test", Rating: 4, Version: 1,
+			ModerationStatus: model.ModerationApproved},
+		{ID: 2, UserID: "456", SessionID: "987", Comment: "you are bad", Rating: 1, Version: 1,
+			ModerationStatus: model.ModerationApproved},
+	}
+	reports := map[int32]db.ReportCount{
+		2: {Total: 3, Reasons: map[model.ReportReason]int{model.ReportHarassment: 2, model.ReportOther: 1}},
+	}
+	handler := transport.NewRouter(transport.WithDB(mockDB{feedbacks: feedbacks, reports: reports}),
+		transport.WithOperatorTokens("secret"))
+	request := httptest.NewRequest(http.MethodGet, "/v1/moderation/queue?status=reported", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusOK)
+	}
+	var queue []transport.QueuedFeedback
+	if err := json.NewDecoder(recorder.Body).Decode(&queue); err != nil {
+		t.Fatalf("failed to decode the queue: %v", err)
+	} else if len(queue) != 1 || queue[0].ID != 2 || queue[0].Reports.Total != 3 ||
+		queue[0].Reports.Reasons[model.ReportHarassment] != 2 {
+		t.Errorf("expected feedback 2 with 3 reports but got %+v", queue)
+	}
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// RouterOption configures the router created by NewRouter.
+type RouterOption func(s *HTTPServer)
+
+// WithDB sets the DB the handlers use.
+func WithDB(database db.DB) RouterOption {
+	return func(s *HTTPServer) {
+		s.DB = database
+	}
+}
+
+// WithPrefix mounts every route under the prefix, e.g. '/feedback' when embedded in a gateway.
+func WithPrefix(prefix string) RouterOption {
+	return func(s *HTTPServer) {
+		s.Prefix = prefix
+	}
+}
+
+// WithMiddleware adds middleware that wraps every route.
+func WithMiddleware(middleware ...mux.MiddlewareFunc) RouterOption {
+	return func(s *HTTPServer) {
+		s.Middleware = append(s.Middleware, middleware...)
+	}
+}
+
+// WithHealth sets the health that gates the APIs and is reported by the health routes.
+func WithHealth(health *Health) RouterOption {
+	return func(s *HTTPServer) {
+		s.Health = health
+	}
+}
+
+// WithCORS allows browsers to call the APIs from other origins.
+func WithCORS(cors CORSOptions) RouterOption {
+	return func(s *HTTPServer) {
+		s.CORS = &cors
+	}
+}
+
+// WithLegacyRoutes mounts the deprecated root routes. The sunset is advertised to clients when not zero.
+func WithLegacyRoutes(sunset time.Time) RouterOption {
+	return func(s *HTTPServer) {
+		s.LegacyRoutes = true
+		s.LegacySunset = sunset
+	}
+}
+
+// WithTrustedTokens allows the callers authenticated with one of the tokens to provide when feedback occurred, up to the
+// window in the past.
+func WithTrustedTokens(window time.Duration, tokens ...string) RouterOption {
+	return func(s *HTTPServer) {
+		s.OccurredAtWindow = window
+		s.TrustedTokens = append(s.TrustedTokens, tokens...)
+	}
+}
+
+// WithIdempotency replays the responses of POST requests with an Idempotency-Key header for the TTL. The DB must be an
+// IdempotencyStore for responses to be recorded.
+func WithIdempotency(ttl time.Duration) RouterOption {
+	return func(s *HTTPServer) {
+		s.IdempotencyTTL = ttl
+	}
+}
+
+// WithModerator moderates the comments of feedback with the moderator.
+func WithModerator(moderator moderation.Moderator) RouterOption {
+	return func(s *HTTPServer) {
+		s.Moderator = moderator
+	}
+}
+
+// WithOperatorTokens allows the operators authenticated with one of the tokens to review flagged feedback.
+func WithOperatorTokens(tokens ...string) RouterOption {
+	return func(s *HTTPServer) {
+		s.OperatorTokens = append(s.OperatorTokens, tokens...)
+	}
+}
+
+// WithReportThreshold hides feedback once the threshold of users have reported it.
+func WithReportThreshold(threshold int) RouterOption {
+	return func(s *HTTPServer) {
+		s.ReportThreshold = threshold
+	}
+}
+
+// WithStream streams the feedback published to the broker to the clients watching its session. Idle streams are written
+// to every heartbeat interval.
+func WithStream(broker *pubsub.Broker, heartbeat time.Duration) RouterOption {
+	return func(s *HTTPServer) {
+		s.Broker = broker
+		s.HeartbeatInterval = heartbeat
+	}
+}
+
+// WithMaxSubscriptions limits how many sessions a WebSocket connection can subscribe to.
+func WithMaxSubscriptions(max int) RouterOption {
+	return func(s *HTTPServer) {
+		s.MaxSubscriptions = max
+	}
+}
+
+// WithGraphQLMaxComplexity limits how complex a GraphQL query can be.
+func WithGraphQLMaxComplexity(max int) RouterOption {
+	return func(s *HTTPServer) {
+		s.GraphQLMaxComplexity = max
+	}
+}
+
+// NewRouter creates the handler that serves the feedback API without starting a server.
+func NewRouter(opts ...RouterOption) http.Handler {
+	s := &HTTPServer{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s.Handler()
+}
+
+// Handler provides the handler that serves the feedback API with the server's configuration.
+func (s *HTTPServer) Handler() http.Handler {
+	return s.router()
+}
@@ -0,0 +1,118 @@
+package transport_test
+
+import (
+	"bytes"
+	"github.com/Piszmog/feedback-service/transport"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var routesTable = []struct {
+	method     string
+	path       string
+	options    []transport.RouterOption
+	statusCode int
+	deprecated bool
+}{
+	{method: http.MethodGet, path: "/v1/sessions/987/feedback", statusCode: http.StatusOK},
+	{method: http.MethodPost, path: "/v1/sessions/987/feedback", statusCode: http.StatusCreated},
+	{method: http.MethodGet, path: "/v1/sessions/987/feedback/1", statusCode: http.StatusNotFound},
+	{method: http.MethodGet, path: "/v1/sessions/987/feedback/abc", statusCode: http.StatusNotFound},
+	{method: http.MethodGet, path: "/987", statusCode: http.StatusNotFound},
+	{method: http.MethodGet, path: "/healthz", statusCode: http.StatusOK},
+	{
+		method:     http.MethodGet,
+		path:       "/987",
+		options:    []transport.RouterOption{transport.WithLegacyRoutes(time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC))},
+		statusCode: http.StatusOK,
+		deprecated: true,
+	},
+	{
+		method:     http.MethodPost,
+		path:       "/987",
+		options:    []transport.RouterOption{transport.WithLegacyRoutes(time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC))},
+		statusCode: http.StatusCreated,
+		deprecated: true,
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/v1/sessions/987/feedback",
+		options:    []transport.RouterOption{transport.WithLegacyRoutes(time.Time{})},
+		statusCode: http.StatusOK,
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/feedback/v1/sessions/987/feedback",
+		options:    []transport.RouterOption{transport.WithPrefix("/feedback")},
+		statusCode: http.StatusOK,
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/v1/sessions/987/feedback",
+		options:    []transport.RouterOption{transport.WithPrefix("/feedback")},
+		statusCode: http.StatusNotFound,
+	},
+	{
+		method:     http.MethodGet,
+		path:       "/v1/sessions/987/feedback",
+		options:    []transport.RouterOption{transport.WithHealth(&transport.Health{})},
+		statusCode: http.StatusServiceUnavailable,
+	},
+}
+
+func TestNewRouter(t *testing.T) {
+	for _, entry := range routesTable {
+		//
+		// Create the handler and serve it without starting the application server
+		//
+		server := httptest.NewServer(transport.NewRouter(append(entry.options, transport.WithDB(mockDB{}))...))
+		request, err := http.NewRequest(entry.method, server.URL+entry.path, bytes.NewReader([]byte(`{"comment":"A Test", "rating":4}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Ubi-UserId", "123")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		server.Close()
+		//
+		// Perform checks
+		//
+		if status := response.StatusCode; status != entry.statusCode {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", entry.method, entry.path, status, entry.statusCode)
+		}
+		deprecated := len(response.Header.Get("Deprecation")) > 0
+		if deprecated != entry.deprecated {
+			t.Errorf("%s %s expected deprecated to be %t", entry.method, entry.path, entry.deprecated)
+		}
+		if entry.deprecated {
+			if sunset := response.Header.Get("Sunset"); sunset != "Tue, 30 Jun 2020 00:00:00 GMT" {
+				t.Errorf("unexpected sunset header %s", sunset)
+			} else if link := response.Header.Get("Link"); link != `</v1/sessions/987/feedback>; rel="successor-version"` {
+				t.Errorf("unexpected link header %s", link)
+			}
+		}
+	}
+}
+
+func TestNewRouter_WithMiddleware(t *testing.T) {
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Gateway", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := transport.NewRouter(transport.WithDB(mockDB{}), transport.WithMiddleware(mux.MiddlewareFunc(middleware)))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/sessions/987/feedback", nil))
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	} else if recorder.Header().Get("X-Gateway") != "true" {
+		t.Error("expected middleware to wrap the route")
+	}
+}
@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+const (
+	headerDeprecation = "Deprecation"
+	headerLink        = "Link"
+	headerSunset      = "Sunset"
+	pathHealth        = "/healthz"
+	pathReady         = "/readyz"
+	pathV1            = "/v1"
+)
+
+// router creates the router with every API version mounted side by side.
+func (s *HTTPServer) router() *mux.Router {
+	root := mux.NewRouter()
+	router := root
+	if len(s.Prefix) > 0 {
+		router = root.PathPrefix(s.Prefix).Subrouter()
+	}
+	router.Use(loggingMiddleware)
+	router.Use(s.Middleware...)
+	//
+	// Health is not versioned
+	//
+	router.HandleFunc(pathHealth, s.Liveness()).Methods(http.MethodGet)
+	router.HandleFunc(pathReady, s.Readiness()).Methods(http.MethodGet)
+	//
+	// Mount each version under its prefix. The legacy routes are mounted last since they are at the root
+	//
+	s.mountAPI(router.PathPrefix(pathV1).Subrouter(), s.v1Routes)
+	s.mountAPI(router.PathPrefix(pathGraphQL).Subrouter(), s.graphQLRoutes)
+	if s.LegacyRoutes {
+		legacy := router.PathPrefix("/").Subrouter()
+		legacy.Use(s.deprecationMiddleware)
+		s.mountAPI(legacy, s.legacyRoutes)
+	}
+	return root
+}
+
+// mountAPI applies the middleware shared by every API version and registers the version's routes.
+func (s *HTTPServer) mountAPI(router *mux.Router, routes func(router *mux.Router)) {
+	if s.CORS != nil {
+		router.Use(s.CORS.corsMiddleware)
+	}
+	router.Use(s.readinessMiddleware)
+	router.Use(s.idempotencyMiddleware)
+	routes(router)
+}
+
+// v1Routes are the routes of version 1 of the API.
+func (s *HTTPServer) v1Routes(router *mux.Router) {
+	router.HandleFunc("/sessions/{sessionID}/feedback", s.InsertFeedback()).Methods(s.methods(http.MethodPost)...)
+	router.HandleFunc("/sessions/{sessionID}/feedback", s.RetrieveFeedback()).Methods(s.methods(http.MethodGet)...)
+	router.HandleFunc("/sessions/{sessionID}/feedback/{id:[0-9]+}", s.RetrieveFeedbackByID()).
+		Methods(s.methods(http.MethodGet)...)
+	router.HandleFunc("/sessions/{sessionID}/feedback/{id:[0-9]+}", s.UpdateFeedback()).
+		Methods(s.methods(http.MethodPatch)...)
+	router.HandleFunc("/sessions/{sessionID}/feedback/{id:[0-9]+}", s.DeleteFeedback()).
+		Methods(s.methods(http.MethodDelete)...)
+	router.HandleFunc("/sessions/{sessionID}/feedback/{id:[0-9]+}/reports", s.ReportFeedback()).
+		Methods(s.methods(http.MethodPost)...)
+	if s.Broker != nil {
+		router.HandleFunc("/sessions/{sessionID}/stream", s.StreamFeedback()).Methods(s.methods(http.MethodGet)...)
+		router.HandleFunc("/ws", s.WebSocketFeed()).Methods(s.methods(http.MethodGet)...)
+	}
+	router.HandleFunc("/batch", s.InsertFeedbackBatch()).Methods(s.methods(http.MethodPost)...)
+	//
+	// Operators review the flagged feedback, hide abusive feedback and audit the changes made to feedback
+	//
+	moderation := router.PathPrefix("/moderation").Subrouter()
+	moderation.Use(s.operatorMiddleware)
+	moderation.HandleFunc("/queue", s.ModerationQueue()).Methods(s.methods(http.MethodGet)...)
+	moderation.HandleFunc("/feedback/{id:[0-9]+}/approve", s.ReviewFeedback(model.ModerationApproved)).
+		Methods(s.methods(http.MethodPost)...)
+	moderation.HandleFunc("/feedback/{id:[0-9]+}/reject", s.ReviewFeedback(model.ModerationRejected)).
+		Methods(s.methods(http.MethodPost)...)
+	moderation.HandleFunc("/feedback/{id:[0-9]+}/hide", s.ReviewFeedback(model.ModerationHidden)).
+		Methods(s.methods(http.MethodPost)...)
+	moderation.HandleFunc("/feedback/{id:[0-9]+}/unhide", s.ReviewFeedback(model.ModerationApproved)).
+		Methods(s.methods(http.MethodPost)...)
+	router.Handle("/audit", s.operatorMiddleware(http.HandlerFunc(s.RetrieveAudit()))).
+		Methods(s.methods(http.MethodGet)...)
+	//
+	// Exports have the feedback of every user, including feedback that is not shown, so only operators can export
+	//
+	router.Handle("/export", s.operatorMiddleware(http.HandlerFunc(s.ExportFeedback()))).
+		Methods(s.methods(http.MethodGet)...)
+	//
+	// Operators subscribe other services to the events of feedback
+	//
+	webhooks := router.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(s.operatorMiddleware)
+	//
+	// The response of a created webhook has its secret, it is not recorded for retries
+	//
+	webhooks.HandleFunc("", s.CreateWebhook()).Methods(s.methods(http.MethodPost)...).Name(routeUnrecorded)
+	webhooks.HandleFunc("", s.RetrieveWebhooks()).Methods(s.methods(http.MethodGet)...)
+	webhooks.HandleFunc("/{id:[0-9]+}", s.RetrieveWebhook()).Methods(s.methods(http.MethodGet)...)
+	webhooks.HandleFunc("/{id:[0-9]+}", s.DeleteWebhook()).Methods(s.methods(http.MethodDelete)...)
+	webhooks.HandleFunc("/{id:[0-9]+}/deliveries", s.RetrieveWebhookDeliveries()).
+		Methods(s.methods(http.MethodGet)...)
+	webhooks.HandleFunc("/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/retry", s.RetryWebhookDelivery()).
+		Methods(s.methods(http.MethodPost)...)
+	webhooks.HandleFunc("/{id:[0-9]+}/attempts", s.RetrieveWebhookAttempts()).Methods(s.methods(http.MethodGet)...)
+}
+
+// graphQLRoutes are the routes of the GraphQL API. It is not versioned, its schema evolves instead.
+func (s *HTTPServer) graphQLRoutes(router *mux.Router) {
+	router.HandleFunc("", s.GraphQL()).Methods(s.methods(http.MethodPost)...)
+}
+
+// legacyRoutes are the original routes mounted at the root. They are deprecated in favor of v1.
+func (s *HTTPServer) legacyRoutes(router *mux.Router) {
+	router.HandleFunc("/{sessionID}", s.InsertFeedback()).Methods(s.methods(http.MethodPost)...)
+	router.HandleFunc("/{sessionID}", s.RetrieveFeedback()).Methods(s.methods(http.MethodGet)...)
+}
+
+// deprecationMiddleware marks the responses of deprecated routes and points clients to the successor version.
+func (s *HTTPServer) deprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerDeprecation, "true")
+		if !s.LegacySunset.IsZero() {
+			w.Header().Set(headerSunset, s.LegacySunset.UTC().Format(http.TimeFormat))
+		}
+		if sessionID, ok := mux.Vars(r)[pathSessionID]; ok {
+			w.Header().Set(headerLink, `<`+s.Prefix+pathV1+`/sessions/`+sessionID+`/feedback>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// methods provides the methods a route accepts. Preflight requests are accepted when CORS is enabled.
+func (s *HTTPServer) methods(methods ...string) []string {
+	if s.CORS != nil {
+		return append(methods, http.MethodOptions)
+	}
+	return methods
+}
@@ -2,11 +2,16 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/moderation"
+	"github.com/Piszmog/feedback-service/pubsub"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -18,21 +23,55 @@ type HTTPServer struct {
 	ReadTimeout  time.Duration
 	IdleTimeout  time.Duration
 	DB           db.DB
-	srv          *http.Server
+	Health       *Health
+	// TLS serves HTTPS, with HTTP/2, when provided.
+	TLS *TLSOptions
+	// RedirectPort is the port to redirect plaintext requests to HTTPS from. Only used when TLS is provided.
+	RedirectPort string
+	// CORS allows browsers to call the APIs from other origins when provided.
+	CORS *CORSOptions
+	// LegacyRoutes mounts the deprecated root routes alongside the versioned routes.
+	LegacyRoutes bool
+	// LegacySunset is when the legacy routes will be removed. Advertised to clients when set.
+	LegacySunset time.Time
+	// TrustedTokens authenticate the callers, with an 'Authorization: Bearer' header, that can provide when feedback
+	// occurred.
+	TrustedTokens []string
+	// OccurredAtWindow is how far in the past trusted callers can date feedback.
+	OccurredAtWindow time.Duration
+	// IdempotencyTTL is how long the responses of requests with an Idempotency-Key header are replayed. Disabled when 0.
+	IdempotencyTTL time.Duration
+	// Moderator moderates the comments of feedback. Comments are not moderated when nil.
+	Moderator moderation.Moderator
+	// OperatorTokens authenticate the operators, with an 'Authorization: Bearer' header, that review flagged feedback.
+	OperatorTokens []string
+	// ReportThreshold is how many users have to report a feedback for it to be hidden. Reports never hide feedback
+	// when 0.
+	ReportThreshold int
+	// Broker streams the newly inserted feedback to the clients watching its session. Streaming is disabled when nil.
+	Broker *pubsub.Broker
+	// HeartbeatInterval is how often an idle stream is written to so proxies do not close it.
+	HeartbeatInterval time.Duration
+	// MaxSubscriptions is how many sessions a WebSocket connection can subscribe to.
+	MaxSubscriptions int
+	// GraphQLMaxComplexity is how complex a GraphQL query can be. A default limit is used when 0.
+	GraphQLMaxComplexity int
+	// GRPCPort is the port to serve the gRPC API on. The gRPC API is not served when empty.
+	GRPCPort string
+	// Prefix mounts every route under the prefix when provided.
+	Prefix string
+	// Middleware wraps every route.
+	Middleware  []mux.MiddlewareFunc
+	mu          sync.Mutex
+	srv         *http.Server
+	redirectSrv *http.Server
+	reloader    *certReloader
+	grpcSrv     *grpc.Server
+	closed      bool
 }
 
-// Start starts the HTTP server.
+// Start starts the HTTP server. It blocks until the server is shutdown, which is not treated as a failure.
 func (s *HTTPServer) Start() error {
-	//
-	// Setup the routing
-	//
-	router := mux.NewRouter()
-	router.Use(loggingMiddleware)
-	//
-	// Setup the possible paths
-	//
-	router.HandleFunc("/{sessionID}", s.InsertFeedback()).Methods(http.MethodPost)
-	router.HandleFunc("/{sessionID}", s.RetrieveFeedback()).Methods(http.MethodGet)
 	//
 	// Configure the server
 	//
@@ -41,18 +80,82 @@ func (s *HTTPServer) Start() error {
 		WriteTimeout: s.WriteTimeout,
 		ReadTimeout:  s.ReadTimeout,
 		IdleTimeout:  s.IdleTimeout,
-		Handler:      router,
+		Handler:      s.Handler(),
+	}
+	var reloader *certReloader
+	if s.TLS != nil {
+		var err error
+		if reloader, err = newCertReloader(s.TLS.CertFile, s.TLS.KeyFile); err != nil {
+			return err
+		}
+		tlsConfig, err := s.TLS.tlsConfig(reloader)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+	}
+	//
+	// Streams only end when their clients disconnect, so they are ended when the server shuts down
+	//
+	if s.Broker != nil {
+		srv.RegisterOnShutdown(s.Broker.Close)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
 	}
 	s.srv = srv
+	s.reloader = reloader
+	s.mu.Unlock()
+	if len(s.GRPCPort) > 0 {
+		if err := s.startGRPC(srv.TLSConfig); err != nil {
+			return err
+		}
+	}
 	//
 	// Start the server
 	//
-	if err := srv.ListenAndServe(); err != nil {
+	var err error
+	if s.TLS != nil {
+		if s.TLS.ReloadInterval > 0 {
+			go reloader.watch(s.TLS.ReloadInterval)
+		}
+		if len(s.RedirectPort) > 0 {
+			s.startRedirect()
+		}
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start server on port %s: %w", s.Port, err)
 	}
 	return nil
 }
 
+func (s *HTTPServer) startRedirect() {
+	redirectSrv := &http.Server{
+		Addr:         s.Host + ":" + s.RedirectPort,
+		WriteTimeout: s.WriteTimeout,
+		ReadTimeout:  s.ReadTimeout,
+		IdleTimeout:  s.IdleTimeout,
+		Handler:      redirectHandler(s.Port),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.redirectSrv = redirectSrv
+	s.mu.Unlock()
+	go func() {
+		if err := redirectSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println(fmt.Errorf("failed to start redirect server on port %s: %w", s.RedirectPort, err))
+		}
+	}()
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//
@@ -64,17 +167,49 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Shutdown shutdowns the server with the provided timeout.
-func (s *HTTPServer) Shutdown(timeout time.Duration) {
+// Shutdown shutdowns the server with the provided timeout. If connections are still active after the timeout, they are
+// forcibly closed and an error is returned.
+func (s *HTTPServer) Shutdown(timeout time.Duration) error {
+	s.mu.Lock()
+	srv := s.srv
+	redirectSrv := s.redirectSrv
+	reloader := s.reloader
+	grpcSrv := s.grpcSrv
+	s.closed = true
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	if reloader != nil {
+		reloader.Stop()
+	}
 	//
 	// Create a deadline
 	//
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			log.Println(fmt.Errorf("failed to shutdown the redirect server: %w", err))
+		}
+	}
+	//
+	// gRPC streams only end when their clients cancel them, so they are ended before the gRPC server stops
+	//
+	if grpcSrv != nil {
+		if s.Broker != nil {
+			s.Broker.Close()
+		}
+		stopGRPC(ctx, grpcSrv)
+	}
 	//
 	// Will wait for timeout if there are connections
 	//
-	if err := s.srv.Shutdown(ctx); err != nil {
-		log.Println(err)
+	if err := srv.Shutdown(ctx); err != nil {
+		if closeErr := srv.Close(); closeErr != nil {
+			log.Println(fmt.Errorf("failed to close the server: %w", closeErr))
+		}
+		return fmt.Errorf("failed to gracefully shutdown the server: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"errors"
+	"github.com/Piszmog/feedback-service/feedback"
+	"net/http"
+)
+
+// serviceStatuses are the HTTP statuses the business rules of the feedback service are reported as.
+var serviceStatuses = map[error]int{
+	feedback.ErrDuplicate:       http.StatusConflict,
+	feedback.ErrInvalidRating:   http.StatusBadRequest,
+	feedback.ErrInvalidComment:  http.StatusBadRequest,
+	feedback.ErrRejected:        http.StatusBadRequest,
+	feedback.ErrInvalidDate:     http.StatusBadRequest,
+	feedback.ErrNotFound:        http.StatusNotFound,
+	feedback.ErrInvalidSession:  http.StatusBadRequest,
+	feedback.ErrForbidden:       http.StatusForbidden,
+	feedback.ErrChanged:         http.StatusPreconditionFailed,
+	feedback.ErrDuplicateReport: http.StatusConflict,
+}
+
+// service provides the feedback service on top of the DB, moderator and broker of the server. It is provided per call
+// as the DB is only set once the server has started.
+func (s *HTTPServer) service() *feedback.Service {
+	return &feedback.Service{
+		DB:               s.DB,
+		Moderator:        s.Moderator,
+		Broker:           s.Broker,
+		OccurredAtWindow: s.OccurredAtWindow,
+	}
+}
+
+// serviceStatus provides the HTTP status, reason and cause the error of the feedback service is reported as. A broken
+// business rule is reported with its reason, anything else is a 500 with the fallback reason.
+func serviceStatus(err error, fallback string) (int, string, error) {
+	var ruleErr *feedback.Error
+	if errors.As(err, &ruleErr) {
+		if statusCode, ok := serviceStatuses[ruleErr.Kind]; ok {
+			return statusCode, ruleErr.Reason, nil
+		}
+	}
+	return http.StatusInternalServerError, fallback, err
+}
+
+// writeServiceError writes the error of the feedback service.
+func writeServiceError(err error, fallback string, w http.ResponseWriter) {
+	statusCode, reason, cause := serviceStatus(err, fallback)
+	writeHTTPError(statusCode, reason, cause, w)
+}
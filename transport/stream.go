@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	contentTypeEventStream = "text/event-stream"
+	headerCacheControl     = "Cache-Control"
+	headerLastEventID      = "Last-Event-ID"
+	// defaultHeartbeatInterval is how often an idle stream is written to when no interval is configured.
+	defaultHeartbeatInterval = 15 * time.Second
+)
+
+// StreamFeedback streams the feedback shown for a session as Server-Sent Events, feedback that is no longer shown is
+// not sent. Each event has the ID of the feedback, so a client reconnecting with the 'Last-Event-ID' header is sent the
+// feedback it missed, as long as it is still in the history of the broker. Idle streams get a heartbeat comment. The
+// stream ends when the client disconnects, falls too far behind or the server shuts down.
+func (s *HTTPServer) StreamFeedback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := mux.Vars(r)[pathSessionID]
+		var afterID int32
+		if value := r.Header.Get(headerLastEventID); len(value) > 0 {
+			id, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || id < 0 {
+				w.Header().Set(headerContentType, contentTypeJSON)
+				writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Header '%s' must be the ID of a feedback",
+					headerLastEventID), nil, w)
+				return
+			}
+			afterID = int32(id)
+		}
+		//
+		// A stream lasts longer than the server's write timeout
+		//
+		controller := http.NewResponseController(w)
+		if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Println(fmt.Errorf("failed to clear the write deadline of the stream: %w", err))
+		}
+		subscription, missed := s.Broker.Subscribe(sessionID, afterID)
+		defer s.Broker.Unsubscribe(subscription)
+		w.Header().Set(headerContentType, contentTypeEventStream)
+		w.Header().Set(headerCacheControl, "no-cache")
+		w.WriteHeader(http.StatusOK)
+		for _, feedback := range missed {
+			if !feedback.Visible() {
+				continue
+			}
+			if err := writeEvent(w, feedback); err != nil {
+				log.Println(fmt.Errorf("failed to stream feedback for session %s: %w", sessionID, err))
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			log.Println(fmt.Errorf("failed to flush the stream for session %s: %w", sessionID, err))
+			return
+		}
+		interval := s.HeartbeatInterval
+		if interval <= 0 {
+			interval = defaultHeartbeatInterval
+		}
+		heartbeat := time.NewTicker(interval)
+		defer heartbeat.Stop()
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case feedback, ok := <-subscription.Feedback():
+				if !ok {
+					return
+				} else if feedback.Visible() {
+					err = writeEvent(w, feedback)
+				}
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			}
+			if err == nil {
+				err = controller.Flush()
+			}
+			if err != nil {
+				log.Println(fmt.Errorf("failed to stream feedback for session %s: %w", sessionID, err))
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes the feedback as a Server-Sent Event with the ID of the feedback.
+func writeEvent(w http.ResponseWriter, feedback model.Feedback) error {
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: feedback\ndata: %s\n\n", feedback.ID, data)
+	return err
+}
@@ -0,0 +1,121 @@
+package transport_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPServer_StreamFeedback(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	server := httptest.NewServer(transport.NewRouter(transport.WithDB(mockDB{}),
+		transport.WithStream(broker, 50*time.Millisecond)))
+	defer server.Close()
+	//
+	// Resume after feedback 1, feedback 2 was missed
+	//
+	broker.Publish(model.Feedback{ID: 1, SessionID: "987", Comment: "First", Rating: 5,
+		ModerationStatus: model.ModerationApproved})
+	broker.Publish(model.Feedback{ID: 2, SessionID: "987", Comment: "Second", Rating: 4,
+		ModerationStatus: model.ModerationApproved})
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/sessions/987/stream", nil)
+	request.Header.Set("Last-Event-ID", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", response.StatusCode, http.StatusOK)
+	} else if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected an event stream but got %s", response.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(response.Body)
+	if event := readFeedbackEvent(t, events); event.id != "2" || event.feedback.Comment != "Second" {
+		t.Errorf("expected the missed feedback 2 but got %+v", event)
+	}
+	//
+	// Inserted feedback is streamed, with heartbeats while idle
+	//
+	body, _ := json.Marshal(map[string]interface{}{"comment": "Third", "rating": 3})
+	insert, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/sessions/987/feedback", bytes.NewReader(body))
+	insert.Header.Set("Ubi-UserId", "123")
+	inserted, err := http.DefaultClient.Do(insert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserted.Body.Close()
+	if event := readFeedbackEvent(t, events); event.id != "1" || event.feedback.Comment != "Third" {
+		t.Errorf("expected the inserted feedback but got %+v", event)
+	}
+	if event := readEvent(t, events); !event.heartbeat {
+		t.Errorf("expected a heartbeat but got %+v", event)
+	}
+	//
+	// Closing the broker, as the server does on shutdown, ends the stream
+	//
+	broker.Close()
+	for {
+		if _, err := events.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
+
+func TestHTTPServer_StreamFeedback_BadLastEventID(t *testing.T) {
+	handler := transport.NewRouter(transport.WithDB(mockDB{}), transport.WithStream(pubsub.NewBroker(10, 10), time.Second))
+	request := httptest.NewRequest(http.MethodGet, "/v1/sessions/987/stream", nil)
+	request.Header.Set("Last-Event-ID", "abc")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+type streamEvent struct {
+	id        string
+	feedback  model.Feedback
+	heartbeat bool
+}
+
+// readFeedbackEvent reads the next feedback event of the stream, skipping heartbeats.
+func readFeedbackEvent(t *testing.T, events *bufio.Reader) streamEvent {
+	for {
+		if event := readEvent(t, events); !event.heartbeat {
+			return event
+		}
+	}
+}
+
+// readEvent reads the next event, or heartbeat, of the stream.
+func readEvent(t *testing.T, events *bufio.Reader) streamEvent {
+	var event streamEvent
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case len(line) == 0:
+			return event
+		case strings.HasPrefix(line, ":"):
+			event.heartbeat = true
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.feedback); err != nil {
+				t.Fatalf("failed to decode the event: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSOptions are the options used to serve HTTPS.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is the minimum TLS version accepted, e.g. tls.VersionTLS12.
+	MinVersion uint16
+	// ClientCAFile is the CA used to verify client certificates. Required when ClientAuth verifies certificates.
+	ClientCAFile string
+	// ClientAuth is the policy for client certificates. Operator tools can authenticate with a client certificate while
+	// players connect without one when tls.VerifyClientCertIfGiven is used.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval is how often the certificate files are checked for changes. Zero disables reloading.
+	ReloadInterval time.Duration
+}
+
+// ParseTLSVersion parses a TLS version such as '1.2' or '1.3'.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version '%s'", version)
+	}
+}
+
+// ParseClientAuth parses the client certificate policy. 'none' does not request a certificate, 'optional' verifies a
+// certificate if one is provided and 'require' requires a verified certificate.
+func ParseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth '%s'", clientAuth)
+	}
+}
+
+// tlsConfig creates the TLS configuration of the server. HTTP/2 is negotiated when the client supports it.
+func (o TLSOptions) tlsConfig(reloader *certReloader) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     o.MinVersion,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		ClientAuth:     o.ClientAuth,
+	}
+	if o.ClientAuth == tls.VerifyClientCertIfGiven || o.ClientAuth == tls.RequireAndVerifyClientCert {
+		if len(o.ClientCAFile) == 0 {
+			return nil, errors.New("require a client CA file to verify client certificates")
+		}
+		pem, err := ioutil.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the client CA file %s", o.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
+
+// certReloader serves the certificate from the certificate files, reloading them when they change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile, stop: make(chan struct{})}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate provides the current certificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reload loads the certificate if either file changed since it was last loaded. Returns whether it was loaded.
+func (c *certReloader) reload() (bool, error) {
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := c.cert != nil && !modTime.After(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load the TLS certificate: %w", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mu.Unlock()
+	return true, nil
+}
+
+// watch checks for changes at the provided interval until stopped.
+func (c *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			//
+			// Keep serving the previous certificate if the new one is not valid, e.g. only one file was replaced so far
+			//
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Println(err)
+			} else if reloaded {
+				log.Printf("Reloaded the TLS certificate %s\n", c.certFile)
+			}
+		}
+	}
+}
+
+// Stop stops watching the files.
+func (c *certReloader) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to check the TLS file %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// redirectHandler redirects plaintext requests to the HTTPS port.
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
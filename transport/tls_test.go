@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, "first", certFile, keyFile)
+	//
+	// Load the initial certificate
+	//
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := certificateName(t, reloader); name != "first" {
+		t.Errorf("expected certificate 'first' but got '%s'", name)
+	}
+	//
+	// Unchanged files are not reloaded
+	//
+	if reloaded, err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	} else if reloaded {
+		t.Error("expected unchanged certificate to not be reloaded")
+	}
+	//
+	// Replace the certificate
+	//
+	writeCertificate(t, "second", certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	} else if !reloaded {
+		t.Error("expected changed certificate to be reloaded")
+	}
+	if name := certificateName(t, reloader); name != "second" {
+		t.Errorf("expected certificate 'second' but got '%s'", name)
+	}
+}
+
+func TestTLSOptions_TLSConfig_ClientCARequired(t *testing.T) {
+	options := TLSOptions{ClientAuth: tls.VerifyClientCertIfGiven}
+	if _, err := options.tlsConfig(&certReloader{}); err == nil {
+		t.Error("expected missing client CA file to fail")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	redirectHandler("8443").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://example.com:8080/987?rating=5", nil))
+	if status := recorder.Code; status != http.StatusPermanentRedirect {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusPermanentRedirect)
+	}
+	expected := "https://example.com:8443/987?rating=5"
+	if location := recorder.Header().Get("Location"); location != expected {
+		t.Errorf("handler returned unexpected location: got %v want %v", location, expected)
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	if clientAuth, err := ParseClientAuth("optional"); err != nil || clientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("expected 'optional' to verify certificates if given but got %v, %v", clientAuth, err)
+	}
+	if _, err := ParseClientAuth("sometimes"); err == nil {
+		t.Error("expected unknown client auth to fail")
+	}
+}
+
+func certificateName(t *testing.T, reloader *certReloader) string {
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func writeCertificate(t *testing.T, name string, certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
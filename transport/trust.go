@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	// defaultOperator is the name of the operators authenticated with a token that is not named.
+	defaultOperator = "operator"
+)
+
+// trusted checks whether the request is authenticated with one of the trusted tokens.
+func (s *HTTPServer) trusted(r *http.Request) bool {
+	_, ok := authenticated(r, s.TrustedTokens, false)
+	return ok
+}
+
+// operator provides the name of the operator the request is authenticated as. Operator tokens are named by prefixing
+// them with the name, 'name:token', so the changes an operator makes can be attributed to them.
+func (s *HTTPServer) operator(r *http.Request) (string, bool) {
+	return authenticated(r, s.OperatorTokens, true)
+}
+
+// authenticated checks whether the bearer token of the request is one of the tokens and provides the name of the
+// matching token when the tokens are named. Every token is compared so the time taken does not reveal which one
+// matched.
+func authenticated(r *http.Request, tokens []string, named bool) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get(headerAuthorization), "Bearer ")
+	if !ok || len(token) == 0 {
+		return "", false
+	}
+	name := ""
+	matched := false
+	for _, t := range tokens {
+		tokenName := defaultOperator
+		if named {
+			if n, secret, ok := strings.Cut(t, ":"); ok {
+				tokenName, t = n, secret
+			}
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			name = tokenName
+			matched = true
+		}
+	}
+	return name, matched
+}
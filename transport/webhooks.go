@@ -0,0 +1,383 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	deliveriesLimit    = 100
+	maxDeliveriesLimit = 1000
+	// maxSecretLength is how long the secret of a webhook can be.
+	maxSecretLength = 255
+	// maxWebhookURLLength is how long the URL of a webhook can be.
+	maxWebhookURLLength = 2048
+	pathDeliveryID      = "deliveryID"
+	// secretBytes is how many random bytes a generated secret has.
+	secretBytes = 32
+)
+
+// deliveryStatuses are the statuses the deliveries of a webhook can be filtered by.
+var deliveryStatuses = map[db.DeliveryStatus]bool{
+	db.DeliveryPending:   true,
+	db.DeliveryDelivered: true,
+	db.DeliveryDead:      true,
+}
+
+// webhookRequest is a webhook to create. The ratings default to every rating and a secret is generated when none is
+// provided.
+type webhookRequest struct {
+	URL       string               `json:"url"`
+	Events    []model.WebhookEvent `json:"events"`
+	MinRating int8                 `json:"minRating"`
+	MaxRating int8                 `json:"maxRating"`
+	Secret    string               `json:"secret"`
+}
+
+// WebhookDeliveriesResponse is a page of the deliveries of a webhook. Next is the 'after' query param of the next
+// page, omitted on the last page.
+type WebhookDeliveriesResponse struct {
+	Deliveries []db.WebhookDelivery `json:"deliveries"`
+	Next       int64                `json:"next,omitempty"`
+}
+
+// WebhookAttemptsResponse is a page of the delivery log of a webhook. Next is the 'after' query param of the next page,
+// omitted on the last page.
+type WebhookAttemptsResponse struct {
+	Attempts []db.WebhookAttempt `json:"attempts"`
+	Next     int64               `json:"next,omitempty"`
+}
+
+// webhookStore provides the DB as a WebhookStore. A 501 is written and false is returned if the DB cannot store
+// webhooks.
+func (s *HTTPServer) webhookStore(w http.ResponseWriter) (db.WebhookStore, bool) {
+	store, ok := s.DB.(db.WebhookStore)
+	if !ok {
+		writeHTTPError(http.StatusNotImplemented, "Webhooks are not supported", nil, w)
+	}
+	return store, ok
+}
+
+// CreateWebhook subscribes a URL to the events of feedback with a rating within a range. The secret deliveries are
+// signed with is only returned when the webhook is created.
+func (s *HTTPServer) CreateWebhook() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		defer closeRequestBody(r.Body)
+		var request webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeHTTPError(http.StatusBadRequest, "Failed to decode the webhook", err, w)
+			return
+		}
+		webhook, reason := newWebhook(request)
+		if len(reason) > 0 {
+			writeHTTPError(http.StatusBadRequest, reason, nil, w)
+			return
+		}
+		if len(webhook.Secret) == 0 {
+			secret := make([]byte, secretBytes)
+			if _, err := rand.Read(secret); err != nil {
+				writeHTTPError(http.StatusInternalServerError, "Failed to generate the webhook secret", err, w)
+				return
+			}
+			webhook.Secret = hex.EncodeToString(secret)
+		}
+		webhook, err := store.InsertWebhook(webhook)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError, "Failed to create the webhook", err, w)
+			return
+		}
+		log.Printf("Operator %s created webhook %d for %s\n", actor(r), webhook.ID, webhook.URL)
+		w.Header().Set(headerLocation, fmt.Sprintf("%s%s/webhooks/%d", s.Prefix, pathV1, webhook.ID))
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(webhook); err != nil {
+			log.Println(fmt.Errorf("failed to write webhook %d: %w", webhook.ID, err))
+		}
+	}
+}
+
+// newWebhook validates the request and provides the webhook to create. The reason is returned when it is not valid.
+func newWebhook(request webhookRequest) (model.Webhook, string) {
+	webhookURL, err := url.Parse(strings.TrimSpace(request.URL))
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || len(webhookURL.Host) == 0 {
+		return model.Webhook{}, "URL must be an absolute HTTP or HTTPS URL"
+	} else if len(webhookURL.String()) > maxWebhookURLLength {
+		return model.Webhook{}, fmt.Sprintf("URL is longer than %d characters", maxWebhookURLLength)
+	}
+	if len(request.Events) == 0 {
+		return model.Webhook{}, "At least one event is required"
+	}
+	webhook := model.Webhook{
+		URL:       webhookURL.String(),
+		MinRating: request.MinRating,
+		MaxRating: request.MaxRating,
+		Secret:    request.Secret,
+		Date:      time.Now(),
+	}
+	subscribed := make(map[model.WebhookEvent]bool)
+	for _, event := range request.Events {
+		if !model.ValidWebhookEvent(event) {
+			events := make([]string, len(model.WebhookEvents))
+			for i, e := range model.WebhookEvents {
+				events[i] = string(e)
+			}
+			return model.Webhook{}, fmt.Sprintf("Events must be one of '%s'", strings.Join(events, "', '"))
+		} else if !subscribed[event] {
+			subscribed[event] = true
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	if webhook.MinRating == 0 {
+		webhook.MinRating = model.MinRating
+	}
+	if webhook.MaxRating == 0 {
+		webhook.MaxRating = model.MaxRating
+	}
+	if !model.ValidRating(webhook.MinRating) || !model.ValidRating(webhook.MaxRating) ||
+		webhook.MinRating > webhook.MaxRating {
+		return model.Webhook{}, fmt.Sprintf("Ratings must be a range between %d and %d", model.MinRating,
+			model.MaxRating)
+	}
+	if len(webhook.Secret) > maxSecretLength {
+		return model.Webhook{}, fmt.Sprintf("Secret is longer than %d characters", maxSecretLength)
+	}
+	return webhook, ""
+}
+
+// RetrieveWebhooks retrieves every webhook, without their secrets.
+func (s *HTTPServer) RetrieveWebhooks() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		webhooks, err := store.FindWebhooks()
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError, "Failed to retrieve the webhooks", err, w)
+			return
+		}
+		if webhooks == nil {
+			webhooks = []model.Webhook{}
+		}
+		if err := json.NewEncoder(w).Encode(webhooks); err != nil {
+			log.Println(fmt.Errorf("failed to write the webhooks: %w", err))
+		}
+	}
+}
+
+// RetrieveWebhook retrieves a single webhook, without its secret. If the webhook does not exist, a 404 is returned.
+func (s *HTTPServer) RetrieveWebhook() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		webhook, ok := findWebhook(store, r, w)
+		if !ok {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(webhook); err != nil {
+			log.Println(fmt.Errorf("failed to write webhook %d: %w", webhook.ID, err))
+		}
+	}
+}
+
+// DeleteWebhook deletes a webhook along with its pending deliveries and delivery log. If the webhook does not exist, a
+// 404 is returned.
+func (s *HTTPServer) DeleteWebhook() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 64)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Webhook %s does not exist", mux.Vars(r)[pathID]), nil, w)
+			return
+		}
+		if err := store.DeleteWebhook(id); errors.Is(err, db.ErrWebhookNotFound) {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Webhook %d does not exist", id), nil, w)
+			return
+		} else if err != nil {
+			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to delete webhook %d", id), err, w)
+			return
+		}
+		log.Printf("Operator %s deleted webhook %d\n", actor(r), id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RetrieveWebhookDeliveries retrieves the deliveries of a webhook, oldest first, optionally with a status, e.g. the
+// dead-lettered deliveries. Pages are retrieved by passing the 'next' of a page as the 'after' query param.
+func (s *HTTPServer) RetrieveWebhookDeliveries() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		limit, ok := queryInt(r, queryLimit, deliveriesLimit, maxDeliveriesLimit, w)
+		if !ok {
+			return
+		}
+		afterID, ok := queryAfterID(r, w)
+		if !ok {
+			return
+		}
+		status := db.DeliveryStatus(r.URL.Query().Get(queryStatus))
+		if len(status) > 0 && !deliveryStatuses[status] {
+			writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Query param '%s' must be one of '%s', '%s' or '%s'",
+				queryStatus, db.DeliveryPending, db.DeliveryDelivered, db.DeliveryDead), nil, w)
+			return
+		}
+		webhook, ok := findWebhook(store, r, w)
+		if !ok {
+			return
+		}
+		deliveries, err := store.FindWebhookDeliveries(webhook.ID, status, afterID, limit)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to retrieve the deliveries of webhook %d", webhook.ID), err, w)
+			return
+		}
+		response := WebhookDeliveriesResponse{Deliveries: deliveries}
+		if response.Deliveries == nil {
+			response.Deliveries = []db.WebhookDelivery{}
+		} else if len(deliveries) == limit {
+			response.Next = deliveries[len(deliveries)-1].ID
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Println(fmt.Errorf("failed to write the deliveries of webhook %d: %w", webhook.ID, err))
+		}
+	}
+}
+
+// RetryWebhookDelivery queues a dead-lettered delivery to be attempted again, with its attempts reset. If the delivery
+// does not exist, a 404 is returned, and if it is not dead, a 409 is returned.
+func (s *HTTPServer) RetryWebhookDelivery() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		webhookID, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 64)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Webhook %s does not exist", mux.Vars(r)[pathID]), nil, w)
+			return
+		}
+		deliveryID, err := strconv.ParseInt(mux.Vars(r)[pathDeliveryID], 10, 64)
+		if err != nil {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Delivery %s does not exist for webhook %d",
+				mux.Vars(r)[pathDeliveryID], webhookID), nil, w)
+			return
+		}
+		err = store.RetryWebhookDelivery(webhookID, deliveryID)
+		if errors.Is(err, db.ErrWebhookNotFound) {
+			writeHTTPError(http.StatusNotFound, fmt.Sprintf("Delivery %d does not exist for webhook %d", deliveryID,
+				webhookID), nil, w)
+			return
+		} else if errors.Is(err, db.ErrDeliveryNotDead) {
+			writeHTTPError(http.StatusConflict, fmt.Sprintf("Delivery %d is not dead", deliveryID), nil, w)
+			return
+		} else if err != nil {
+			writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to retry delivery %d", deliveryID), err,
+				w)
+			return
+		}
+		log.Printf("Operator %s retried delivery %d of webhook %d\n", actor(r), deliveryID, webhookID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RetrieveWebhookAttempts retrieves the delivery log of a webhook, oldest first. Pages are retrieved by passing the
+// 'next' of a page as the 'after' query param.
+func (s *HTTPServer) RetrieveWebhookAttempts() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		store, ok := s.webhookStore(w)
+		if !ok {
+			return
+		}
+		limit, ok := queryInt(r, queryLimit, deliveriesLimit, maxDeliveriesLimit, w)
+		if !ok {
+			return
+		}
+		afterID, ok := queryAfterID(r, w)
+		if !ok {
+			return
+		}
+		webhook, ok := findWebhook(store, r, w)
+		if !ok {
+			return
+		}
+		attempts, err := store.FindWebhookAttempts(webhook.ID, afterID, limit)
+		if err != nil {
+			writeHTTPError(http.StatusInternalServerError,
+				fmt.Sprintf("Failed to retrieve the delivery log of webhook %d", webhook.ID), err, w)
+			return
+		}
+		response := WebhookAttemptsResponse{Attempts: attempts}
+		if response.Attempts == nil {
+			response.Attempts = []db.WebhookAttempt{}
+		} else if len(attempts) == limit {
+			response.Next = attempts[len(attempts)-1].ID
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Println(fmt.Errorf("failed to write the delivery log of webhook %d: %w", webhook.ID, err))
+		}
+	}
+}
+
+// findWebhook finds the webhook of the path. The error is written and false is returned if it cannot be found.
+func findWebhook(store db.WebhookStore, r *http.Request, w http.ResponseWriter) (model.Webhook, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[pathID], 10, 64)
+	if err != nil {
+		writeHTTPError(http.StatusNotFound, fmt.Sprintf("Webhook %s does not exist", mux.Vars(r)[pathID]), nil, w)
+		return model.Webhook{}, false
+	}
+	webhook, err := store.FindWebhookByID(id)
+	if errors.Is(err, db.ErrWebhookNotFound) {
+		writeHTTPError(http.StatusNotFound, fmt.Sprintf("Webhook %d does not exist", id), nil, w)
+		return model.Webhook{}, false
+	} else if err != nil {
+		writeHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve webhook %d", id), err, w)
+		return model.Webhook{}, false
+	}
+	return webhook, true
+}
+
+// queryAfterID provides the 'after' query param of a page, 0 when it is not provided. The error is written and false
+// is returned if it is not valid.
+func queryAfterID(r *http.Request, w http.ResponseWriter) (int64, bool) {
+	value := r.URL.Query().Get(queryAfter)
+	if len(value) == 0 {
+		return 0, true
+	}
+	afterID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || afterID < 0 {
+		writeHTTPError(http.StatusBadRequest, fmt.Sprintf("Query param '%s' must be the 'next' of a page", queryAfter),
+			nil, w)
+		return 0, false
+	}
+	return afterID, true
+}
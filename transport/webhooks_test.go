@@ -0,0 +1,207 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/transport"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookDB is a mockDB that stores webhooks in memory.
+type webhookDB struct {
+	mockDB
+	webhooks   map[int64]model.Webhook
+	deliveries []db.WebhookDelivery
+	attempts   []db.WebhookAttempt
+}
+
+func (m *webhookDB) InsertWebhook(webhook model.Webhook) (model.Webhook, error) {
+	webhook.ID = int64(len(m.webhooks) + 1)
+	m.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (m *webhookDB) FindWebhooks() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	for _, webhook := range m.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (m *webhookDB) FindWebhookByID(id int64) (model.Webhook, error) {
+	webhook, ok := m.webhooks[id]
+	if !ok {
+		return model.Webhook{}, db.ErrWebhookNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (m *webhookDB) DeleteWebhook(id int64) error {
+	if _, ok := m.webhooks[id]; !ok {
+		return db.ErrWebhookNotFound
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *webhookDB) FindWebhookDeliveries(webhookID int64, status db.DeliveryStatus, afterID int64,
+	limit int) ([]db.WebhookDelivery, error) {
+	var deliveries []db.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookID == webhookID && delivery.ID > afterID && (len(status) == 0 || delivery.Status == status) &&
+			len(deliveries) < limit {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *webhookDB) RetryWebhookDelivery(webhookID int64, deliveryID int64) error {
+	for i, delivery := range m.deliveries {
+		if delivery.WebhookID != webhookID || delivery.ID != deliveryID {
+			continue
+		} else if delivery.Status != db.DeliveryDead {
+			return db.ErrDeliveryNotDead
+		}
+		m.deliveries[i].Status = db.DeliveryPending
+		m.deliveries[i].Attempts = 0
+		return nil
+	}
+	return db.ErrWebhookNotFound
+}
+
+func (m *webhookDB) FindWebhookAttempts(webhookID int64, afterID int64, limit int) ([]db.WebhookAttempt, error) {
+	var attempts []db.WebhookAttempt
+	for _, attempt := range m.attempts {
+		if attempt.WebhookID == webhookID && attempt.ID > afterID && len(attempts) < limit {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+func (m *webhookDB) ClaimWebhookDeliveries(now time.Time, lease time.Duration,
+	limit int) ([]db.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *webhookDB) RecordWebhookAttempt(delivery db.WebhookDelivery, attempt db.WebhookAttempt) error {
+	return nil
+}
+
+func TestHTTPServer_CreateWebhook(t *testing.T) {
+	tests := []struct {
+		name              string
+		body              map[string]interface{}
+		expectedCode      int
+		expectedMinRating int8
+		expectedMaxRating int8
+	}{
+		{name: "Defaults", body: map[string]interface{}{"url": "https://example.com/hook", "events": []string{"feedback.created"}}, expectedCode: http.StatusCreated, expectedMinRating: 1, expectedMaxRating: 5},
+		{name: "Ratings", body: map[string]interface{}{"url": "https://example.com/hook", "events": []string{"feedback.created"}, "minRating": 1, "maxRating": 2}, expectedCode: http.StatusCreated, expectedMinRating: 1, expectedMaxRating: 2},
+		{name: "Relative URL", body: map[string]interface{}{"url": "/hook", "events": []string{"feedback.created"}}, expectedCode: http.StatusBadRequest},
+		{name: "Other Scheme", body: map[string]interface{}{"url": "ftp://example.com/hook", "events": []string{"feedback.created"}}, expectedCode: http.StatusBadRequest},
+		{name: "No Events", body: map[string]interface{}{"url": "https://example.com/hook"}, expectedCode: http.StatusBadRequest},
+		{name: "Unknown Event", body: map[string]interface{}{"url": "https://example.com/hook", "events": []string{"feedback.read"}}, expectedCode: http.StatusBadRequest},
+		{name: "Inverted Ratings", body: map[string]interface{}{"url": "https://example.com/hook", "events": []string{"feedback.created"}, "minRating": 4, "maxRating": 2}, expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := transport.NewRouter(transport.WithDB(&webhookDB{webhooks: make(map[int64]model.Webhook)}),
+				transport.WithOperatorTokens("secret"))
+			body, _ := json.Marshal(test.body)
+			request := httptest.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewReader(body))
+			request.Header.Set("Authorization", "Bearer secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if test.expectedCode != http.StatusCreated {
+				return
+			}
+			var webhook model.Webhook
+			if err := json.NewDecoder(recorder.Body).Decode(&webhook); err != nil {
+				t.Fatalf("failed to decode the webhook: %v", err)
+			}
+			if recorder.Header().Get("Location") != "/v1/webhooks/1" {
+				t.Errorf("unexpected location %s", recorder.Header().Get("Location"))
+			} else if len(webhook.Secret) != 64 {
+				t.Errorf("expected a generated secret but got '%s'", webhook.Secret)
+			} else if webhook.MinRating != test.expectedMinRating || webhook.MaxRating != test.expectedMaxRating {
+				t.Errorf("expected ratings %d to %d but got %d to %d", test.expectedMinRating, test.expectedMaxRating,
+					webhook.MinRating, webhook.MaxRating)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Webhooks(t *testing.T) {
+	store := &webhookDB{
+		webhooks: map[int64]model.Webhook{
+			1: {ID: 1, URL: "https://example.com/hook", Events: []model.WebhookEvent{model.EventCreated}, Secret: "s"},
+		},
+		deliveries: []db.WebhookDelivery{
+			{ID: 1, WebhookID: 1, Status: db.DeliveryDelivered, Payload: []byte("{}")},
+			{ID: 2, WebhookID: 1, Status: db.DeliveryDead, Payload: []byte("{}")},
+			{ID: 3, WebhookID: 1, Status: db.DeliveryDead, Payload: []byte("{}")},
+		},
+		attempts: []db.WebhookAttempt{{ID: 1, DeliveryID: 1, WebhookID: 1, Attempt: 1, StatusCode: 200}},
+	}
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		{name: "List", method: http.MethodGet, path: "/v1/webhooks", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedBody: `[{"id":1,"url":"https://example.com/hook","events":["feedback.created"],"minRating":0,"maxRating":0,"date":"0001-01-01T00:00:00Z"}]`},
+		{name: "Get", method: http.MethodGet, path: "/v1/webhooks/1", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedBody: `{"id":1,"url":"https://example.com/hook","events":["feedback.created"],"minRating":0,"maxRating":0,"date":"0001-01-01T00:00:00Z"}`},
+		{name: "Get Missing", method: http.MethodGet, path: "/v1/webhooks/2", authorization: "Bearer secret", expectedCode: http.StatusNotFound},
+		{name: "Dead Deliveries", method: http.MethodGet, path: "/v1/webhooks/1/deliveries?status=dead&limit=1", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedBody: `{"deliveries":[{"id":2,"webhookId":1,"event":"","payload":{},"status":"dead","attempts":0,"nextAttempt":"0001-01-01T00:00:00Z","date":"0001-01-01T00:00:00Z"}],"next":2}`},
+		{name: "Unknown Status", method: http.MethodGet, path: "/v1/webhooks/1/deliveries?status=lost", authorization: "Bearer secret", expectedCode: http.StatusBadRequest},
+		{name: "Deliveries Of Missing", method: http.MethodGet, path: "/v1/webhooks/2/deliveries", authorization: "Bearer secret", expectedCode: http.StatusNotFound},
+		{name: "Attempts", method: http.MethodGet, path: "/v1/webhooks/1/attempts", authorization: "Bearer secret", expectedCode: http.StatusOK, expectedBody: `{"attempts":[{"id":1,"deliveryId":1,"webhookId":1,"attempt":1,"statusCode":200,"durationMs":0,"date":"0001-01-01T00:00:00Z"}]}`},
+		{name: "Retry", method: http.MethodPost, path: "/v1/webhooks/1/deliveries/3/retry", authorization: "Bearer secret", expectedCode: http.StatusNoContent},
+		{name: "Retry Delivered", method: http.MethodPost, path: "/v1/webhooks/1/deliveries/1/retry", authorization: "Bearer secret", expectedCode: http.StatusConflict},
+		{name: "Retry Missing", method: http.MethodPost, path: "/v1/webhooks/1/deliveries/9/retry", authorization: "Bearer secret", expectedCode: http.StatusNotFound},
+		{name: "Missing Token", method: http.MethodGet, path: "/v1/webhooks", expectedCode: http.StatusUnauthorized},
+		{name: "Delete", method: http.MethodDelete, path: "/v1/webhooks/1", authorization: "Bearer secret", expectedCode: http.StatusNoContent},
+		{name: "Delete Missing", method: http.MethodDelete, path: "/v1/webhooks/1", authorization: "Bearer secret", expectedCode: http.StatusNotFound},
+	}
+	handler := transport.NewRouter(transport.WithDB(store), transport.WithOperatorTokens("secret"))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, nil)
+			if len(test.authorization) > 0 {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, test.expectedCode)
+			} else if len(test.expectedBody) > 0 && recorder.Body.String() != test.expectedBody+"\n" {
+				t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), test.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Webhooks_NotSupported(t *testing.T) {
+	handler := transport.NewRouter(transport.WithDB(mockDB{}), transport.WithOperatorTokens("secret"))
+	request := httptest.NewRequest(http.MethodGet, "/v1/webhooks", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotImplemented {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusNotImplemented)
+	}
+}
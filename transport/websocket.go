@@ -0,0 +1,280 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxSubscriptions is how many sessions a connection can subscribe to when no limit is configured.
+	defaultMaxSubscriptions = 100
+	// wsReadLimit is the largest message, in bytes, a client can send.
+	wsReadLimit = 4096
+	// wsWriteTimeout is how long writing a message to a client can take before the connection is closed.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// The types of the messages sent over a WebSocket connection.
+const (
+	wsSubscribe    = "subscribe"
+	wsUnsubscribe  = "unsubscribe"
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsFeedback     = "feedback"
+	wsRemoved      = "removed"
+	wsError        = "error"
+)
+
+// WebSocketRequest is a message a client sends to subscribe to, or unsubscribe from, a session.
+type WebSocketRequest struct {
+	Type      string `json:"type"`
+	SessionID string `json:"sessionId"`
+}
+
+// WebSocketMessage is a message sent to a client. Feedback is only set for feedback and removed messages, and the
+// delta is how the feedback changed the aggregate of its session.
+type WebSocketMessage struct {
+	Type      string          `json:"type"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Feedback  *model.Feedback `json:"feedback,omitempty"`
+	Aggregate *Aggregate      `json:"aggregate,omitempty"`
+	Delta     *Aggregate      `json:"delta,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Aggregate is the count and average rating of the approved feedback of a session.
+type Aggregate struct {
+	Count   int64   `json:"count"`
+	Average float64 `json:"average"`
+}
+
+func newAggregate(summary db.Summary) *Aggregate {
+	return &Aggregate{Count: summary.Count, Average: summary.Average()}
+}
+
+// WebSocketFeed feeds the feedback inserted for the sessions a client subscribes to over a WebSocket connection, along
+// with the running aggregate of each session, and the feedback that is no longer shown. Aggregates are read from the DB
+// on subscribe, updated in memory as feedback is inserted and read again when shown feedback changes. Subscribing to
+// more sessions than allowed is answered with an error. The connection is closed when the client disconnects, stops
+// answering pings, falls too far behind or the server shuts down.
+func (s *HTTPServer) WebSocketFeed() func(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			//
+			// The upgrader has already responded with the failure
+			//
+			log.Println(fmt.Errorf("failed to upgrade to a WebSocket connection: %w", err))
+			return
+		}
+		defer conn.Close()
+		interval := s.HeartbeatInterval
+		if interval <= 0 {
+			interval = defaultHeartbeatInterval
+		}
+		subscription := s.Broker.Open()
+		defer s.Broker.Unsubscribe(subscription)
+		stop := make(chan struct{})
+		defer close(stop)
+		requests := readRequests(conn, 2*interval, stop)
+		ping := time.NewTicker(interval)
+		defer ping.Stop()
+		feed := &webSocketFeed{server: s, subscription: subscription, aggregates: make(map[string]*db.Summary)}
+		for {
+			var err error
+			select {
+			case request, ok := <-requests:
+				if !ok {
+					return
+				}
+				err = writeMessage(conn, feed.handle(request))
+			case feedback, ok := <-subscription.Feedback():
+				if !ok {
+					//
+					// Either the client fell too far behind or the server is shutting down, the client can reconnect
+					// and resubscribe in both cases
+					//
+					message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscription ended")
+					deadline := time.Now().Add(wsWriteTimeout)
+					if err := conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+						log.Println(fmt.Errorf("failed to close the WebSocket connection: %w", err))
+					}
+					return
+				}
+				if message, ok := feed.update(feedback); ok {
+					err = writeMessage(conn, message)
+				}
+			case <-ping.C:
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			}
+			if err != nil {
+				log.Println(fmt.Errorf("failed to write to the WebSocket connection: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// webSocketFeed is the state of a single WebSocket connection.
+type webSocketFeed struct {
+	server       *HTTPServer
+	subscription *pubsub.Subscription
+	// aggregates are the summaries of the sessions subscribed to.
+	aggregates map[string]*db.Summary
+}
+
+// handle handles a request of the client, returning the message to respond with.
+func (f *webSocketFeed) handle(request WebSocketRequest) WebSocketMessage {
+	if len(request.SessionID) == 0 && (request.Type == wsSubscribe || request.Type == wsUnsubscribe) {
+		return WebSocketMessage{Type: wsError, Error: "Field 'sessionId' is required"}
+	}
+	switch request.Type {
+	case wsSubscribe:
+		if summary, ok := f.aggregates[request.SessionID]; ok {
+			return WebSocketMessage{Type: wsSubscribed, SessionID: request.SessionID, Aggregate: newAggregate(*summary)}
+		}
+		max := f.server.MaxSubscriptions
+		if max <= 0 {
+			max = defaultMaxSubscriptions
+		}
+		if len(f.aggregates) >= max {
+			return WebSocketMessage{Type: wsError, SessionID: request.SessionID,
+				Error: fmt.Sprintf("Cannot subscribe to more than %d sessions", max)}
+		}
+		//
+		// Follow the session before summarizing it so no feedback is missed. Feedback already summarized is skipped
+		// when it is received
+		//
+		if !f.server.Broker.Follow(f.subscription, request.SessionID) {
+			return WebSocketMessage{Type: wsError, SessionID: request.SessionID, Error: "Subscription ended"}
+		}
+		summary, err := f.server.DB.Summarize(request.SessionID)
+		if err != nil {
+			f.server.Broker.Unfollow(f.subscription, request.SessionID)
+			log.Println(err)
+			return WebSocketMessage{Type: wsError, SessionID: request.SessionID,
+				Error: "Failed to summarize the feedback of the session"}
+		}
+		f.aggregates[request.SessionID] = &summary
+		return WebSocketMessage{Type: wsSubscribed, SessionID: request.SessionID, Aggregate: newAggregate(summary)}
+	case wsUnsubscribe:
+		f.server.Broker.Unfollow(f.subscription, request.SessionID)
+		delete(f.aggregates, request.SessionID)
+		return WebSocketMessage{Type: wsUnsubscribed, SessionID: request.SessionID}
+	default:
+		return WebSocketMessage{Type: wsError, SessionID: request.SessionID,
+			Error: fmt.Sprintf("Message type must be '%s' or '%s'", wsSubscribe, wsUnsubscribe)}
+	}
+}
+
+// update adds the feedback to the aggregate of its session, returning the message to send. False is returned when the
+// session is no longer subscribed to or the aggregate did not change. Feedback changed since it was inserted, approved
+// after review, hidden or deleted, may already be part of the aggregate, so the session is summarized again instead.
+func (f *webSocketFeed) update(feedback model.Feedback) (WebSocketMessage, bool) {
+	summary, ok := f.aggregates[feedback.SessionID]
+	if !ok {
+		return WebSocketMessage{}, false
+	}
+	before := *summary
+	if feedback.Version > 1 {
+		current, err := f.server.DB.Summarize(feedback.SessionID)
+		if err != nil {
+			log.Println(fmt.Errorf("failed to summarize the feedback of session %s: %w", feedback.SessionID, err))
+			return WebSocketMessage{}, false
+		}
+		*summary = current
+	} else if feedback.ID > summary.LastID {
+		summary.Count++
+		summary.RatingSum += int64(feedback.Rating)
+		summary.LastID = feedback.ID
+	}
+	if summary.Count == before.Count && summary.RatingSum == before.RatingSum {
+		return WebSocketMessage{}, false
+	}
+	messageType := wsFeedback
+	if !feedback.Visible() {
+		messageType = wsRemoved
+	}
+	aggregate := newAggregate(*summary)
+	return WebSocketMessage{
+		Type:      messageType,
+		SessionID: feedback.SessionID,
+		Feedback:  &feedback,
+		Aggregate: aggregate,
+		Delta:     &Aggregate{Count: summary.Count - before.Count, Average: aggregate.Average - before.Average()},
+	}, true
+}
+
+// readRequests reads the requests of the client until the connection fails or is stopped, at which point the returned
+// channel is closed. Malformed requests are passed on with an empty type so the client is told about them. The
+// client must answer a ping within the timeout.
+func readRequests(conn *websocket.Conn, timeout time.Duration, stop <-chan struct{}) <-chan WebSocketRequest {
+	requests := make(chan WebSocketRequest)
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+	go func() {
+		defer close(requests)
+		for {
+			if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				return
+			}
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				select {
+				case <-stop:
+				default:
+					if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway,
+						websocket.CloseAbnormalClosure) &&
+						!errors.Is(err, websocket.ErrCloseSent) {
+						log.Println(fmt.Errorf("failed to read from the WebSocket connection: %w", err))
+					}
+				}
+				return
+			}
+			var request WebSocketRequest
+			if err := json.Unmarshal(data, &request); err != nil {
+				request = WebSocketRequest{}
+			}
+			select {
+			case requests <- request:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return requests
+}
+
+// writeMessage writes the message as JSON, failing if the client does not read it within the write timeout.
+func writeMessage(conn *websocket.Conn, message WebSocketMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(message)
+}
+
+// checkOrigin allows the WebSocket connections from the same origin as the server, and from the origins allowed by
+// CORS. Clients that are not browsers do not send an origin and are always allowed.
+func (s *HTTPServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get(headerOrigin)
+	if len(origin) == 0 {
+		return true
+	}
+	if originURL, err := url.Parse(origin); err == nil && strings.EqualFold(originURL.Host, r.Host) {
+		return true
+	}
+	return s.CORS != nil && s.CORS.allowed(origin)
+}
@@ -0,0 +1,237 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/model"
+	"github.com/Piszmog/feedback-service/pubsub"
+	"github.com/Piszmog/feedback-service/transport"
+	"github.com/gorilla/websocket"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPServer_WebSocketFeed(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	server := httptest.NewServer(transport.NewRouter(transport.WithDB(mockDB{feedbacks: []model.Feedback{
+		{ID: 1, SessionID: "987", Rating: 4, ModerationStatus: model.ModerationApproved},
+		{ID: 2, SessionID: "987", Rating: 2, ModerationStatus: model.ModerationApproved},
+	}}), transport.WithStream(broker, time.Second), transport.WithMaxSubscriptions(2)))
+	defer server.Close()
+	conn := dialFeed(t, server)
+	defer conn.Close()
+	//
+	// Subscribing provides the aggregate of the session
+	//
+	message := sendRequest(t, conn, transport.WebSocketRequest{Type: "subscribe", SessionID: "987"})
+	if message.Type != "subscribed" || message.Aggregate == nil || message.Aggregate.Count != 2 ||
+		message.Aggregate.Average != 3 {
+		t.Errorf("expected the aggregate of the session but got %+v", message)
+	}
+	message = sendRequest(t, conn, transport.WebSocketRequest{Type: "subscribe", SessionID: "654"})
+	if message.Type != "subscribed" || message.Aggregate.Count != 0 {
+		t.Errorf("expected an empty aggregate but got %+v", message)
+	}
+	message = sendRequest(t, conn, transport.WebSocketRequest{Type: "subscribe", SessionID: "321"})
+	if message.Type != "error" || message.SessionID != "321" {
+		t.Errorf("expected too many subscriptions but got %+v", message)
+	}
+	//
+	// Feedback already part of the aggregate is skipped and inserted feedback updates the aggregate
+	//
+	broker.Publish(model.Feedback{ID: 2, SessionID: "987", Rating: 2, ModerationStatus: model.ModerationApproved})
+	body, _ := json.Marshal(map[string]interface{}{"comment": "Third", "rating": 5})
+	insert, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/sessions/654/feedback", bytes.NewReader(body))
+	insert.Header.Set("Ubi-UserId", "123")
+	inserted, err := http.DefaultClient.Do(insert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserted.Body.Close()
+	message = readMessage(t, conn)
+	if message.Type != "feedback" || message.SessionID != "654" || message.Feedback == nil ||
+		message.Feedback.Comment != "Third" {
+		t.Fatalf("expected the inserted feedback but got %+v", message)
+	} else if message.Aggregate.Count != 1 || message.Aggregate.Average != 5 || message.Delta.Count != 1 ||
+		message.Delta.Average != 5 {
+		t.Errorf("unexpected aggregate %+v and delta %+v", message.Aggregate, message.Delta)
+	}
+	broker.Publish(model.Feedback{ID: 3, SessionID: "987", Rating: 5, ModerationStatus: model.ModerationApproved})
+	message = readMessage(t, conn)
+	if message.SessionID != "987" || message.Aggregate.Count != 3 ||
+		math.Abs(message.Aggregate.Average-11.0/3) > 1e-9 || math.Abs(message.Delta.Average-2.0/3) > 1e-9 {
+		t.Errorf("unexpected aggregate %+v and delta %+v", message.Aggregate, message.Delta)
+	}
+	//
+	// Unsubscribed sessions are no longer fed
+	//
+	message = sendRequest(t, conn, transport.WebSocketRequest{Type: "unsubscribe", SessionID: "987"})
+	if message.Type != "unsubscribed" {
+		t.Errorf("expected to unsubscribe but got %+v", message)
+	}
+	broker.Publish(model.Feedback{ID: 4, SessionID: "987", Rating: 1, ModerationStatus: model.ModerationApproved})
+	message = sendRequest(t, conn, transport.WebSocketRequest{Type: "unknown"})
+	if message.Type != "error" {
+		t.Errorf("expected an error but got %+v", message)
+	}
+	//
+	// Closing the broker, as the server does on shutdown, closes the connection
+	//
+	broker.Close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("expected the connection to close but got %v", err)
+	}
+}
+
+// reviewedDB keeps the moderation status an operator sets, so the feed summarizes the session as reviewed.
+type reviewedDB struct {
+	mockDB
+}
+
+func (m reviewedDB) SetModerationStatus(id int32, status model.ModerationStatus, reason string, actor string) (
+	db.ModerationChange, error) {
+	change, err := m.mockDB.SetModerationStatus(id, status, reason, actor)
+	for i := range m.feedbacks {
+		if err == nil && m.feedbacks[i].ID == id {
+			m.feedbacks[i] = change.After
+		}
+	}
+	return change, err
+}
+
+func TestHTTPServer_WebSocketFeed_Reviewed(t *testing.T) {
+	broker := pubsub.NewBroker(10, 10)
+	server := httptest.NewServer(transport.NewRouter(transport.WithDB(reviewedDB{mockDB{feedbacks: []model.Feedback{
+		{ID: 1, SessionID: "987", Rating: 2, Version: 1, ModerationStatus: model.ModerationFlagged},
+		{ID: 2, SessionID: "987", Rating: 4, Version: 1, ModerationStatus: model.ModerationApproved},
+	}}}), transport.WithStream(broker, time.Second), transport.WithOperatorTokens("secret")))
+	defer server.Close()
+	conn := dialFeed(t, server)
+	defer conn.Close()
+	message := sendRequest(t, conn, transport.WebSocketRequest{Type: "subscribe", SessionID: "987"})
+	if message.Type != "subscribed" || message.Aggregate.Count != 1 {
+		t.Fatalf("expected the aggregate of the approved feedback but got %+v", message)
+	}
+	//
+	// Approving the flagged feedback adds it to the aggregate even though it is older than the feedback summarized,
+	// approving it again changes nothing
+	//
+	review(t, server, "/v1/moderation/feedback/1/approve", "")
+	message = readMessage(t, conn)
+	if message.Type != "feedback" || message.Feedback == nil || message.Feedback.ID != 1 {
+		t.Fatalf("expected the approved feedback but got %+v", message)
+	} else if message.Aggregate.Count != 2 || message.Aggregate.Average != 3 || message.Delta.Count != 1 {
+		t.Errorf("unexpected aggregate %+v and delta %+v", message.Aggregate, message.Delta)
+	}
+	review(t, server, "/v1/moderation/feedback/1/approve", "")
+	//
+	// Hiding feedback removes it from the aggregate
+	//
+	review(t, server, "/v1/moderation/feedback/2/hide", `{"reason":"abusive"}`)
+	message = readMessage(t, conn)
+	if message.Type != "removed" || message.Feedback == nil || message.Feedback.ID != 2 {
+		t.Fatalf("expected the hidden feedback but got %+v", message)
+	} else if message.Aggregate.Count != 1 || message.Aggregate.Average != 2 || message.Delta.Count != -1 ||
+		message.Delta.Average != -1 {
+		t.Errorf("unexpected aggregate %+v and delta %+v", message.Aggregate, message.Delta)
+	}
+}
+
+// review reviews a feedback as an operator.
+func review(t *testing.T, server *httptest.Server, path string, body string) {
+	request, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("review returned wrong status code: got %v want %v", response.StatusCode, http.StatusOK)
+	}
+}
+
+func TestHTTPServer_WebSocketFeed_SlowClient(t *testing.T) {
+	broker := pubsub.NewBroker(10, 1)
+	server := httptest.NewServer(transport.NewRouter(transport.WithDB(mockDB{}), transport.WithStream(broker, time.Second)))
+	defer server.Close()
+	conn := dialFeed(t, server)
+	defer conn.Close()
+	sendRequest(t, conn, transport.WebSocketRequest{Type: "subscribe", SessionID: "987"})
+	for id := int32(1); id <= 100; id++ {
+		broker.Publish(model.Feedback{ID: id, SessionID: "987", Rating: 5, ModerationStatus: model.ModerationApproved})
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+				t.Errorf("expected the connection to close but got %v", err)
+			}
+			return
+		}
+	}
+}
+
+func TestHTTPServer_WebSocketFeed_Origin(t *testing.T) {
+	tests := []struct {
+		name     string
+		origin   string
+		expected int
+	}{
+		{name: "No Origin", origin: "", expected: http.StatusSwitchingProtocols},
+		{name: "Allowed Origin", origin: "https://app.example.com", expected: http.StatusSwitchingProtocols},
+		{name: "Other Origin", origin: "https://evil.com", expected: http.StatusForbidden},
+	}
+	server := httptest.NewServer(transport.NewRouter(transport.WithDB(mockDB{}),
+		transport.WithStream(pubsub.NewBroker(10, 10), time.Second),
+		transport.WithCORS(transport.CORSOptions{AllowedOrigins: []string{"https://*.example.com"}})))
+	defer server.Close()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if len(test.origin) > 0 {
+				header.Set("Origin", test.origin)
+			}
+			conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/ws", header)
+			if conn != nil {
+				conn.Close()
+			}
+			if response == nil {
+				t.Fatalf("failed to dial: %v", err)
+			} else if response.StatusCode != test.expected {
+				t.Errorf("handler returned wrong status code: got %v want %v", response.StatusCode, test.expected)
+			}
+		})
+	}
+}
+
+func dialFeed(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return conn
+}
+
+// sendRequest sends the request and reads the response to it.
+func sendRequest(t *testing.T, conn *websocket.Conn, request transport.WebSocketRequest) transport.WebSocketMessage {
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("failed to send the request: %v", err)
+	}
+	return readMessage(t, conn)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) transport.WebSocketMessage {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var message transport.WebSocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("failed to read the message: %v", err)
+	}
+	return message
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/retry"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderEvent is the header with the event of a delivery.
+	HeaderEvent = "X-Feedback-Event"
+	// HeaderDelivery is the header with the ID of a delivery. It is the same for every attempt of the delivery so
+	// receivers can ignore duplicates.
+	HeaderDelivery = "X-Feedback-Delivery"
+	// HeaderTimestamp is the header with the Unix time a delivery was attempted at.
+	HeaderTimestamp = "X-Feedback-Timestamp"
+	// HeaderSignature is the header with the signature of a delivery.
+	HeaderSignature = "X-Feedback-Signature"
+	// signaturePrefix identifies the algorithm of a signature.
+	signaturePrefix = "sha256="
+	// maxErrorBody is how much of the body of a failed response is kept as the error of the attempt.
+	maxErrorBody = 256
+)
+
+// Dispatcher delivers the events queued in the outbox to the webhooks. Each delivery is a POST of the JSON payload,
+// signed with the secret of the webhook. Failed deliveries are retried with an exponential backoff until the max
+// attempts, after which they are dead-lettered. Every attempt is recorded in the delivery log.
+type Dispatcher struct {
+	Store  db.WebhookStore
+	Client *http.Client
+	// Backoff is how long to wait before retrying a failed delivery.
+	Backoff retry.Backoff
+	// MaxAttempts is how many times a delivery is attempted before it is dead-lettered.
+	MaxAttempts int
+	// BatchSize is how many deliveries are attempted at once.
+	BatchSize int
+	// PollInterval is how often the outbox is checked for deliveries that are due.
+	PollInterval time.Duration
+}
+
+// Run delivers the deliveries that are due every poll interval until the context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			//
+			// Keep delivering while full batches are due so a backlog is cleared without waiting on the interval
+			//
+			for {
+				delivered, err := d.Deliver(ctx)
+				if err != nil {
+					log.Println(err)
+				}
+				if err != nil || delivered < d.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Deliver attempts a batch of the deliveries that are due, in parallel, and records the outcomes. How many were
+// attempted is returned.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	//
+	// A claimed delivery is not claimed again until the attempt has had the time to time out
+	//
+	lease := 2 * d.Client.Timeout
+	if lease <= 0 {
+		lease = time.Minute
+	}
+	deliveries, err := d.Store.ClaimWebhookDeliveries(time.Now(), lease, d.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim the webhook deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery db.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// attempt makes an attempt at the delivery and records its outcome.
+func (d *Dispatcher) attempt(ctx context.Context, delivery db.WebhookDelivery) {
+	start := time.Now()
+	statusCode, err := d.post(ctx, delivery, start)
+	if ctx.Err() != nil {
+		//
+		// Stopping is not the fault of the webhook, the delivery is attempted again once its claim expires
+		//
+		return
+	}
+	attempt := db.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		WebhookID:  delivery.WebhookID,
+		Attempt:    delivery.Attempts + 1,
+		StatusCode: statusCode,
+		DurationMs: time.Since(start).Milliseconds(),
+		Date:       start,
+	}
+	delivery.Attempts++
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = db.DeliveryDelivered
+	case delivery.Attempts >= d.MaxAttempts:
+		attempt.Error = err.Error()
+		delivery.Status = db.DeliveryDead
+		delivery.LastError = attempt.Error
+		log.Printf("Dead-lettered delivery %d to webhook %d after %d attempts: %v\n", delivery.ID, delivery.WebhookID,
+			delivery.Attempts, err)
+	default:
+		attempt.Error = err.Error()
+		delivery.Status = db.DeliveryPending
+		delivery.LastError = attempt.Error
+		delivery.NextAttempt = time.Now().Add(d.Backoff.Interval(delivery.Attempts - 1))
+	}
+	if err := d.Store.RecordWebhookAttempt(delivery, attempt); err != nil {
+		log.Println(fmt.Errorf("failed to record the attempt of delivery %d: %w", delivery.ID, err))
+	}
+}
+
+// post posts the payload of the delivery to the webhook. An error is returned unless the webhook responds with a 2xx.
+func (d *Dispatcher) post(ctx context.Context, delivery db.WebhookDelivery, now time.Time) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	timestamp := now.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "feedback-service-webhook")
+	request.Header.Set(HeaderEvent, string(delivery.Event))
+	request.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	response, err := d.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		//
+		// Drain the body so the connection can be reused
+		//
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		return response.StatusCode, nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+	return response.StatusCode, fmt.Errorf("webhook responded with %d: %s", response.StatusCode, body)
+}
+
+// Sign signs the body delivered at the Unix timestamp with the secret. The signature is the hex encoded HMAC-SHA256
+// of the timestamp, a '.' and the body, prefixed with 'sha256='. Signing the timestamp lets receivers reject replayed
+// deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks whether the signature is the signature of the body delivered at the Unix timestamp with the secret.
+// Receivers written in Go can use it to authenticate deliveries.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
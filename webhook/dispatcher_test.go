@@ -0,0 +1,137 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/Piszmog/feedback-service/db"
+	"github.com/Piszmog/feedback-service/retry"
+	"github.com/Piszmog/feedback-service/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockStore is an outbox of deliveries that are always due.
+type mockStore struct {
+	db.WebhookStore
+	mu         sync.Mutex
+	deliveries map[int64]db.WebhookDelivery
+	attempts   []db.WebhookAttempt
+}
+
+func (m *mockStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration,
+	limit int) ([]db.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []db.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == db.DeliveryPending && len(deliveries) < limit {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockStore) RecordWebhookAttempt(delivery db.WebhookDelivery, attempt db.WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[delivery.ID] = delivery
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	payload := []byte(`{"event":"feedback.created"}`)
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if !webhook.Verify("secret", timestamp, body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		//
+		// Delivery 2 always fails and delivery 1 fails once
+		//
+		mu.Lock()
+		defer mu.Unlock()
+		id := r.Header.Get(webhook.HeaderDelivery)
+		if id == "2" || (id == "1" && !failed[id]) {
+			failed[id] = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	store := &mockStore{deliveries: map[int64]db.WebhookDelivery{
+		1: {ID: 1, WebhookID: 7, Event: "feedback.created", Payload: payload, Status: db.DeliveryPending,
+			URL: receiver.URL, Secret: "secret"},
+		2: {ID: 2, WebhookID: 7, Event: "feedback.created", Payload: payload, Status: db.DeliveryPending,
+			URL: receiver.URL, Secret: "secret"},
+		3: {ID: 3, WebhookID: 8, Event: "feedback.created", Payload: payload, Status: db.DeliveryPending,
+			URL: receiver.URL, Secret: "wrong"},
+	}}
+	dispatcher := webhook.Dispatcher{
+		Store:       store,
+		Client:      receiver.Client(),
+		Backoff:     retry.Backoff{InitialInterval: time.Minute, MaxInterval: time.Hour, Multiplier: 2},
+		MaxAttempts: 2,
+		BatchSize:   10,
+	}
+	//
+	// Every failed delivery is retried once before being dead-lettered
+	//
+	for i := 0; i < 2; i++ {
+		if _, err := dispatcher.Deliver(context.Background()); err != nil {
+			t.Fatalf("unexpected error occurred: %v", err)
+		}
+	}
+	if delivery := store.deliveries[1]; delivery.Status != db.DeliveryDelivered || delivery.Attempts != 2 ||
+		len(delivery.LastError) > 0 {
+		t.Errorf("expected delivery 1 to be delivered on its retry but got %+v", delivery)
+	}
+	if delivery := store.deliveries[2]; delivery.Status != db.DeliveryDead || delivery.Attempts != 2 ||
+		delivery.LastError != "webhook responded with 500: " {
+		t.Errorf("expected delivery 2 to be dead but got %+v", delivery)
+	}
+	if delivery := store.deliveries[3]; delivery.Status != db.DeliveryDead {
+		t.Errorf("expected the badly signed delivery 3 to be dead but got %+v", delivery)
+	}
+	if len(store.attempts) != 6 {
+		t.Errorf("expected 6 attempts to be logged but got %d", len(store.attempts))
+	}
+	for _, attempt := range store.attempts {
+		if attempt.StatusCode == 0 || attempt.Attempt < 1 || attempt.Attempt > 2 {
+			t.Errorf("unexpected attempt %+v", attempt)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"feedback.deleted"}`)
+	signature := webhook.Sign("secret", 1600000000, body)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		expected  bool
+	}{
+		{name: "Valid", secret: "secret", timestamp: 1600000000, body: body, expected: true},
+		{name: "Other Secret", secret: "other", timestamp: 1600000000, body: body},
+		{name: "Replayed", secret: "secret", timestamp: 1600000060, body: body},
+		{name: "Tampered", secret: "secret", timestamp: 1600000000, body: []byte(`{"event":"feedback.created"}`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := webhook.Verify(test.secret, test.timestamp, test.body, signature); actual != test.expected {
+				t.Errorf("expected the signature to be valid %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// workers runs background work that is stopped when the application shuts down.
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// run runs the provided function in the background until its context is done.
+func (w *workers) run(name string, fn func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		log.Printf("Started background worker %s\n", name)
+		fn(w.ctx)
+		log.Printf("Stopped background worker %s\n", name)
+	}()
+}
+
+// stop signals the workers to stop and waits up to the timeout for them to finish.
+func (w *workers) stop(timeout time.Duration) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("timed out waiting for background workers to stop")
+	}
+}